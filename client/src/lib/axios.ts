@@ -4,3 +4,31 @@ export const axiosInstance = axios.create({
   baseURL: import.meta.env.VITE_API_URL,
   withCredentials: true,
 });
+
+const SAFE_METHODS = ["get", "head", "options"];
+
+let csrfToken: Promise<string> | null = null;
+
+// The API rejects state-changing requests without the CSRF token it issued
+// in a cookie, echoed back in a header. The cookie belongs to the API's
+// domain, so the token is read from the issuing response instead.
+function getCSRFToken() {
+  if (!csrfToken) {
+    csrfToken = axiosInstance
+      .get<{ csrf_token: string }>("/auth/csrf")
+      .then((res) => res.data.csrf_token)
+      .catch((err) => {
+        csrfToken = null;
+        throw err;
+      });
+  }
+  return csrfToken;
+}
+
+axiosInstance.interceptors.request.use(async (config) => {
+  const method = (config.method ?? "get").toLowerCase();
+  if (!SAFE_METHODS.includes(method) && config.url !== "/auth/csrf") {
+    config.headers.set("X-CSRF-Token", await getCSRFToken());
+  }
+  return config;
+});
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trnahnh/katana-id/internal/admin"
+	"github.com/trnahnh/katana-id/internal/auth"
+	"github.com/trnahnh/katana-id/internal/db"
+	"github.com/trnahnh/katana-id/internal/email"
+	"github.com/trnahnh/katana-id/internal/emailcheck"
+	"github.com/trnahnh/katana-id/util"
+)
+
+// runCommand handles one-off maintenance subcommands such as
+// `katanaid bootstrap-admin <email>` and `katanaid schema-check`.
+func runCommand(args []string) {
+	switch args[0] {
+	case "migrate":
+		runMigrate(args[1:])
+	case "bootstrap-admin":
+		bootstrapAdmin(args[1:])
+	case "purge-users":
+		purgeUsers()
+	case "email-duplicates":
+		emailDuplicates()
+	case "schema-dump":
+		schemaDump()
+	case "schema-check":
+		schemaCheck(args[1:])
+	case "email-preview":
+		emailPreview(args[1:])
+	default:
+		log.Fatal("Unknown command: ", args[0])
+	}
+}
+
+const migrateUsage = "Usage: katanaid migrate up | down <n> | goto <version> | status | force <version>"
+
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		log.Fatal("Missing required env: DB_URL")
+	}
+
+	var err error
+	switch args[0] {
+	case "up":
+		err = db.RunMigrations(dbURL)
+	case "down":
+		err = db.MigrateDown(dbURL, migrateArg(args))
+	case "goto":
+		err = db.MigrateTo(dbURL, uint(migrateArg(args)))
+	case "force":
+		err = db.ForceMigrationVersion(dbURL, migrateArg(args))
+	case "status":
+		printMigrationStatus(dbURL)
+		return
+	default:
+		log.Fatal(migrateUsage)
+	}
+	if err != nil {
+		log.Fatal("Migration failed: ", err)
+	}
+
+	printMigrationStatus(dbURL)
+}
+
+func migrateArg(args []string) int {
+	if len(args) != 2 {
+		log.Fatal(migrateUsage)
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	return n
+}
+
+func printMigrationStatus(dbURL string) {
+	status, err := db.GetMigrationStatus(dbURL)
+	if err != nil {
+		log.Fatal("Failed to read migration status: ", err)
+	}
+
+	fmt.Printf("version: %d", status.Version)
+	if status.Dirty {
+		fmt.Print(" (dirty, fix the database and run `katanaid migrate force <version>`)")
+	}
+	fmt.Println()
+
+	for _, version := range status.Available {
+		state := "pending"
+		if version <= status.Version {
+			state = "applied"
+		}
+		fmt.Printf("  %06d %s\n", version, state)
+	}
+}
+
+func bootstrapAdmin(args []string) {
+	if len(args) != 1 {
+		log.Fatal("Usage: katanaid bootstrap-admin <email>")
+	}
+
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		log.Fatal("Missing required env: DB_URL")
+	}
+
+	ctx := context.Background()
+	queries, pool, err := db.Connect(ctx, dbURL, db.ConfigFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	if err := db.RunMigrations(dbURL); err != nil {
+		log.Fatal("Failed to run migration: ", err)
+	}
+
+	user, err := admin.BootstrapAdmin(ctx, pool, queries, emailcheck.NormalizerFromEnv(), args[0])
+	if err != nil {
+		log.Fatal("Failed to bootstrap admin: ", err)
+	}
+
+	log.Print("🗡️  Granted admin to ", user.Email)
+}
+
+func purgeUsers() {
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		log.Fatal("Missing required env: DB_URL")
+	}
+
+	ctx := context.Background()
+	_, pool, err := db.Connect(ctx, dbURL, db.ConfigFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	grace := util.EnvDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour)
+	purged, err := auth.PurgeDeletedUsers(ctx, pool, grace)
+	if err != nil {
+		log.Fatal("Failed to purge deleted users: ", err)
+	}
+
+	log.Print("🧹 Purged ", purged, " deleted users")
+}
+
+// emailDuplicates lists accounts whose email matched an older account's once
+// normalized. They were found by the migration that added normalized emails
+// and stay listed until the account is deleted or moved to an address of its
+// own.
+func emailDuplicates() {
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		log.Fatal("Missing required env: DB_URL")
+	}
+
+	ctx := context.Background()
+	queries, pool, err := db.Connect(ctx, dbURL, db.ConfigFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	duplicates, err := queries.ListEmailDuplicates(ctx)
+	if err != nil {
+		log.Fatal("Failed to list duplicate emails: ", err)
+	}
+
+	if len(duplicates) == 0 {
+		log.Print("✅ No duplicate emails left to resolve")
+		return
+	}
+
+	for _, d := range duplicates {
+		fmt.Printf("%s\t%s (user %s) duplicates user %s\n", d.EmailNormalized, d.Email, d.UserID, d.KeptUserID)
+	}
+}
+
+// schemaDBURL is the server used for throwaway schema databases. Only a
+// temporary database is created on it, so the dev DB_URL is a safe default.
+func schemaDBURL() string {
+	if url := os.Getenv("SCHEMA_DB_URL"); url != "" {
+		return url
+	}
+
+	url := os.Getenv("DB_URL")
+	if url == "" {
+		log.Fatal("Missing required env: SCHEMA_DB_URL or DB_URL")
+	}
+	return url
+}
+
+func schemaDump() {
+	schema, err := db.DumpMigratedSchema(context.Background(), schemaDBURL())
+	if err != nil {
+		log.Fatal("Failed to dump schema: ", err)
+	}
+
+	fmt.Print(schema)
+}
+
+// schemaCheck fails when schema.sql, which sqlc compiles, no longer matches
+// the schema produced by applying every migration.
+func schemaCheck(args []string) {
+	path := "internal/db/schema.sql"
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	committed, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migrated, err := db.DumpMigratedSchema(context.Background(), schemaDBURL())
+	if err != nil {
+		log.Fatal("Failed to dump schema: ", err)
+	}
+
+	if string(committed) == migrated {
+		log.Print("✅ ", path, " matches migrations")
+		return
+	}
+
+	committedLines := map[string]bool{}
+	for _, line := range strings.Split(string(committed), "\n") {
+		committedLines[line] = true
+	}
+	migratedLines := map[string]bool{}
+	for _, line := range strings.Split(migrated, "\n") {
+		migratedLines[line] = true
+		if !committedLines[line] {
+			fmt.Fprintln(os.Stderr, "+ "+line)
+		}
+	}
+	for _, line := range strings.Split(string(committed), "\n") {
+		if !migratedLines[line] {
+			fmt.Fprintln(os.Stderr, "- "+line)
+		}
+	}
+
+	log.Fatal("❌ ", path, " has drifted from migrations, run `make schema`")
+}
+
+const emailPreviewUsage = "Usage: katanaid email-preview <template> [locale] [html|text]"
+
+// emailPreview renders an email template with sample data, honoring
+// EMAIL_TEMPLATE_DIR, so overrides can be checked before deploying.
+func emailPreview(args []string) {
+	if len(args) == 0 || len(args) > 3 {
+		log.Fatal(emailPreviewUsage, "\nTemplates: ", strings.Join(email.Names(), ", "))
+	}
+
+	templates, err := email.LoadTemplates(os.Getenv("EMAIL_TEMPLATE_DIR"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data, ok := email.SampleData(args[0])
+	if !ok {
+		log.Fatal("Unknown template: ", args[0], "\nTemplates: ", strings.Join(email.Names(), ", "))
+	}
+
+	locale := email.DefaultLocale
+	if len(args) > 1 {
+		locale = args[1]
+		if !templates.Supports(locale) {
+			log.Fatal("Unknown locale: ", locale, "\nLocales: ", strings.Join(templates.Locales(), ", "))
+		}
+	}
+
+	msg, err := templates.Render(args[0], locale, data)
+	if err != nil {
+		log.Fatal("Failed to render template: ", err)
+	}
+
+	part := "text"
+	if len(args) > 2 {
+		part = args[2]
+	}
+	switch part {
+	case "html":
+		fmt.Print(msg.HTML)
+	case "text":
+		fmt.Printf("Subject: %s\n\n%s", msg.Subject, msg.Text)
+	default:
+		log.Fatal(emailPreviewUsage)
+	}
+}
@@ -2,53 +2,293 @@ package main
 
 import (
 	"context"
+	"expvar"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
-	"github.com/go-chi/httprate"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"github.com/resend/resend-go/v3"
 
+	"github.com/trnahnh/katana-id/internal/admin"
 	"github.com/trnahnh/katana-id/internal/auth"
 	"github.com/trnahnh/katana-id/internal/db"
+	"github.com/trnahnh/katana-id/internal/device"
+	"github.com/trnahnh/katana-id/internal/email"
+	"github.com/trnahnh/katana-id/internal/emailcheck"
 	"github.com/trnahnh/katana-id/internal/health"
+	"github.com/trnahnh/katana-id/internal/origins"
+	"github.com/trnahnh/katana-id/internal/phone"
+	"github.com/trnahnh/katana-id/internal/ratelimit"
+	"github.com/trnahnh/katana-id/internal/sessioncache"
 	"github.com/trnahnh/katana-id/util"
 )
 
 func main() {
 	godotenv.Load()
+
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runCommand(os.Args[1:])
+		return
+	}
+
+	skipMigrations := flag.Bool("skip-migrations", false, "don't apply pending migrations on startup")
+	flag.Parse()
+
 	util.RequireEnvs()
 
 	ctx := context.Background()
-	queries, pool, err := db.Connect(ctx, os.Getenv("DB_URL"))
+	dbConfig := db.ConfigFromEnv()
+	queries, pool, err := db.Connect(ctx, os.Getenv("DB_URL"), dbConfig)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer pool.Close()
 
-	if err := db.RunMigrations(os.Getenv("DB_URL")); err != nil {
-		log.Fatal("Failed to run migration: ", err)
+	replicaURL := os.Getenv("DB_REPLICA_URL")
+	if replicaURL != "" {
+		replica, err := db.OpenPool(ctx, replicaURL, dbConfig)
+		if err != nil {
+			log.Fatal("Failed to connect to replica: ", err)
+		}
+		defer replica.Close()
+
+		queries = db.NewQueries(db.NewRouter(pool, replica), dbConfig)
+		log.Print("☁️  DB replica connected")
+	}
+
+	if !*skipMigrations {
+		if err := db.RunMigrations(os.Getenv("DB_URL")); err != nil {
+			log.Fatal("Failed to run migration: ", err)
+		}
+	}
+
+	deletionGrace := util.EnvDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour)
+	loginRetention := util.EnvDuration("LOGIN_HISTORY_RETENTION", 180*24*time.Hour)
+	go auth.StartPurgeJob(ctx, pool, time.Hour, deletionGrace, loginRetention)
+
+	var notify *pgxpool.Pool
+	if util.EnvBool("SESSION_CACHE_NOTIFY", false) {
+		notify = pool
+	}
+	sessions := sessioncache.New(util.EnvInt("SESSION_CACHE_SIZE", 10000), util.EnvDuration("SESSION_CACHE_TTL", 30*time.Second), notify)
+	go sessions.Listen(ctx)
+
+	rateLimits, err := ratelimit.New(os.Getenv("RATE_LIMIT_BACKEND"), queries, os.Getenv("REDIS_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, ok := rateLimits.(ratelimit.Postgres); ok {
+		go ratelimit.StartCleanup(ctx, queries, 10*time.Minute)
+	}
+
+	normalizer := emailcheck.NormalizerFromEnv()
+	ratePolicy, err := ratelimit.LoadPolicy(os.Getenv("RATE_LIMIT_POLICY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	globalLimit, err := ratePolicy.Middleware(rateLimits, normalizer, "global")
+	if err != nil {
+		log.Fatal(err)
+	}
+	sendOTPLimit, err := ratePolicy.Middleware(rateLimits, normalizer, "send-otp")
+	if err != nil {
+		log.Fatal(err)
+	}
+	verifyPhoneLimit, err := ratePolicy.Middleware(rateLimits, normalizer, "verify-phone")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	emailTemplates, err := email.LoadTemplates(os.Getenv("EMAIL_TEMPLATE_DIR"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	emailFrom := os.Getenv("EMAIL_FROM")
+	if emailFrom == "" {
+		emailFrom = email.DefaultFrom
+	}
+	mailer := &email.Mailer{
+		Client:    resend.NewClient(os.Getenv("RESEND_API_KEY")),
+		From:      emailFrom,
+		Templates: emailTemplates,
+	}
+	outbox := &email.Worker{
+		Queries:     queries,
+		Mailer:      mailer,
+		Concurrency: util.EnvInt("EMAIL_WORKERS", 4),
+		MaxAttempts: util.EnvInt("EMAIL_MAX_ATTEMPTS", 8),
+		BaseDelay:   util.EnvDuration("EMAIL_RETRY_BASE", 5*time.Second),
+		MaxDelay:    util.EnvDuration("EMAIL_RETRY_MAX", time.Hour),
+		Lease:       time.Minute,
+		Retention:   util.EnvDuration("EMAIL_RETENTION", 7*24*time.Hour),
+	}
+	if outbox.Concurrency < 1 || outbox.MaxAttempts < 1 {
+		log.Fatal("EMAIL_WORKERS and EMAIL_MAX_ATTEMPTS must be at least 1")
+	}
+	go outbox.Start(ctx, util.EnvDuration("EMAIL_POLL_INTERVAL", time.Second))
+
+	webhooks := &email.WebhookHandler{
+		Queries:   queries,
+		Pool:      pool,
+		Providers: map[string]email.WebhookProvider{},
+	}
+	if secret := os.Getenv("RESEND_WEBHOOK_SECRET"); secret != "" {
+		verifier, err := email.NewSvixVerifier(secret)
+		if err != nil {
+			log.Fatal(err)
+		}
+		webhooks.Providers["resend"] = email.ResendWebhook{Verifier: verifier}
+	}
+
+	allowedOrigins, err := origins.NewValidator(ctx, os.Getenv("ALLOWED_ORIGINS"), queries)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go allowedOrigins.Start(ctx, time.Minute)
+
+	emailCheck, err := emailcheck.CheckerFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	go emailCheck.Disposable.Start(ctx, time.Minute)
+
+	phoneProvider, err := phone.ProviderFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cookies := util.CookiesFromEnv()
+	authHandler := &auth.Handler{
+		Store:         auth.PgStore{Queries: queries, Pool: pool},
+		Queries:       queries,
+		Sessions:      sessions,
+		Cookies:       cookies,
+		Mailer:        mailer,
+		EmailCheck:    emailCheck,
+		Normalizer:    normalizer,
+		Phone:         phoneProvider,
+		Locator:       device.LocatorFromEnv(),
+		Pool:          pool,
+		DeletionGrace: deletionGrace,
+		APIURL:        os.Getenv("API_URL"),
+	}
+	exports := &auth.ExportWorker{
+		Queries:     queries,
+		Pool:        pool,
+		Mailer:      mailer,
+		APIURL:      os.Getenv("API_URL"),
+		Lease:       10 * time.Minute,
+		MaxAttempts: 3,
 	}
+	go exports.Start(ctx, 5*time.Second)
 
-	emailClient := resend.NewClient(os.Getenv("RESEND_API_KEY"))
-	auth := &auth.Handler{Queries: queries, EmailClient: emailClient}
+	adminHandler := &admin.Handler{Queries: queries, Sessions: sessions, Origins: allowedOrigins}
+
+	trustedProxies, err := util.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Origins registered for apps may sign their users in, but only
+	// ALLOWED_ORIGINS may call the routes that change the account or
+	// administer the service.
+	csrf := util.CSRF{AllowOrigin: allowedOrigins.Allowed, Cookies: cookies}
+	privilegedCSRF := util.CSRF{AllowOrigin: allowedOrigins.AllowedStatic, Cookies: cookies}
+	corsOrigin := func(r *http.Request, origin string) bool {
+		if privilegedRoute(r) {
+			return allowedOrigins.AllowedStatic(origin)
+		}
+		return allowedOrigins.Allowed(origin)
+	}
 
 	r := chi.NewRouter()
 
-	r.Use(cors.Handler(util.CorsOptions()))
-	r.Use(httprate.Limit(60, 1*time.Minute))
+	r.Use(util.ClientIPResolver{Trusted: trustedProxies}.Middleware)
+	r.Use(util.SecurityHeadersFromEnv(cookies.Dev).Middleware)
+	r.Use(cors.Handler(util.CorsOptions(corsOrigin)))
+	if replicaURL != "" {
+		r.Use(db.ReadYourWrites(util.EnvDuration("DB_REPLICA_STICKINESS", 5*time.Second), cookies))
+	}
+	r.Use(globalLimit)
 
 	r.Get("/health", health.Health)
 
+	// Providers authenticate with signatures rather than cookies, so
+	// webhooks sit outside the CSRF-protected routes.
+	r.Post("/webhooks/email/{provider}", webhooks.Handle)
+
+	// Links sent by email are authenticated by their token, and their pages
+	// post from a plain form, so they sit outside the CSRF-protected routes
+	// too.
+	r.Get("/auth/email-change/cancel", authHandler.CancelEmailChangePage)
+	r.Post("/auth/email-change/cancel", authHandler.CancelEmailChange)
+	r.Get("/auth/logins/revoke", authHandler.RevokeLoginPage)
+	r.Post("/auth/logins/revoke", authHandler.RevokeLogin)
+
 	r.Route("/auth", func(r chi.Router) {
-		r.With(httprate.Limit(1, 1*time.Minute)).Post("/send-otp", auth.SendOTP)
-		r.Post("/verify-otp", auth.VerifyOTP)
-		r.Get("/me", auth.Me)
-		r.Post("/logout", auth.Logout)
+		r.Use(csrf.Middleware)
+
+		r.Get("/csrf", csrf.Token)
+		r.With(sendOTPLimit).Post("/send-otp", authHandler.SendOTP)
+		r.Post("/verify-otp", authHandler.VerifyOTP)
+		r.Get("/me", authHandler.Me)
+
+		r.Group(func(r chi.Router) {
+			r.Use(privilegedCSRF.Middleware)
+			r.Use(authHandler.RequireUser)
+			r.Patch("/me", authHandler.UpdateMe)
+			r.Delete("/me", authHandler.DeleteMe)
+			r.Get("/me/export", authHandler.ExportMe)
+			r.Get("/me/export/{id}", authHandler.DownloadExport)
+			r.Post("/me/email", authHandler.RequestEmailChange)
+			r.Post("/me/email/confirm", authHandler.ConfirmEmailChange)
+			r.With(verifyPhoneLimit).Post("/me/phone", authHandler.RequestPhoneVerification)
+			r.Post("/me/phone/confirm", authHandler.ConfirmPhone)
+			r.Delete("/me/phone", authHandler.RemovePhone)
+			r.Get("/me/logins", authHandler.ListLogins)
+		})
+		r.Post("/logout", authHandler.Logout)
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(privilegedCSRF.Middleware)
+		r.Use(authHandler.RequireUser)
+
+		r.Group(func(r chi.Router) {
+			r.Use(authHandler.RequirePermission(admin.PermUsersRead))
+			r.Get("/users", adminHandler.SearchUsers)
+			r.Get("/users/{id}", adminHandler.GetUser)
+			r.Get("/users/{id}/sessions", adminHandler.ListSessions)
+			r.Get("/users/{id}/providers", adminHandler.ListProviders)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(authHandler.RequirePermission(admin.PermUsersWrite))
+			r.Post("/users/{id}/logout", adminHandler.ForceLogout)
+			r.Post("/users/{id}/disable", adminHandler.DisableUser)
+			r.Post("/users/{id}/enable", adminHandler.EnableUser)
+		})
+
+		r.With(authHandler.RequirePermission(admin.PermMetricsRead)).Get("/metrics", expvar.Handler().ServeHTTP)
+
+		r.With(authHandler.RequirePermission(admin.PermOriginsRead)).Get("/origins", adminHandler.ListOrigins)
+		r.Group(func(r chi.Router) {
+			r.Use(authHandler.RequirePermission(admin.PermOriginsWrite))
+			r.Post("/origins", adminHandler.CreateOrigin)
+			r.Delete("/origins/{id}", adminHandler.DeleteOrigin)
+		})
+
+		r.With(authHandler.RequirePermission(admin.PermEmailsRead)).Get("/emails", adminHandler.ListEmails)
+		r.With(authHandler.RequirePermission(admin.PermEmailsWrite)).Post("/emails/{id}/retry", adminHandler.RetryEmail)
+		r.With(authHandler.RequirePermission(admin.PermEmailsRead)).Get("/email-suppressions", adminHandler.ListSuppressions)
+		r.With(authHandler.RequirePermission(admin.PermEmailsWrite)).Delete("/email-suppressions/{email}", adminHandler.DeleteSuppression)
 	})
 
 	port := os.Getenv("PORT")
@@ -57,3 +297,25 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// privilegedRoute reports whether r, or the request r is a CORS preflight
+// for, goes to a route that changes the signed-in account or administers the
+// service.
+func privilegedRoute(r *http.Request) bool {
+	method := r.Method
+	if requested := r.Header.Get("Access-Control-Request-Method"); method == http.MethodOptions && requested != "" {
+		method = requested
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == "/admin" || strings.HasPrefix(path, "/admin/"):
+		return true
+	case strings.HasPrefix(path, "/auth/me/"):
+		return true
+	case path == "/auth/me":
+		return method != http.MethodGet && method != http.MethodHead
+	}
+
+	return false
+}
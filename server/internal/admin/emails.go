@@ -0,0 +1,179 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/audit"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/email"
+	"github.com/trnahnh/katana-id/util"
+)
+
+// outboxEmailResponse leaves out the rendered bodies, which may hold
+// sign-in codes.
+type outboxEmailResponse struct {
+	ID            string     `json:"id"`
+	Recipient     string     `json:"recipient"`
+	Template      string     `json:"template"`
+	Status        string     `json:"status"`
+	Attempts      int32      `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	// DeliveryStatus is the latest event reported by the provider's
+	// webhooks, such as delivered or bounced.
+	DeliveryStatus string `json:"delivery_status"`
+}
+
+type suppressionResponse struct {
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListEmails lists outbox emails by status, dead-lettered ones by default.
+func (h *Handler) ListEmails(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = email.StatusDead
+	case email.StatusPending, email.StatusSending, email.StatusSent, email.StatusDead:
+	default:
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid status"})
+		return
+	}
+
+	limit := queryInt(r, "limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := queryInt(r, "offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := h.Queries.ListOutboxEmails(r.Context(), gendb.ListOutboxEmailsParams{
+		Status: status,
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	res := make([]outboxEmailResponse, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, toOutboxEmailResponse(row))
+	}
+
+	util.WriteJSON(w, http.StatusOK, res)
+}
+
+// RetryEmail puts a dead-lettered email back in the outbox with a fresh
+// set of attempts. Expired emails can't be retried: their codes no longer
+// work.
+func (h *Handler) RetryEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid email ID"})
+		return
+	}
+
+	ctx := r.Context()
+	row, err := h.Queries.RetryOutboxEmail(ctx, pgtype.UUID{Bytes: id, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		util.WriteJSON(w, http.StatusNotFound, util.ErrorResponse{Error: "No unexpired dead-lettered email with that ID"})
+		return
+	}
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	audit.Record(ctx, h.Queries, r, audit.ActionEmailRetried, pgtype.UUID{}, actorID(r))
+
+	util.WriteJSON(w, http.StatusOK, toOutboxEmailResponse(row))
+}
+
+// ListSuppressions lists addresses that hard-bounced or reported our email
+// as spam, which sign-in codes are no longer sent to.
+func (h *Handler) ListSuppressions(w http.ResponseWriter, r *http.Request) {
+	limit := queryInt(r, "limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := queryInt(r, "offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := h.Queries.ListEmailSuppressions(r.Context(), gendb.ListEmailSuppressionsParams{
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	res := make([]suppressionResponse, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, suppressionResponse{
+			Email:     row.Email,
+			Reason:    row.Reason,
+			CreatedAt: row.CreatedAt.Time,
+		})
+	}
+
+	util.WriteJSON(w, http.StatusOK, res)
+}
+
+// DeleteSuppression lets email be sent to an address again, such as after
+// its owner fixed a full mailbox.
+func (h *Handler) DeleteSuppression(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	deleted, err := h.Queries.DeleteEmailSuppression(ctx, chi.URLParam(r, "email"))
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+	if deleted == 0 {
+		util.WriteJSON(w, http.StatusNotFound, util.ErrorResponse{Error: "Email is not suppressed"})
+		return
+	}
+
+	audit.Record(ctx, h.Queries, r, audit.ActionEmailUnsuppressed, pgtype.UUID{}, actorID(r))
+
+	util.WriteJSON(w, http.StatusOK, successResponse{Message: "Email unsuppressed"})
+}
+
+func toOutboxEmailResponse(row gendb.EmailOutbox) outboxEmailResponse {
+	res := outboxEmailResponse{
+		ID:             row.ID.String(),
+		Recipient:      row.Recipient,
+		Template:       row.Template,
+		Status:         row.Status,
+		Attempts:       row.Attempts,
+		LastError:      row.LastError.String,
+		NextAttemptAt:  row.NextAttemptAt.Time,
+		CreatedAt:      row.CreatedAt.Time,
+		DeliveryStatus: row.DeliveryStatus.String,
+	}
+	if row.SentAt.Valid {
+		res.SentAt = &row.SentAt.Time
+	}
+	if row.ExpiresAt.Valid {
+		res.ExpiresAt = &row.ExpiresAt.Time
+	}
+
+	return res
+}
@@ -0,0 +1,268 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/audit"
+	"github.com/trnahnh/katana-id/internal/auth"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/origins"
+	"github.com/trnahnh/katana-id/internal/sessioncache"
+	"github.com/trnahnh/katana-id/util"
+)
+
+const (
+	PermUsersRead    = "users:read"
+	PermUsersWrite   = "users:write"
+	PermMetricsRead  = "metrics:read"
+	PermOriginsRead  = "origins:read"
+	PermOriginsWrite = "origins:write"
+	PermEmailsRead   = "emails:read"
+	PermEmailsWrite  = "emails:write"
+)
+
+type userResponse struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type userDetailResponse struct {
+	userResponse
+	Roles []string `json:"roles"`
+}
+
+type sessionResponse struct {
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+}
+
+type providerResponse struct {
+	ProviderName      string    `json:"provider_name"`
+	ProviderAccountID string    `json:"provider_account_id"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type successResponse struct {
+	Message string `json:"message"`
+}
+
+// likeEscaper escapes the wildcards of ILIKE, so searches match their text
+// literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+type Handler struct {
+	Queries  *gendb.Queries
+	Sessions *sessioncache.Cache
+	Origins  *origins.Validator
+}
+
+func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	limit := queryInt(r, "limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := queryInt(r, "offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	users, err := h.Queries.SearchUsers(r.Context(), gendb.SearchUsersParams{
+		Query:  likeEscaper.Replace(r.URL.Query().Get("q")),
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	res := make([]userResponse, 0, len(users))
+	for _, user := range users {
+		res = append(res, toUserResponse(user))
+	}
+
+	util.WriteJSON(w, http.StatusOK, res)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := h.Queries.ListUserRoles(r.Context(), user.ID)
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+
+	util.WriteJSON(w, http.StatusOK, userDetailResponse{
+		userResponse: toUserResponse(user),
+		Roles:        roles,
+	})
+}
+
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.Queries.ListSessionsByUserID(r.Context(), user.ID)
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	res := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, sessionResponse{
+			CreatedAt: session.CreatedAt.Time,
+			ExpiresAt: session.ExpiresAt.Time,
+			UserAgent: session.UserAgent.String,
+			IPAddress: session.IpAddress.String,
+		})
+	}
+
+	util.WriteJSON(w, http.StatusOK, res)
+}
+
+func (h *Handler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	providers, err := h.Queries.ListProvidersByUserID(r.Context(), user.ID)
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	res := make([]providerResponse, 0, len(providers))
+	for _, provider := range providers {
+		res = append(res, providerResponse{
+			ProviderName:      provider.ProviderName,
+			ProviderAccountID: provider.ProviderAccountID,
+			CreatedAt:         provider.CreatedAt.Time,
+		})
+	}
+
+	util.WriteJSON(w, http.StatusOK, res)
+}
+
+func (h *Handler) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.Queries.DeleteSessionsByUserID(ctx, user.ID); err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	h.Sessions.InvalidateUser(ctx, user.ID)
+	audit.Record(ctx, h.Queries, r, audit.ActionForceLogout, user.ID, actorID(r))
+
+	util.WriteJSON(w, http.StatusOK, successResponse{Message: "User logged out"})
+}
+
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, auth.StatusDisabled, audit.ActionUserDisabled)
+}
+
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, auth.StatusActive, audit.ActionUserEnabled)
+}
+
+func (h *Handler) setStatus(w http.ResponseWriter, r *http.Request, status string, action string) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	user, err := h.Queries.UpdateUserStatus(ctx, gendb.UpdateUserStatusParams{
+		ID:     user.ID,
+		Status: status,
+	})
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	if status != auth.StatusActive {
+		if err := h.Queries.DeleteSessionsByUserID(ctx, user.ID); err != nil {
+			util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+			return
+		}
+	}
+
+	h.Sessions.InvalidateUser(ctx, user.ID)
+	audit.Record(ctx, h.Queries, r, action, user.ID, actorID(r))
+
+	util.WriteJSON(w, http.StatusOK, toUserResponse(user))
+}
+
+// loadUser looks up the user named by the {id} URL parameter, writing an
+// error response and returning false when it can't be found.
+func (h *Handler) loadUser(w http.ResponseWriter, r *http.Request) (gendb.User, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid user ID"})
+		return gendb.User{}, false
+	}
+
+	user, err := h.Queries.GetUserByID(r.Context(), pgtype.UUID{Bytes: id, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		util.WriteJSON(w, http.StatusNotFound, util.ErrorResponse{Error: "User not found"})
+		return gendb.User{}, false
+	}
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return gendb.User{}, false
+	}
+
+	return user, true
+}
+
+func actorID(r *http.Request) pgtype.UUID {
+	actor, _ := auth.UserFromContext(r.Context())
+	return actor.ID
+}
+
+func queryInt(r *http.Request, key string, fallback int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+func toUserResponse(user gendb.User) userResponse {
+	return userResponse{
+		ID:        user.ID.String(),
+		Email:     user.Email,
+		Username:  user.Username,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt.Time,
+	}
+}
@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/audit"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/origins"
+	"github.com/trnahnh/katana-id/util"
+)
+
+type originRequest struct {
+	Origin  string `json:"origin"`
+	AppName string `json:"app_name"`
+}
+
+type originResponse struct {
+	ID        string    `json:"id"`
+	Origin    string    `json:"origin"`
+	AppName   string    `json:"app_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h *Handler) ListOrigins(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.Queries.ListAppOrigins(r.Context())
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	res := make([]originResponse, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, toOriginResponse(row))
+	}
+
+	util.WriteJSON(w, http.StatusOK, res)
+}
+
+// CreateOrigin registers an app origin, such as a customer's frontend, so
+// browsers on it may call the API. Wildcard subdomains are allowed.
+func (h *Handler) CreateOrigin(w http.ResponseWriter, r *http.Request) {
+	var req originRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	pattern, err := origins.ParsePattern(req.Origin)
+	if err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	appName := strings.TrimSpace(req.AppName)
+	if appName == "" {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "App name is required"})
+		return
+	}
+
+	ctx := r.Context()
+	row, err := h.Queries.CreateAppOrigin(ctx, gendb.CreateAppOriginParams{
+		Origin:  pattern.String(),
+		AppName: appName,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		util.WriteJSON(w, http.StatusConflict, util.ErrorResponse{Error: "Origin already registered"})
+		return
+	}
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	h.refreshOrigins(r)
+	audit.Record(ctx, h.Queries, r, audit.ActionOriginAdded, pgtype.UUID{}, actorID(r))
+
+	util.WriteJSON(w, http.StatusCreated, toOriginResponse(row))
+}
+
+func (h *Handler) DeleteOrigin(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid origin ID"})
+		return
+	}
+
+	ctx := r.Context()
+	deleted, err := h.Queries.DeleteAppOrigin(ctx, pgtype.UUID{Bytes: id, Valid: true})
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+	if deleted == 0 {
+		util.WriteJSON(w, http.StatusNotFound, util.ErrorResponse{Error: "Origin not found"})
+		return
+	}
+
+	h.refreshOrigins(r)
+	audit.Record(ctx, h.Queries, r, audit.ActionOriginRemoved, pgtype.UUID{}, actorID(r))
+
+	util.WriteJSON(w, http.StatusOK, successResponse{Message: "Origin removed"})
+}
+
+// refreshOrigins applies a change on this replica right away. Others pick
+// it up on their next periodic refresh.
+func (h *Handler) refreshOrigins(r *http.Request) {
+	if h.Origins == nil {
+		return
+	}
+
+	if err := h.Origins.Refresh(r.Context()); err != nil {
+		log.Print("Failed to refresh app origins: ", err)
+	}
+}
+
+func toOriginResponse(row gendb.AppOrigin) originResponse {
+	return originResponse{
+		ID:        row.ID.String(),
+		Origin:    row.Origin,
+		AppName:   row.AppName,
+		CreatedAt: row.CreatedAt.Time,
+	}
+}
@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trnahnh/katana-id/internal/audit"
+	"github.com/trnahnh/katana-id/internal/auth"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/emailcheck"
+)
+
+const RoleAdmin = "admin"
+
+// bootstrapLockID keys the advisory lock that serializes admin bootstraps,
+// so two run at once can't both find no admin and both grant it.
+const bootstrapLockID = 7_391_004_222
+
+var ErrAdminExists = errors.New("an admin already exists")
+
+// BootstrapAdmin grants the admin role to the user with the given email,
+// creating the user first if needed. It refuses to run once any admin
+// exists; further admins are managed by existing admins.
+func BootstrapAdmin(ctx context.Context, pool *pgxpool.Pool, queries *gendb.Queries, normalizer emailcheck.Normalizer, email string) (gendb.User, error) {
+	addr, err := emailcheck.Parse(email)
+	if err != nil {
+		return gendb.User{}, err
+	}
+	email = addr.String()
+	normalized := normalizer.Normalize(addr)
+
+	var user gendb.User
+	err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", bootstrapLockID); err != nil {
+			return err
+		}
+		q := queries.WithTx(tx)
+
+		count, err := q.CountUsersWithRole(ctx, RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAdminExists
+		}
+
+		user, err = q.GetUserByEmail(ctx, gendb.GetUserByEmailParams{
+			Email:           email,
+			EmailNormalized: normalized,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			user, err = auth.CreateUserForEmail(ctx, q, email, normalized)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := q.AssignRole(ctx, gendb.AssignRoleParams{
+			UserID:   user.ID,
+			RoleName: RoleAdmin,
+		}); err != nil {
+			return err
+		}
+
+		audit.Record(ctx, q, nil, audit.ActionAdminBootstrap, user.ID, user.ID)
+		return nil
+	})
+	if err != nil {
+		return gendb.User{}, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/util"
+)
+
+const (
+	ActionAdminBootstrap    = "admin.bootstrap"
+	ActionForceLogout       = "admin.force_logout"
+	ActionUserDisabled      = "admin.user_disabled"
+	ActionUserEnabled       = "admin.user_enabled"
+	ActionOriginAdded       = "admin.origin_added"
+	ActionOriginRemoved     = "admin.origin_removed"
+	ActionEmailRetried      = "admin.email_retried"
+	ActionEmailUnsuppressed = "admin.email_unsuppressed"
+
+	ActionDeletionRequested = "account.deletion_requested"
+	ActionAccountRestored   = "account.restored"
+	ActionDataExported      = "account.data_exported"
+
+	ActionEmailChangeRequested = "security.email_change_requested"
+	ActionEmailChangeCancelled = "security.email_change_cancelled"
+	ActionEmailChanged         = "security.email_changed"
+	ActionEmailChangeReverted  = "security.email_change_reverted"
+
+	ActionPhoneVerificationRequested = "security.phone_verification_requested"
+	ActionPhoneVerified              = "security.phone_verified"
+	ActionPhoneRemoved               = "security.phone_removed"
+
+	ActionLoginRevoked = "security.login_revoked"
+)
+
+// Store is the persistence Record needs. *gendb.Queries satisfies it.
+type Store interface {
+	CreateAuditEvent(ctx context.Context, arg gendb.CreateAuditEventParams) error
+}
+
+// Record stores an audit event for userID performed by actorID. r may be nil
+// for events that don't originate from an HTTP request. Failures are logged
+// rather than returned so auditing never blocks the action itself.
+func Record(ctx context.Context, queries Store, r *http.Request, action string, userID, actorID pgtype.UUID) {
+	params := gendb.CreateAuditEventParams{
+		UserID:  userID,
+		ActorID: actorID,
+		Action:  action,
+	}
+
+	if r != nil {
+		params.IpAddress = pgtype.Text{String: util.ClientIP(r), Valid: true}
+		params.UserAgent = pgtype.Text{String: r.UserAgent(), Valid: r.UserAgent() != ""}
+	}
+
+	if err := queries.CreateAuditEvent(ctx, params); err != nil {
+		log.Print("Failed to record audit event ", action, ": ", err)
+	}
+}
@@ -0,0 +1,620 @@
+// Package authtest provides an in-memory auth.TxStore for exercising the
+// auth handlers without Postgres.
+package authtest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/auth"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+var _ auth.TxStore = (*Store)(nil)
+
+// Store is an in-memory auth.TxStore that mirrors the semantics of the
+// Postgres queries it stands in for. InTx calls are serialized and their
+// writes are discarded if fn fails. The zero value is ready to use.
+type Store struct {
+	txMu sync.Mutex // serializes InTx
+	mu   sync.Mutex // guards the fields below
+
+	otps        []gendb.Otp
+	phoneOTPs   []gendb.PhoneOtp
+	sessions    []gendb.Session
+	users       []gendb.User
+	devices     []gendb.UserDevice
+	logins      []gendb.Login
+	auditEvents []gendb.CreateAuditEventParams
+	emails      []gendb.EmailOutbox
+	suppressed  []string
+}
+
+type snapshot struct {
+	otps        []gendb.Otp
+	phoneOTPs   []gendb.PhoneOtp
+	sessions    []gendb.Session
+	users       []gendb.User
+	devices     []gendb.UserDevice
+	logins      []gendb.Login
+	auditEvents []gendb.CreateAuditEventParams
+	emails      []gendb.EmailOutbox
+}
+
+func (s *Store) InTx(ctx context.Context, fn func(auth.Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	snap := snapshot{
+		otps:        slices.Clone(s.otps),
+		phoneOTPs:   slices.Clone(s.phoneOTPs),
+		sessions:    slices.Clone(s.sessions),
+		users:       slices.Clone(s.users),
+		devices:     slices.Clone(s.devices),
+		logins:      slices.Clone(s.logins),
+		auditEvents: slices.Clone(s.auditEvents),
+		emails:      slices.Clone(s.emails),
+	}
+	s.mu.Unlock()
+
+	if err := fn(s); err != nil {
+		s.mu.Lock()
+		s.otps, s.phoneOTPs, s.sessions, s.users = snap.otps, snap.phoneOTPs, snap.sessions, snap.users
+		s.devices, s.logins = snap.devices, snap.logins
+		s.auditEvents, s.emails = snap.auditEvents, snap.emails
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// AddUser inserts user as is, filling in an ID and creation time if unset.
+func (s *Store) AddUser(user gendb.User) gendb.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !user.ID.Valid {
+		user.ID = newUUID()
+	}
+	if !user.CreatedAt.Valid {
+		user.CreatedAt = now()
+	}
+	if user.Status == "" {
+		user.Status = auth.StatusActive
+	}
+	s.users = append(s.users, user)
+
+	return user
+}
+
+// OTPs returns the stored codes for email.
+func (s *Store) OTPs(email string) []gendb.Otp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var otps []gendb.Otp
+	for _, otp := range s.otps {
+		if otp.Email == email {
+			otps = append(otps, otp)
+		}
+	}
+	return otps
+}
+
+// PhoneOTPs returns the stored text message codes for phone.
+func (s *Store) PhoneOTPs(phone string) []gendb.PhoneOtp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var otps []gendb.PhoneOtp
+	for _, otp := range s.phoneOTPs {
+		if otp.Phone == phone {
+			otps = append(otps, otp)
+		}
+	}
+	return otps
+}
+
+// Sessions returns every stored session, expired or not.
+func (s *Store) Sessions() []gendb.Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.sessions)
+}
+
+// Logins returns the login history of every user, oldest first.
+func (s *Store) Logins() []gendb.Login {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.logins)
+}
+
+// Devices returns the devices remembered for every user.
+func (s *Store) Devices() []gendb.UserDevice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.devices)
+}
+
+// Suppress puts email on the suppression list.
+func (s *Store) Suppress(email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.suppressed = append(s.suppressed, strings.ToLower(email))
+}
+
+// Emails returns the emails written to the outbox so far.
+func (s *Store) Emails() []gendb.EmailOutbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.emails)
+}
+
+// AuditEvents returns the audit events recorded so far.
+func (s *Store) AuditEvents() []gendb.CreateAuditEventParams {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.auditEvents)
+}
+
+func (s *Store) CreateOTP(ctx context.Context, arg gendb.CreateOTPParams) (gendb.Otp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	otp := gendb.Otp{
+		ID:        newUUID(),
+		Email:     arg.Email,
+		Otp:       arg.Otp,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	s.otps = append(s.otps, otp)
+	return otp, nil
+}
+
+func (s *Store) ConsumeOTP(ctx context.Context, arg gendb.ConsumeOTPParams) (gendb.Otp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest := -1
+	for i, otp := range s.otps {
+		if otp.Email != arg.Email || !live(otp.ExpiresAt) {
+			continue
+		}
+		if latest < 0 || otp.ExpiresAt.Time.After(s.otps[latest].ExpiresAt.Time) {
+			latest = i
+		}
+	}
+	if latest < 0 || s.otps[latest].Otp != arg.Otp {
+		return gendb.Otp{}, pgx.ErrNoRows
+	}
+
+	otp := s.otps[latest]
+	s.otps = slices.Delete(s.otps, latest, latest+1)
+	return otp, nil
+}
+
+func (s *Store) DeleteOTPsByEmail(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.otps = slices.DeleteFunc(s.otps, func(otp gendb.Otp) bool {
+		return otp.Email == email
+	})
+	return nil
+}
+
+func (s *Store) CreatePhoneOTP(ctx context.Context, arg gendb.CreatePhoneOTPParams) (gendb.PhoneOtp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	otp := gendb.PhoneOtp{
+		ID:        newUUID(),
+		Phone:     arg.Phone,
+		Otp:       arg.Otp,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: now(),
+	}
+	s.phoneOTPs = append(s.phoneOTPs, otp)
+	return otp, nil
+}
+
+func (s *Store) ConsumePhoneOTP(ctx context.Context, arg gendb.ConsumePhoneOTPParams) (gendb.PhoneOtp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest := -1
+	for i, otp := range s.phoneOTPs {
+		if otp.Phone != arg.Phone || otp.UserID != arg.UserID || !live(otp.ExpiresAt) {
+			continue
+		}
+		if latest < 0 || otp.ExpiresAt.Time.After(s.phoneOTPs[latest].ExpiresAt.Time) {
+			latest = i
+		}
+	}
+	if latest < 0 || s.phoneOTPs[latest].Otp != arg.Otp {
+		return gendb.PhoneOtp{}, pgx.ErrNoRows
+	}
+
+	otp := s.phoneOTPs[latest]
+	s.phoneOTPs = slices.Delete(s.phoneOTPs, latest, latest+1)
+	return otp, nil
+}
+
+func (s *Store) DeletePhoneOTPs(ctx context.Context, phone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.phoneOTPs = slices.DeleteFunc(s.phoneOTPs, func(otp gendb.PhoneOtp) bool {
+		return otp.Phone == phone
+	})
+	return nil
+}
+
+func (s *Store) CreateSession(ctx context.Context, arg gendb.CreateSessionParams) (gendb.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session := gendb.Session{
+		Token:     newUUID(),
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: now(),
+		UserAgent: arg.UserAgent,
+		IpAddress: arg.IpAddress,
+		UserID:    arg.UserID,
+	}
+	s.sessions = append(s.sessions, session)
+	return session, nil
+}
+
+func (s *Store) GetSession(ctx context.Context, token pgtype.UUID) (gendb.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.Token == token && live(session.ExpiresAt) {
+			return session, nil
+		}
+	}
+	return gendb.Session{}, pgx.ErrNoRows
+}
+
+func (s *Store) DeleteSessionByToken(ctx context.Context, token pgtype.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = slices.DeleteFunc(s.sessions, func(session gendb.Session) bool {
+		return session.Token == token
+	})
+	for i, login := range s.logins {
+		if login.SessionToken == token {
+			s.logins[i].SessionToken = pgtype.UUID{}
+		}
+	}
+	return nil
+}
+
+// CreateUser behaves like the ON CONFLICT DO NOTHING insert: a clash on
+// email, normalized email or case-insensitive username yields pgx.ErrNoRows.
+func (s *Store) CreateUser(ctx context.Context, arg gendb.CreateUserParams) (gendb.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == arg.Email || strings.EqualFold(user.Username, arg.Username) ||
+			(arg.EmailNormalized.Valid && user.EmailNormalized == arg.EmailNormalized) {
+			return gendb.User{}, pgx.ErrNoRows
+		}
+	}
+
+	user := gendb.User{
+		ID:              newUUID(),
+		Username:        arg.Username,
+		Email:           arg.Email,
+		EmailNormalized: arg.EmailNormalized,
+		CreatedAt:       now(),
+		Status:          auth.StatusActive,
+	}
+	s.users = append(s.users, user)
+	return user, nil
+}
+
+// GetUserByEmail prefers the user with exactly arg.Email over one whose
+// normalized email matches, like the ORDER BY of the query.
+func (s *Store) GetUserByEmail(ctx context.Context, arg gendb.GetUserByEmailParams) (gendb.User, error) {
+	user, err := s.findUser(func(user gendb.User) bool { return user.Email == arg.Email })
+	if err == nil {
+		return user, nil
+	}
+
+	return s.findUser(func(user gendb.User) bool {
+		return user.EmailNormalized.Valid && user.EmailNormalized.String == arg.EmailNormalized
+	})
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id pgtype.UUID) (gendb.User, error) {
+	return s.findUser(func(user gendb.User) bool { return user.ID == id })
+}
+
+func (s *Store) GetUserByPhone(ctx context.Context, phone string) (gendb.User, error) {
+	return s.findUser(func(user gendb.User) bool { return user.Phone.Valid && user.Phone.String == phone })
+}
+
+func (s *Store) IsUsernameTaken(ctx context.Context, username string) (bool, error) {
+	_, err := s.findUser(func(user gendb.User) bool { return strings.EqualFold(user.Username, username) })
+	return err == nil, nil
+}
+
+func (s *Store) RestoreUser(ctx context.Context, id pgtype.UUID) (gendb.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, user := range s.users {
+		if user.ID == id && user.Status == auth.StatusPendingDeletion {
+			s.users[i].Status = auth.StatusActive
+			s.users[i].DeletionRequestedAt = pgtype.Timestamptz{}
+			return s.users[i], nil
+		}
+	}
+	return gendb.User{}, pgx.ErrNoRows
+}
+
+// UpdateUsername fails with the unique violation Postgres would raise when
+// another user has the username in any case.
+func (s *Store) UpdateUsername(ctx context.Context, arg gendb.UpdateUsernameParams) (gendb.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.ID != arg.ID && strings.EqualFold(user.Username, arg.Username) {
+			return gendb.User{}, &pgconn.PgError{Code: "23505", ConstraintName: "users_username_lower_idx"}
+		}
+	}
+
+	return s.updateUser(arg.ID, func(user *gendb.User) {
+		user.Username = arg.Username
+		user.UsernameChangedAt = now()
+	})
+}
+
+func (s *Store) UpdateDisplayName(ctx context.Context, arg gendb.UpdateDisplayNameParams) (gendb.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateUser(arg.ID, func(user *gendb.User) { user.DisplayName = arg.DisplayName })
+}
+
+func (s *Store) UpdateUserLocale(ctx context.Context, arg gendb.UpdateUserLocaleParams) (gendb.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateUser(arg.ID, func(user *gendb.User) { user.Locale = arg.Locale })
+}
+
+func (s *Store) TouchUserDevice(ctx context.Context, arg gendb.TouchUserDeviceParams) (gendb.UserDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, device := range s.devices {
+		if device.UserID == arg.UserID && device.Fingerprint == arg.Fingerprint {
+			s.devices[i].Name = arg.Name
+			s.devices[i].LastSeenAt = now()
+			return s.devices[i], nil
+		}
+	}
+	return gendb.UserDevice{}, pgx.ErrNoRows
+}
+
+func (s *Store) CreateUserDevice(ctx context.Context, arg gendb.CreateUserDeviceParams) (gendb.UserDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, device := range s.devices {
+		if device.UserID == arg.UserID && device.Fingerprint == arg.Fingerprint {
+			return gendb.UserDevice{}, pgx.ErrNoRows
+		}
+	}
+
+	device := gendb.UserDevice{
+		ID:          newUUID(),
+		UserID:      arg.UserID,
+		Fingerprint: arg.Fingerprint,
+		Name:        arg.Name,
+		FirstSeenAt: now(),
+		LastSeenAt:  now(),
+	}
+	s.devices = append(s.devices, device)
+	return device, nil
+}
+
+func (s *Store) DeleteUserDevice(ctx context.Context, arg gendb.DeleteUserDeviceParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.devices = slices.DeleteFunc(s.devices, func(device gendb.UserDevice) bool {
+		return device.UserID == arg.UserID && device.Fingerprint == arg.Fingerprint
+	})
+	return nil
+}
+
+func (s *Store) HasLogins(ctx context.Context, userID pgtype.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.ContainsFunc(s.logins, func(login gendb.Login) bool {
+		return login.UserID == userID
+	}), nil
+}
+
+func (s *Store) IsNewLoginCountry(ctx context.Context, arg gendb.IsNewLoginCountryParams) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	located, seen := false, false
+	for _, login := range s.logins {
+		if login.UserID != arg.UserID || !login.Country.Valid {
+			continue
+		}
+		located = true
+		seen = seen || login.Country.String == arg.Country
+	}
+	return located && !seen, nil
+}
+
+func (s *Store) CreateLogin(ctx context.Context, arg gendb.CreateLoginParams) (gendb.Login, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login := gendb.Login{
+		ID:           newUUID(),
+		UserID:       arg.UserID,
+		SessionToken: arg.SessionToken,
+		Method:       arg.Method,
+		Fingerprint:  arg.Fingerprint,
+		DeviceName:   arg.DeviceName,
+		UserAgent:    arg.UserAgent,
+		IpAddress:    arg.IpAddress,
+		Country:      arg.Country,
+		NewDevice:    arg.NewDevice,
+		NewCountry:   arg.NewCountry,
+		RevokeToken:  newUUID(),
+		CreatedAt:    now(),
+	}
+	s.logins = append(s.logins, login)
+	return login, nil
+}
+
+func (s *Store) GetLoginByRevokeToken(ctx context.Context, revokeToken pgtype.UUID) (gendb.Login, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, login := range s.logins {
+		if login.RevokeToken == revokeToken && !login.RevokedAt.Valid {
+			return login, nil
+		}
+	}
+	return gendb.Login{}, pgx.ErrNoRows
+}
+
+func (s *Store) RevokeLogin(ctx context.Context, revokeToken pgtype.UUID) (gendb.Login, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, login := range s.logins {
+		if login.RevokeToken == revokeToken && !login.RevokedAt.Valid {
+			s.logins[i].RevokedAt = now()
+			return s.logins[i], nil
+		}
+	}
+	return gendb.Login{}, pgx.ErrNoRows
+}
+
+// ListLoginsByUserID pages through a user's logins newest first, like the
+// ORDER BY of the query.
+func (s *Store) ListLoginsByUserID(ctx context.Context, arg gendb.ListLoginsByUserIDParams) ([]gendb.Login, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var logins []gendb.Login
+	for _, login := range slices.Backward(s.logins) {
+		if login.UserID == arg.UserID {
+			logins = append(logins, login)
+		}
+	}
+
+	start := min(int(arg.Offset), len(logins))
+	end := min(start+int(arg.Limit), len(logins))
+	return logins[start:end], nil
+}
+
+func (s *Store) CreateAuditEvent(ctx context.Context, arg gendb.CreateAuditEventParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.auditEvents = append(s.auditEvents, arg)
+	return nil
+}
+
+func (s *Store) CreateOutboxEmail(ctx context.Context, arg gendb.CreateOutboxEmailParams) (gendb.EmailOutbox, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, email := range s.emails {
+		if email.IdempotencyKey == arg.IdempotencyKey {
+			return gendb.EmailOutbox{}, pgx.ErrNoRows
+		}
+	}
+
+	email := gendb.EmailOutbox{
+		ID:             newUUID(),
+		IdempotencyKey: arg.IdempotencyKey,
+		Recipient:      arg.Recipient,
+		Template:       arg.Template,
+		Subject:        arg.Subject,
+		Html:           arg.Html,
+		BodyText:       arg.BodyText,
+		ExpiresAt:      arg.ExpiresAt,
+		Status:         "pending",
+		NextAttemptAt:  now(),
+		CreatedAt:      now(),
+	}
+	s.emails = append(s.emails, email)
+	return email, nil
+}
+
+func (s *Store) IsEmailSuppressed(ctx context.Context, email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Contains(s.suppressed, strings.ToLower(email)), nil
+}
+
+func (s *Store) findUser(match func(gendb.User) bool) (gendb.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+	return gendb.User{}, pgx.ErrNoRows
+}
+
+// updateUser applies update to the user with id. s.mu must be held.
+func (s *Store) updateUser(id pgtype.UUID, update func(*gendb.User)) (gendb.User, error) {
+	for i := range s.users {
+		if s.users[i].ID == id {
+			update(&s.users[i])
+			return s.users[i], nil
+		}
+	}
+	return gendb.User{}, pgx.ErrNoRows
+}
+
+func newUUID() pgtype.UUID {
+	return pgtype.UUID{Bytes: uuid.New(), Valid: true}
+}
+
+func now() pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: time.Now(), Valid: true}
+}
+
+func live(expires pgtype.Timestamptz) bool {
+	return expires.Time.After(time.Now())
+}
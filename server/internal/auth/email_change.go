@@ -0,0 +1,409 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/audit"
+	"github.com/trnahnh/katana-id/internal/db"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/email"
+	"github.com/trnahnh/katana-id/internal/emailcheck"
+	"github.com/trnahnh/katana-id/util"
+)
+
+const (
+	emailChangeTTL = 15 * time.Minute
+	// emailChangeRevertWindow is how long the link sent to the old address
+	// keeps working after the change is confirmed, so a change made from a
+	// stolen session can still be undone.
+	emailChangeRevertWindow = 7 * 24 * time.Hour
+	// maxEmailChangeAttempts is how many wrong codes a pending change takes
+	// before it is dropped, so its code can't be guessed.
+	maxEmailChangeAttempts = 5
+)
+
+var errEmailTaken = errors.New("email already in use")
+
+type changeEmailRequest struct {
+	Email string
+}
+
+type confirmEmailChangeRequest struct {
+	OTP string
+}
+
+// RequestEmailChange starts an email change for the signed-in user. A code
+// is sent to the new address, and the old address gets a notice with a link
+// to cancel the change, or to undo it for emailChangeRevertWindow once
+// confirmed.
+func (h *Handler) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	var req changeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	check, ok := h.checkEmail(w, r, req.Email)
+	if !ok {
+		return
+	}
+	req.Email = check.Address.String()
+
+	if req.Email == user.Email {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Email unchanged"})
+		return
+	}
+
+	// Changing only the case of the address finds the user's own account,
+	// which isn't a conflict.
+	ctx := r.Context()
+	existing, err := h.Queries.GetUserByEmail(ctx, gendb.GetUserByEmailParams{
+		Email:           req.Email,
+		EmailNormalized: h.Normalizer.Normalize(check.Address),
+	})
+	if err == nil && existing.ID != user.ID {
+		util.WriteJSON(w, http.StatusConflict, util.ErrorResponse{Error: "Email already in use"})
+		return
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	otp, err := genOTP()
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	locale := h.emailLocale(user, r)
+	db.MarkWrite(ctx)
+	err = pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+
+		if err := q.DeletePendingEmailChanges(ctx, user.ID); err != nil {
+			return err
+		}
+
+		change, err := q.CreateEmailChange(ctx, gendb.CreateEmailChangeParams{
+			UserID:    user.ID,
+			NewEmail:  req.Email,
+			Otp:       otp,
+			ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(emailChangeTTL), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := h.Mailer.Enqueue(ctx, q, "email_change_code:"+change.ID.String(), change.ExpiresAt.Time, req.Email, email.TemplateEmailChangeCode, locale, email.CodeData{
+			Code:             otp,
+			ExpiresInMinutes: int(emailChangeTTL / time.Minute),
+		}); err != nil {
+			return err
+		}
+
+		// A notice the old address can't receive shouldn't block the change.
+		cancelLink := fmt.Sprintf("%s/auth/email-change/cancel?token=%s", h.APIURL, change.CancelToken.String())
+		err = h.Mailer.Enqueue(ctx, q, "email_change_notice:"+change.ID.String(), time.Time{}, user.Email, email.TemplateEmailChangeNotice, locale, email.EmailChangeNoticeData{
+			NewEmail:   req.Email,
+			CancelLink: cancelLink,
+			RevertDays: int(emailChangeRevertWindow / (24 * time.Hour)),
+		})
+		if errors.Is(err, email.ErrSuppressed) {
+			return nil
+		}
+		return err
+	})
+	if errors.Is(err, email.ErrSuppressed) {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Emails to this address bounced or were reported as spam. Use a different email."})
+		return
+	}
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	audit.Record(ctx, h.Queries, r, audit.ActionEmailChangeRequested, user.ID, user.ID)
+
+	util.WriteJSON(w, http.StatusOK, codeSentResponse{
+		Message:    "Verification code sent",
+		Warnings:   check.Warnings,
+		Suggestion: check.Suggestion,
+	})
+}
+
+// ConfirmEmailChange completes a pending email change once the code sent to
+// the new address is entered. Every other session of the user is revoked.
+// The change is kept, with the old address, until its revert window ends.
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	var req confirmEmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	token, err := h.sessionToken(r)
+	if err != nil {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	// The code is checked by the update that completes the change, so two
+	// requests can't both use it, and a wrong one completes nothing.
+	ctx := r.Context()
+	db.MarkWrite(ctx)
+	err = pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+
+		change, err := q.CompleteEmailChange(ctx, gendb.CompleteEmailChangeParams{
+			OldEmail:           pgtype.Text{String: user.Email, Valid: true},
+			OldEmailNormalized: user.EmailNormalized,
+			RevertUntil:        pgtype.Timestamptz{Time: time.Now().Add(emailChangeRevertWindow), Valid: true},
+			UserID:             user.ID,
+			Otp:                req.OTP,
+			MaxAttempts:        maxEmailChangeAttempts,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errInvalidOTP
+		}
+		if err != nil {
+			return err
+		}
+
+		addr, err := emailcheck.Parse(change.NewEmail)
+		if err != nil {
+			return err
+		}
+		normalized := h.Normalizer.Normalize(addr)
+
+		existing, err := q.GetUserByEmail(ctx, gendb.GetUserByEmailParams{
+			Email:           change.NewEmail,
+			EmailNormalized: normalized,
+		})
+		if err == nil && existing.ID != user.ID {
+			return errEmailTaken
+		}
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		_, err = q.UpdateUserEmail(ctx, gendb.UpdateUserEmailParams{
+			ID:              user.ID,
+			Email:           change.NewEmail,
+			EmailNormalized: pgtype.Text{String: normalized, Valid: true},
+		})
+		if isUniqueViolation(err, "users_email_normalized_key") {
+			return errEmailTaken
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.DeletePendingEmailChanges(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteOtherSessions(ctx, gendb.DeleteOtherSessionsParams{
+			UserID: user.ID,
+			Token:  token,
+		}); err != nil {
+			return err
+		}
+
+		audit.Record(ctx, q, r, audit.ActionEmailChanged, user.ID, user.ID)
+		return nil
+	})
+	if errors.Is(err, errInvalidOTP) {
+		h.failEmailChange(w, r, user.ID)
+		return
+	}
+	if errors.Is(err, errEmailTaken) {
+		util.WriteJSON(w, http.StatusConflict, util.ErrorResponse{Error: "Email already in use"})
+		return
+	}
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	h.Sessions.InvalidateUser(ctx, user.ID)
+
+	util.WriteJSON(w, http.StatusOK, successResponse{Message: "Email changed"})
+}
+
+// failEmailChange counts a wrong code against the user's pending email
+// change, dropping the change once it has taken maxEmailChangeAttempts.
+func (h *Handler) failEmailChange(w http.ResponseWriter, r *http.Request, userID pgtype.UUID) {
+	ctx := r.Context()
+	attempts, err := h.Queries.FailEmailChangeAttempt(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "No pending email change"})
+		return
+	}
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	if attempts >= maxEmailChangeAttempts {
+		if err := h.Queries.DeletePendingEmailChanges(ctx, userID); err != nil {
+			log.Print("Failed to drop email change after too many attempts: ", err)
+		}
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Too many wrong codes, request a new one"})
+		return
+	}
+
+	util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Invalid or expired OTP"})
+}
+
+// CancelEmailChangePage serves the page the link sent to the old address
+// opens, asking to cancel the change, or to undo it once confirmed.
+func (h *Handler) CancelEmailChangePage(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("token"))
+	if err != nil {
+		writePage(w, http.StatusBadRequest, invalidLinkPage)
+		return
+	}
+
+	change, err := h.Queries.GetEmailChangeByCancelToken(r.Context(), pgtype.UUID{Bytes: id, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		writePage(w, http.StatusNotFound, expiredLinkPage)
+		return
+	}
+	if err != nil {
+		writePage(w, http.StatusInternalServerError, errorPage)
+		return
+	}
+
+	page := linkPage{
+		Title:   "Cancel email change",
+		Message: "Someone asked to change the email on your account to " + change.NewEmail + ". Cancel the change if it wasn't you.",
+		Action:  "/auth/email-change/cancel",
+		Token:   id.String(),
+		Button:  "Cancel the change",
+	}
+	if change.CompletedAt.Valid {
+		page = linkPage{
+			Title:   "Undo email change",
+			Message: "The email on your account was changed to " + change.NewEmail + ". If it wasn't you, change it back to " + change.OldEmail.String + ". Every session will be signed out.",
+			Action:  "/auth/email-change/cancel",
+			Token:   id.String(),
+			Button:  "Change it back",
+		}
+	}
+
+	writePage(w, http.StatusOK, page)
+}
+
+// CancelEmailChange is posted from CancelEmailChangePage. A pending change
+// is dropped. A confirmed one is undone: the old address is restored, along
+// with any changes made after it, and every session is revoked, since they
+// may belong to whoever made the change.
+func (h *Handler) CancelEmailChange(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.FormValue("token"))
+	if err != nil {
+		writePage(w, http.StatusBadRequest, invalidLinkPage)
+		return
+	}
+	token := pgtype.UUID{Bytes: id, Valid: true}
+
+	ctx := r.Context()
+	var (
+		change   gendb.EmailChange
+		reverted bool
+	)
+	db.MarkWrite(ctx)
+	err = pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+
+		var err error
+		change, err = q.CancelEmailChange(ctx, token)
+		if err == nil {
+			audit.Record(ctx, q, r, audit.ActionEmailChangeCancelled, change.UserID, change.UserID)
+			return nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		if change, err = q.RevertEmailChange(ctx, token); err != nil {
+			return err
+		}
+		reverted = true
+
+		// Changes made after this one were made by the same session, or
+		// by whoever it let in.
+		if err := q.DeleteEmailChangesSince(ctx, gendb.DeleteEmailChangesSinceParams{
+			UserID:    change.UserID,
+			CreatedAt: change.CreatedAt,
+		}); err != nil {
+			return err
+		}
+
+		_, err = q.UpdateUserEmail(ctx, gendb.UpdateUserEmailParams{
+			ID:              change.UserID,
+			Email:           change.OldEmail.String,
+			EmailNormalized: change.OldEmailNormalized,
+		})
+		if isUniqueViolation(err, "users_email_normalized_key") {
+			return errEmailTaken
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.DeleteSessionsByUserID(ctx, change.UserID); err != nil {
+			return err
+		}
+
+		audit.Record(ctx, q, r, audit.ActionEmailChangeReverted, change.UserID, change.UserID)
+		return nil
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		writePage(w, http.StatusNotFound, expiredLinkPage)
+		return
+	}
+	if errors.Is(err, errEmailTaken) {
+		writePage(w, http.StatusConflict, linkPage{
+			Title:   "Email already in use",
+			Message: "Your old email is now used by another account, so the change can't be undone. Contact support.",
+		})
+		return
+	}
+	if err != nil {
+		writePage(w, http.StatusInternalServerError, errorPage)
+		return
+	}
+
+	if !reverted {
+		writePage(w, http.StatusOK, linkPage{
+			Title:   "Email change cancelled",
+			Message: "The email on your account was not changed.",
+		})
+		return
+	}
+
+	h.Sessions.InvalidateUser(ctx, change.UserID)
+
+	writePage(w, http.StatusOK, linkPage{
+		Title:   "Email changed back",
+		Message: "The email on your account is " + change.OldEmail.String + " again, and every session was signed out. Sign in again and review your account.",
+	})
+}
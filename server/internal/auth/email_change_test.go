@@ -0,0 +1,75 @@
+package auth_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/auth"
+	"github.com/trnahnh/katana-id/internal/db/dbtest"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+func TestConfirmEmailChangePostgres(t *testing.T) {
+	pool := dbtest.New(t)
+	queries := gendb.New(pool)
+	h := newHandler(t, auth.PgStore{Queries: queries, Pool: pool})
+	h.Queries, h.Pool = queries, pool
+	ctx := context.Background()
+
+	user, err := queries.CreateUser(ctx, gendb.CreateUserParams{
+		Username:        "ada",
+		Email:           "ada@example.com",
+		EmailNormalized: pgtype.Text{String: "ada@example.com", Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := createSession(t, queries, user.ID)
+	confirm := h.RequireUser(http.HandlerFunc(h.ConfirmEmailChange)).ServeHTTP
+
+	createChange := func(email string) {
+		t.Helper()
+
+		if _, err := queries.CreateEmailChange(ctx, gendb.CreateEmailChangeParams{
+			UserID:    user.ID,
+			NewEmail:  email,
+			Otp:       "123456",
+			ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(time.Minute), Valid: true},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Guessing drops the change before the code can be found.
+	createChange("eve@example.com")
+	for i := range 5 {
+		rec := serve(confirm, http.MethodPost, fmt.Sprintf(`{"otp":"00000%d"}`, i), session)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: status = %d, want %d", i, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	if rec := serve(confirm, http.MethodPost, `{"otp":"123456"}`, session); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "No pending email change") {
+		t.Fatalf("code after guesses: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	createChange("ada@example.org")
+	if rec := serve(confirm, http.MethodPost, `{"otp":"654321"}`, session); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := serve(confirm, http.MethodPost, `{"otp":"123456"}`, session); rec.Code != http.StatusOK {
+		t.Fatalf("confirm: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	user, err = queries.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "ada@example.org" {
+		t.Fatalf("email = %s, want ada@example.org", user.Email)
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/trnahnh/katana-id/internal/emailcheck"
+	"github.com/trnahnh/katana-id/util"
+)
+
+// codeSentResponse acknowledges a code sent by email. Warnings are the
+// checks the address failed without being blocked, and Suggestion is the
+// address the client can offer instead when the domain looks like a typo.
+type codeSentResponse struct {
+	Message    string   `json:"message"`
+	Warnings   []string `json:"warnings,omitempty"`
+	Suggestion string   `json:"suggestion,omitempty"`
+}
+
+type emailBlockedResponse struct {
+	Error      string `json:"error"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+var emailBlockedErrors = map[string]string{
+	emailcheck.CheckDisposable: "Disposable email addresses are not allowed",
+	emailcheck.CheckTypo:       "Email domain looks misspelled",
+	emailcheck.CheckNoMX:       "Email domain can't receive mail",
+}
+
+// checkEmail runs an address a code is about to be sent to through
+// EmailCheck, writing an error response and returning false when the
+// address is invalid or blocked. Without EmailCheck only syntax is checked.
+func (h *Handler) checkEmail(w http.ResponseWriter, r *http.Request, address string) (emailcheck.Result, bool) {
+	checker := h.EmailCheck
+	if checker == nil {
+		checker = &emailcheck.Checker{}
+	}
+
+	result, err := checker.Check(r.Context(), address)
+	if err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid email"})
+		return result, false
+	}
+
+	if result.Blocked != "" {
+		util.WriteJSON(w, http.StatusBadRequest, emailBlockedResponse{
+			Error:      emailBlockedErrors[result.Blocked],
+			Suggestion: result.Suggestion,
+		})
+		return result, false
+	}
+
+	return result, true
+}
@@ -0,0 +1,435 @@
+package auth
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trnahnh/katana-id/internal/audit"
+	"github.com/trnahnh/katana-id/internal/db"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/email"
+	"github.com/trnahnh/katana-id/util"
+)
+
+const (
+	exportFormatJSON = "json"
+	exportFormatZIP  = "zip"
+
+	// Accounts with more audit events than this are exported in the
+	// background and the user is emailed a download link.
+	exportAsyncThreshold = 500
+	exportTTL            = 7 * 24 * time.Hour
+)
+
+type exportDocument struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	User        exportUser         `json:"user"`
+	Providers   []exportProvider   `json:"providers"`
+	Sessions    []exportSession    `json:"sessions"`
+	Logins      []exportLogin      `json:"logins"`
+	Devices     []exportDevice     `json:"user_devices"`
+	AuditEvents []exportAuditEvent `json:"audit_events"`
+}
+
+type exportUser struct {
+	ID              string     `json:"id"`
+	Email           string     `json:"email"`
+	Username        string     `json:"username"`
+	DisplayName     string     `json:"display_name"`
+	Phone           string     `json:"phone"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+	Locale          string     `json:"locale"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type exportProvider struct {
+	ProviderName      string    `json:"provider_name"`
+	ProviderAccountID string    `json:"provider_account_id"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type exportSession struct {
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+}
+
+type exportLogin struct {
+	Method     string     `json:"method"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	Country    string     `json:"country"`
+	NewDevice  bool       `json:"new_device"`
+	NewCountry bool       `json:"new_country"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type exportDevice struct {
+	Name        string    `json:"name"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+type exportAuditEvent struct {
+	Action    string    `json:"action"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportPendingResponse struct {
+	Message  string `json:"message"`
+	ExportID string `json:"export_id"`
+}
+
+// ExportMe returns everything stored about the signed-in user as JSON, or as
+// a ZIP archive with ?format=zip. Large accounts are left pending for
+// ExportWorker, which announces the export by email instead.
+func (h *Handler) ExportMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatJSON
+	}
+	if format != exportFormatJSON && format != exportFormatZIP {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid format"})
+		return
+	}
+
+	ctx := r.Context()
+	count, err := h.Queries.CountAuditEventsByUser(ctx, user.ID)
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	if count <= exportAsyncThreshold {
+		data, err := buildExport(ctx, h.Queries, user, format)
+		if err != nil {
+			util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+			return
+		}
+
+		audit.Record(ctx, h.Queries, r, audit.ActionDataExported, user.ID, user.ID)
+		writeExport(w, format, data)
+		return
+	}
+
+	export, err := h.Queries.CreateDataExport(ctx, gendb.CreateDataExportParams{
+		UserID:    user.ID,
+		Format:    format,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(exportTTL), Valid: true},
+	})
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	audit.Record(ctx, h.Queries, r, audit.ActionDataExported, user.ID, user.ID)
+	util.WriteJSON(w, http.StatusAccepted, exportPendingResponse{
+		Message:  "Export started, we will email you when it is ready",
+		ExportID: export.ID.String(),
+	})
+}
+
+// DownloadExport serves a finished background export.
+func (h *Handler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		util.WriteJSON(w, http.StatusNotFound, util.ErrorResponse{Error: "Export not found"})
+		return
+	}
+
+	export, err := h.Queries.GetDataExport(r.Context(), gendb.GetDataExportParams{
+		ID:     pgtype.UUID{Bytes: id, Valid: true},
+		UserID: user.ID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		util.WriteJSON(w, http.StatusNotFound, util.ErrorResponse{Error: "Export not found"})
+		return
+	}
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	switch export.Status {
+	case "ready":
+		writeExport(w, export.Format, export.Data)
+	case "failed":
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Export failed, please request a new one"})
+	default:
+		util.WriteJSON(w, http.StatusAccepted, exportPendingResponse{
+			Message:  "Export is still being generated",
+			ExportID: export.ID.String(),
+		})
+	}
+}
+
+// ExportWorker builds the exports ExportMe leaves pending and emails the
+// download link. Claimed exports are leased for Lease, so one whose worker
+// died mid-build, such as on a restart, is picked up again once the lease
+// runs out. Exports are marked failed after MaxAttempts.
+type ExportWorker struct {
+	Queries     *gendb.Queries
+	Pool        *pgxpool.Pool
+	Mailer      *email.Mailer
+	APIURL      string
+	Lease       time.Duration
+	MaxAttempts int
+}
+
+// Start polls for pending exports every interval until ctx is done.
+func (w *ExportWorker) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep going while there are exports waiting.
+			for ctx.Err() == nil {
+				if !w.runOne(ctx) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// runOne claims and builds one export, reporting whether there was one.
+func (w *ExportWorker) runOne(ctx context.Context) bool {
+	exports, err := w.Queries.ClaimDataExports(ctx, gendb.ClaimDataExportsParams{
+		LeaseUntil: pgtype.Timestamptz{Time: time.Now().Add(w.Lease), Valid: true},
+		BatchSize:  1,
+	})
+	if err != nil {
+		log.Print("Failed to claim data exports: ", err)
+		return false
+	}
+	if len(exports) == 0 {
+		return false
+	}
+
+	export := exports[0]
+	if err := w.build(ctx, export); err != nil {
+		log.Print("Failed to build data export ", export.ID.String(), ": ", err)
+
+		if int(export.Attempts) >= w.MaxAttempts {
+			if err := w.Queries.FailDataExport(ctx, export.ID); err != nil {
+				log.Print("Failed to mark data export as failed: ", err)
+			}
+		} else if err := w.Queries.RetryDataExport(ctx, gendb.RetryDataExportParams{
+			ID:         export.ID,
+			LeaseUntil: pgtype.Timestamptz{Time: time.Now().Add(time.Minute), Valid: true},
+		}); err != nil {
+			log.Print("Failed to schedule data export retry: ", err)
+		}
+	}
+
+	return true
+}
+
+// build stores the export and queues the email announcing it in one
+// transaction, so a ready export always has its email.
+func (w *ExportWorker) build(ctx context.Context, export gendb.DataExport) error {
+	user, err := w.Queries.GetUserByID(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+
+	data, err := buildExport(ctx, w.Queries, user, export.Format)
+	if err != nil {
+		return err
+	}
+
+	db.MarkWrite(ctx)
+	return pgx.BeginFunc(ctx, w.Pool, func(tx pgx.Tx) error {
+		q := w.Queries.WithTx(tx)
+
+		if err := q.CompleteDataExport(ctx, gendb.CompleteDataExportParams{
+			ID:   export.ID,
+			Data: data,
+		}); err != nil {
+			return err
+		}
+
+		link := fmt.Sprintf("%s/auth/me/export/%s", w.APIURL, export.ID.String())
+		err := w.Mailer.Enqueue(ctx, q, "export_ready:"+export.ID.String(), export.ExpiresAt.Time, user.Email, email.TemplateExportReady, w.Mailer.Templates.Locale(user.Locale.String, ""), email.ExportReadyData{
+			Link:          link,
+			ExpiresInDays: int(exportTTL / (24 * time.Hour)),
+		})
+		// The export is still downloadable from the account when its
+		// email can't be delivered.
+		if errors.Is(err, email.ErrSuppressed) {
+			return nil
+		}
+		return err
+	})
+}
+
+func buildExport(ctx context.Context, queries *gendb.Queries, user gendb.User, format string) ([]byte, error) {
+	providers, err := queries.ListProvidersByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := queries.ListSessionsByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	logins, err := queries.ListAllLoginsByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := queries.ListUserDevicesByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := queries.ListAuditEventsByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := exportDocument{
+		GeneratedAt: time.Now(),
+		User: exportUser{
+			ID:          user.ID.String(),
+			Email:       user.Email,
+			Username:    user.Username,
+			DisplayName: user.DisplayName.String,
+			Phone:       user.Phone.String,
+			Locale:      user.Locale.String,
+			Status:      user.Status,
+			CreatedAt:   user.CreatedAt.Time,
+		},
+		Providers:   make([]exportProvider, 0, len(providers)),
+		Sessions:    make([]exportSession, 0, len(sessions)),
+		Logins:      make([]exportLogin, 0, len(logins)),
+		Devices:     make([]exportDevice, 0, len(devices)),
+		AuditEvents: make([]exportAuditEvent, 0, len(events)),
+	}
+	if user.PhoneVerifiedAt.Valid {
+		doc.User.PhoneVerifiedAt = &user.PhoneVerifiedAt.Time
+	}
+
+	for _, provider := range providers {
+		doc.Providers = append(doc.Providers, exportProvider{
+			ProviderName:      provider.ProviderName,
+			ProviderAccountID: provider.ProviderAccountID,
+			CreatedAt:         provider.CreatedAt.Time,
+		})
+	}
+
+	for _, session := range sessions {
+		doc.Sessions = append(doc.Sessions, exportSession{
+			CreatedAt: session.CreatedAt.Time,
+			ExpiresAt: session.ExpiresAt.Time,
+			UserAgent: session.UserAgent.String,
+			IPAddress: session.IpAddress.String,
+		})
+	}
+
+	for _, login := range logins {
+		entry := exportLogin{
+			Method:     login.Method,
+			Device:     login.DeviceName,
+			UserAgent:  login.UserAgent.String,
+			IPAddress:  login.IpAddress.String,
+			Country:    login.Country.String,
+			NewDevice:  login.NewDevice,
+			NewCountry: login.NewCountry,
+			CreatedAt:  login.CreatedAt.Time,
+		}
+		if login.RevokedAt.Valid {
+			entry.RevokedAt = &login.RevokedAt.Time
+		}
+		doc.Logins = append(doc.Logins, entry)
+	}
+
+	for _, device := range devices {
+		doc.Devices = append(doc.Devices, exportDevice{
+			Name:        device.Name,
+			FirstSeenAt: device.FirstSeenAt.Time,
+			LastSeenAt:  device.LastSeenAt.Time,
+		})
+	}
+
+	for _, event := range events {
+		doc.AuditEvents = append(doc.AuditEvents, exportAuditEvent{
+			Action:    event.Action,
+			IPAddress: event.IpAddress.String,
+			UserAgent: event.UserAgent.String,
+			CreatedAt: event.CreatedAt.Time,
+		})
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if format != exportFormatZIP {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("katanaid-export.json")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeExport(w http.ResponseWriter, format string, data []byte) {
+	if format == exportFormatZIP {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="katanaid-export.zip"`)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="katanaid-export.json"`)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -5,22 +5,36 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"regexp"
-	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/resend/resend-go/v3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trnahnh/katana-id/internal/audit"
 	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/device"
+	"github.com/trnahnh/katana-id/internal/email"
+	"github.com/trnahnh/katana-id/internal/emailcheck"
+	"github.com/trnahnh/katana-id/internal/phone"
+	"github.com/trnahnh/katana-id/internal/sessioncache"
 	"github.com/trnahnh/katana-id/util"
 )
 
-var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+const otpTTL = 5 * time.Minute
 
+// Channels sign-in codes can be sent over.
+const (
+	ChannelEmail    = "email"
+	ChannelSMS      = phone.ChannelSMS
+	ChannelWhatsApp = phone.ChannelWhatsApp
+)
+
+// sendOTPRequest asks for a code by email, or by text message to a phone
+// verified on an account when Phone is set.
 type sendOTPRequest struct {
-	Email string
+	Email   string
+	Phone   string
+	Channel string
 }
 
 type successResponse struct {
@@ -28,68 +42,96 @@ type successResponse struct {
 }
 
 type meResponse struct {
-	Email string `json:"email"`
-	Username string `json:"username"`
+	Email       string `json:"email"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Locale      string `json:"locale"`
+	Phone       string `json:"phone"`
+}
+
+type deleteMeResponse struct {
+	Message    string    `json:"message"`
+	PurgeAfter time.Time `json:"purge_after"`
 }
 
+const (
+	StatusActive          = "active"
+	StatusDisabled        = "disabled"
+	StatusPendingDeletion = "pending_deletion"
+)
+
 type Handler struct {
-	Queries     *gendb.Queries
-	EmailClient *resend.Client
+	// Store backs the sign-in flow and session lookups. Everything else
+	// still goes through Queries directly.
+	Store         TxStore
+	Queries       *gendb.Queries
+	Sessions      *sessioncache.Cache
+	Cookies       util.Cookies
+	Mailer        *email.Mailer
+	EmailCheck    *emailcheck.Checker
+	Normalizer    emailcheck.Normalizer
+	Pool          *pgxpool.Pool
+	DeletionGrace time.Duration
+	APIURL        string
+	// Phone delivers codes by SMS and WhatsApp. Phone sign-in is off when
+	// it is nil.
+	Phone phone.Provider
+	// Locator finds the country sign-ins come from. Without it, only new
+	// devices are alerted about.
+	Locator device.Locator
 }
 
 func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session")
+	user, err := h.sessionUser(r)
 	if err != nil {
 		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
 		return
 	}
 
-	token, err := uuid.Parse(cookie.Value)
-	if err != nil {
+	util.WriteJSON(w, http.StatusOK, toMeResponse(user))
+}
+
+// DeleteMe schedules the signed-in user's account for deletion. The account
+// is purged once DeletionGrace has passed unless the user restores it by
+// signing in again with restore set.
+func (h *Handler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
 		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
 		return
 	}
 
 	ctx := r.Context()
-	session, err := h.Queries.GetSession(ctx, pgtype.UUID{
-		Bytes: token,
-		Valid: true,
-	})
+	user, err := h.Queries.RequestUserDeletion(ctx, user.ID)
 	if err != nil {
-		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
 		return
 	}
 
-	email := session.Email
-	user, err := h.Queries.GetUserByEmail(ctx, email)
-	if err != nil {
-		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+	if err := h.Queries.DeleteSessionsByUserID(ctx, user.ID); err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
 		return
 	}
 
-	util.WriteJSON(w, http.StatusOK, meResponse{
-		Email: email,
-		Username: user.Username, 
+	h.Sessions.InvalidateUser(ctx, user.ID)
+	audit.Record(ctx, h.Queries, r, audit.ActionDeletionRequested, user.ID, user.ID)
+
+	h.Cookies.Clear(w, "session", true)
+
+	util.WriteJSON(w, http.StatusOK, deleteMeResponse{
+		Message:    "Account scheduled for deletion",
+		PurgeAfter: user.DeletionRequestedAt.Time.Add(h.DeletionGrace),
 	})
 }
 
 func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
-	cookie, _ := r.Cookie("session")
-	id, _ := uuid.Parse(cookie.Value)
-	
-	token := pgtype.UUID{
-		Valid: true,
-		Bytes: id,
+	if token, err := h.sessionToken(r); err == nil {
+		ctx := r.Context()
+		h.Store.DeleteSessionByToken(ctx, token)
+		h.Sessions.InvalidateToken(ctx, token)
 	}
-	ctx := r.Context()
-	h.Queries.DeleteSessionByToken(ctx, token)
-	
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-	})
+
+	h.Cookies.Clear(w, "session", true)
 
 	util.WriteJSON(w, http.StatusOK, successResponse{
 		Message: "Logged out",
@@ -103,42 +145,77 @@ func (h *Handler) SendOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !emailRegex.MatchString(req.Email) {
-		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid email"})
+	if req.Phone != "" {
+		h.sendPhoneOTP(w, r, req)
 		return
 	}
 
+	if req.Channel != "" && req.Channel != ChannelEmail {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid channel"})
+		return
+	}
+
+	check, ok := h.checkEmail(w, r, req.Email)
+	if !ok {
+		return
+	}
+	req.Email = check.Address.String()
+	normalized := h.Normalizer.Normalize(check.Address)
+
 	otp, err := genOTP()
 	if err != nil {
 		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
 		return
 	}
 
-  expires := pgtype.Timestamptz{
-    Time: time.Now().Add(5 * time.Minute),
-    Valid: true,
-  }
-
-	if err := h.Queries.CreateOTP(context.Background(), gendb.CreateOTPParams{
-		Email: req.Email,
-		Otp:   otp,
-    ExpiresAt: expires,
-	}); err != nil {
-		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
-    return
+	expires := pgtype.Timestamptz{
+		Time:  time.Now().Add(otpTTL),
+		Valid: true,
 	}
 
-	if err := sendOTP(h.EmailClient, req.Email, otp); err != nil {
+	// The email is written to the outbox in the same transaction as the code,
+	// so a code is never stored without its email, and delivery happens in
+	// the background instead of holding up the request. Codes are stored
+	// under the normalized address, so one sent to John@Example.com can be
+	// redeemed as john@example.com.
+	ctx := r.Context()
+	locale := h.emailLocale(gendb.User{}, r)
+	err = h.Store.InTx(ctx, func(s Store) error {
+		code, err := s.CreateOTP(ctx, gendb.CreateOTPParams{
+			Email:     normalized,
+			Otp:       otp,
+			ExpiresAt: expires,
+		})
+		if err != nil {
+			return err
+		}
+
+		return h.Mailer.Enqueue(ctx, s, "otp:"+code.ID.String(), code.ExpiresAt.Time, req.Email, email.TemplateOTP, locale, email.CodeData{
+			Code:             otp,
+			ExpiresInMinutes: int(otpTTL / time.Minute),
+		})
+	})
+	if errors.Is(err, email.ErrSuppressed) {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Emails to this address bounced or were reported as spam. Use a different email."})
+		return
+	}
+	if err != nil {
 		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
 		return
 	}
 
-	util.WriteJSON(w, http.StatusOK, successResponse{Message: "OTP sent"})
+	util.WriteJSON(w, http.StatusOK, codeSentResponse{
+		Message:    "OTP sent",
+		Warnings:   check.Warnings,
+		Suggestion: check.Suggestion,
+	})
 }
 
 type verifyOTPRequest struct {
-	Email string
-	OTP   string
+	Email   string
+	Phone   string
+	OTP     string
+	Restore bool
 }
 
 func (h *Handler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
@@ -148,69 +225,126 @@ func (h *Handler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !emailRegex.MatchString(req.Email) {
-		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid email"})
-		return
+	var (
+		number string
+		addr   emailcheck.Address
+	)
+	if req.Phone != "" {
+		var err error
+		if number, err = phone.Normalize(req.Phone); err != nil {
+			util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid phone number"})
+			return
+		}
+	} else {
+		// Only syntax is checked here, so a code already sent can always be
+		// redeemed.
+		var err error
+		if addr, err = emailcheck.Parse(req.Email); err != nil {
+			util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid email"})
+			return
+		}
 	}
 
-	ctx := context.Background()
+	ctx := r.Context()
 
-	otpRow, err := h.Queries.GetOTPByEmail(ctx, req.Email)
-	if errors.Is(err, pgx.ErrNoRows) {
+	// Consuming the code, resolving the user and creating the session commit
+	// or roll back together: a failure midway leaves the code redeemable, and
+	// of two concurrent requests with the same code only one gets a row back
+	// from ConsumeOTP.
+	var (
+		session  gendb.Session
+		restored bool
+	)
+	err := h.Store.InTx(ctx, func(q Store) error {
+		var (
+			user   gendb.User
+			method string
+			err    error
+		)
+		if number != "" {
+			user, err = consumePhoneOTP(ctx, q, number, req.OTP)
+			method = LoginMethodPhone
+		} else {
+			user, err = consumeEmailOTP(ctx, q, addr.String(), h.Normalizer.Normalize(addr), req.OTP)
+			method = LoginMethodEmail
+		}
+		if err != nil {
+			return err
+		}
+
+		switch user.Status {
+		case StatusActive:
+		case StatusPendingDeletion:
+			if !req.Restore {
+				return errPendingDeletion
+			}
+
+			if user, err = q.RestoreUser(ctx, user.ID); err != nil {
+				return err
+			}
+			restored = true
+		default:
+			return errInactiveUser
+		}
+
+		session, err = q.CreateSession(ctx, gendb.CreateSessionParams{
+			UserID:    user.ID,
+			ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(7 * 24 * time.Hour), Valid: true},
+			UserAgent: pgtype.Text{String: r.UserAgent(), Valid: r.UserAgent() != ""},
+			IpAddress: pgtype.Text{String: util.ClientIP(r), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		return h.recordLogin(ctx, q, r, user, session, method)
+	})
+	switch {
+	case errors.Is(err, errInvalidOTP):
 		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Invalid or expired OTP"})
 		return
-	}
-	if err != nil {
+	case errors.Is(err, errPendingDeletion):
+		util.WriteJSON(w, http.StatusForbidden, util.ErrorResponse{Error: "Account scheduled for deletion"})
+		return
+	case errors.Is(err, errInactiveUser):
+		util.WriteJSON(w, http.StatusForbidden, util.ErrorResponse{Error: "Account disabled"})
+		return
+	case err != nil:
 		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
 		return
 	}
 
-	if otpRow.Otp != req.OTP {
-		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Invalid or expired OTP"})
-		return
+	if restored {
+		audit.Record(ctx, h.Store, r, audit.ActionAccountRestored, session.UserID, session.UserID)
 	}
 
-	if err := h.Queries.DeleteOTPsByEmail(ctx, req.Email); err != nil {
-		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
-		return
-	}
+	h.Cookies.Set(w, "session", session.Token.String(), 7*24*time.Hour, true)
 
-	_, err = h.Queries.GetUserByEmail(ctx, req.Email)
-	if errors.Is(err, pgx.ErrNoRows) {
-		username := strings.Split(req.Email, "@")[0]
-		_, err = h.Queries.CreateUser(ctx, gendb.CreateUserParams{
-			Username: username,
-			Email:    req.Email,
-		})
-		if err != nil {
-			util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
-			return
+	util.WriteJSON(w, http.StatusOK, successResponse{Message: "OTP verified"})
+}
+
+// consumeEmailOTP redeems a code sent to email and returns the user it signs
+// in, creating one for a new address. The account with exactly email wins
+// over one that only matches normalized.
+func consumeEmailOTP(ctx context.Context, q Store, email string, normalized string, otp string) (gendb.User, error) {
+	if _, err := q.ConsumeOTP(ctx, gendb.ConsumeOTPParams{Email: normalized, Otp: otp}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return gendb.User{}, errInvalidOTP
 		}
-	} else if err != nil {
-		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
-		return
+		return gendb.User{}, err
 	}
 
-	session, err := h.Queries.CreateSession(ctx, gendb.CreateSessionParams{
-		Email:     req.Email,
-		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(7 * 24 * time.Hour), Valid: true},
-	})
-	if err != nil {
-		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
-		return
+	if err := q.DeleteOTPsByEmail(ctx, normalized); err != nil {
+		return gendb.User{}, err
 	}
 
-	token := session.Token.String()
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    token,
-		Path:     "/",
-		MaxAge:   7 * 24 * 60 * 60,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
+	user, err := q.GetUserByEmail(ctx, gendb.GetUserByEmailParams{
+		Email:           email,
+		EmailNormalized: normalized,
 	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return CreateUserForEmail(ctx, q, email, normalized)
+	}
 
-	util.WriteJSON(w, http.StatusOK, successResponse{Message: "OTP verified"})
-}
\ No newline at end of file
+	return user, err
+}
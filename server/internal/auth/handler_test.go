@@ -0,0 +1,375 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/auth"
+	"github.com/trnahnh/katana-id/internal/auth/authtest"
+	"github.com/trnahnh/katana-id/internal/db/dbtest"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/email"
+)
+
+func newHandler(t *testing.T, store auth.TxStore) *auth.Handler {
+	t.Helper()
+
+	templates, err := email.LoadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &auth.Handler{
+		Store:  store,
+		Mailer: &email.Mailer{Templates: templates},
+		APIURL: "https://api.example.com",
+	}
+}
+
+// serve runs handler on a request with body, carrying the session cookie
+// when session is set.
+func serve(handler http.HandlerFunc, method string, body string, session string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "session", Value: session})
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	return rec
+}
+
+func sessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "session" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func createSession(t *testing.T, store auth.SessionStore, userID pgtype.UUID) string {
+	t.Helper()
+
+	session, err := store.CreateSession(context.Background(), gendb.CreateSessionParams{
+		UserID:    userID,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return session.Token.String()
+}
+
+func TestSendOTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		suppressed string
+		wantStatus int
+		wantError  string
+		wantOTPs   int
+	}{
+		{name: "sends code", body: `{"email":"ada@example.com"}`, wantStatus: http.StatusOK, wantOTPs: 1},
+		{name: "invalid json", body: `{`, wantStatus: http.StatusBadRequest, wantError: "Invalid request"},
+		{name: "invalid email", body: `{"email":"ada"}`, wantStatus: http.StatusBadRequest, wantError: "Invalid email"},
+		{name: "invalid channel", body: `{"email":"ada@example.com","channel":"fax"}`, wantStatus: http.StatusBadRequest, wantError: "Invalid channel"},
+		{
+			name:       "suppressed address",
+			body:       `{"email":"ada@example.com"}`,
+			suppressed: "ada@example.com",
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Emails to this address bounced or were reported as spam. Use a different email.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &authtest.Store{}
+			if tt.suppressed != "" {
+				store.Suppress(tt.suppressed)
+			}
+			h := newHandler(t, store)
+
+			rec := serve(h.SendOTP, http.MethodPost, tt.body, "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantError != "" {
+				var res struct{ Error string }
+				json.NewDecoder(rec.Body).Decode(&res)
+				if res.Error != tt.wantError {
+					t.Errorf("error = %q, want %q", res.Error, tt.wantError)
+				}
+			}
+
+			otps := store.OTPs("ada@example.com")
+			if len(otps) != tt.wantOTPs {
+				t.Fatalf("got %d codes, want %d", len(otps), tt.wantOTPs)
+			}
+			emails := store.Emails()
+			if len(emails) != tt.wantOTPs {
+				t.Fatalf("got %d emails, want %d", len(emails), tt.wantOTPs)
+			}
+			if tt.wantOTPs == 0 {
+				return
+			}
+			if !strings.Contains(emails[0].BodyText, otps[0].Otp) {
+				t.Errorf("email doesn't contain the code %s", otps[0].Otp)
+			}
+			if !emails[0].ExpiresAt.Time.Equal(otps[0].ExpiresAt.Time) {
+				t.Errorf("email expires at %v, want the code's expiry %v", emails[0].ExpiresAt, otps[0].ExpiresAt.Time)
+			}
+		})
+	}
+}
+
+func TestVerifyOTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string // status of an existing user, if any
+		code       string
+		expired    bool
+		restore    bool
+		wantStatus int
+		wantUser   string // status of the user afterwards
+	}{
+		{name: "new user", code: "123456", wantStatus: http.StatusOK, wantUser: auth.StatusActive},
+		{name: "existing user", status: auth.StatusActive, code: "123456", wantStatus: http.StatusOK, wantUser: auth.StatusActive},
+		{name: "wrong code", code: "654321", wantStatus: http.StatusUnauthorized},
+		{name: "expired code", code: "123456", expired: true, wantStatus: http.StatusUnauthorized},
+		{name: "disabled user", status: auth.StatusDisabled, code: "123456", wantStatus: http.StatusForbidden, wantUser: auth.StatusDisabled},
+		{name: "pending deletion", status: auth.StatusPendingDeletion, code: "123456", wantStatus: http.StatusForbidden, wantUser: auth.StatusPendingDeletion},
+		{name: "restore", status: auth.StatusPendingDeletion, code: "123456", restore: true, wantStatus: http.StatusOK, wantUser: auth.StatusActive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &authtest.Store{}
+			h := newHandler(t, store)
+
+			if tt.status != "" {
+				store.AddUser(gendb.User{
+					Username:        "ada",
+					Email:           "ada@example.com",
+					EmailNormalized: pgtype.Text{String: "ada@example.com", Valid: true},
+					Status:          tt.status,
+				})
+			}
+
+			expires := time.Now().Add(time.Minute)
+			if tt.expired {
+				expires = time.Now().Add(-time.Minute)
+			}
+			if _, err := store.CreateOTP(context.Background(), gendb.CreateOTPParams{
+				Email:     "ada@example.com",
+				Otp:       "123456",
+				ExpiresAt: pgtype.Timestamptz{Time: expires, Valid: true},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			body, _ := json.Marshal(map[string]any{"email": "ada@example.com", "otp": tt.code, "restore": tt.restore})
+			rec := serve(h.VerifyOTP, http.MethodPost, string(body), "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			// A redeemed code is gone, a failed attempt leaves it.
+			ok := tt.wantStatus == http.StatusOK
+			wantSessions, wantOTPs := 0, 1
+			if ok {
+				wantSessions, wantOTPs = 1, 0
+			}
+			if got := sessionCookie(rec) != nil; got != ok {
+				t.Errorf("session cookie set = %v, want %v", got, ok)
+			}
+			if got := len(store.Sessions()); got != wantSessions {
+				t.Errorf("got %d sessions, want %d", got, wantSessions)
+			}
+			if got := len(store.OTPs("ada@example.com")); got != wantOTPs {
+				t.Errorf("got %d codes left, want %d", got, wantOTPs)
+			}
+
+			user, err := store.GetUserByID(context.Background(), userID(t, store))
+			if tt.wantUser == "" {
+				if err == nil {
+					t.Errorf("user created: %+v", user)
+				}
+				return
+			}
+			if user.Status != tt.wantUser {
+				t.Errorf("user status = %q, want %q", user.Status, tt.wantUser)
+			}
+		})
+	}
+}
+
+// userID finds the ID of ada@example.com, or returns an invalid one.
+func userID(t *testing.T, store auth.UserStore) pgtype.UUID {
+	t.Helper()
+
+	user, _ := store.GetUserByEmail(context.Background(), gendb.GetUserByEmailParams{
+		Email:           "ada@example.com",
+		EmailNormalized: "ada@example.com",
+	})
+	return user.ID
+}
+
+func TestMe(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		session    string // "valid" uses a session of the user
+		wantStatus int
+	}{
+		{name: "signed in", status: auth.StatusActive, session: "valid", wantStatus: http.StatusOK},
+		{name: "no cookie", status: auth.StatusActive, wantStatus: http.StatusUnauthorized},
+		{name: "malformed cookie", status: auth.StatusActive, session: "nope", wantStatus: http.StatusUnauthorized},
+		{name: "unknown session", status: auth.StatusActive, session: "0b7c4e52-2f0a-4a4e-9a4c-2f8f1f1d9a11", wantStatus: http.StatusUnauthorized},
+		{name: "disabled user", status: auth.StatusDisabled, session: "valid", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &authtest.Store{}
+			h := newHandler(t, store)
+
+			user := store.AddUser(gendb.User{Username: "ada", Email: "ada@example.com", Status: tt.status})
+			session := tt.session
+			if session == "valid" {
+				session = createSession(t, store, user.ID)
+			}
+
+			rec := serve(h.Me, http.MethodGet, "", session)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var res struct{ Email, Username string }
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Email != "ada@example.com" || res.Username != "ada" {
+				t.Errorf("got %+v", res)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	tests := []struct {
+		name         string
+		signedIn     bool
+		wantSessions int
+	}{
+		{name: "signed in", signedIn: true, wantSessions: 1},
+		{name: "signed out", wantSessions: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &authtest.Store{}
+			h := newHandler(t, store)
+
+			user := store.AddUser(gendb.User{Username: "ada", Email: "ada@example.com"})
+			session := createSession(t, store, user.ID)
+			createSession(t, store, user.ID)
+			if !tt.signedIn {
+				session = ""
+			}
+
+			rec := serve(h.Logout, http.MethodPost, "", session)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if cookie := sessionCookie(rec); cookie == nil || cookie.MaxAge >= 0 {
+				t.Errorf("session cookie not cleared: %+v", cookie)
+			}
+			if got := len(store.Sessions()); got != tt.wantSessions {
+				t.Errorf("got %d sessions, want %d", got, tt.wantSessions)
+			}
+		})
+	}
+}
+
+// TestSignInPostgres runs the whole sign-in flow against Postgres: a code
+// is sent, redeemed for a session, used, and signed out.
+func TestSignInPostgres(t *testing.T) {
+	pool := dbtest.New(t)
+	queries := gendb.New(pool)
+	h := newHandler(t, auth.PgStore{Queries: queries, Pool: pool})
+	h.Queries, h.Pool = queries, pool
+	ctx := context.Background()
+
+	if rec := serve(h.SendOTP, http.MethodPost, `{"email":"ada@example.com"}`, ""); rec.Code != http.StatusOK {
+		t.Fatalf("send: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var code string
+	if err := pool.QueryRow(ctx, "SELECT otp FROM otps WHERE email = $1", "ada@example.com").Scan(&code); err != nil {
+		t.Fatal(err)
+	}
+	var outboxed int
+	if err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM email_outbox WHERE recipient = $1", "ada@example.com").Scan(&outboxed); err != nil {
+		t.Fatal(err)
+	}
+	if outboxed != 1 {
+		t.Fatalf("got %d outbox emails, want 1", outboxed)
+	}
+
+	rec := serve(h.VerifyOTP, http.MethodPost, `{"email":"ada@example.com","otp":"`+code+`"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify: status = %d: %s", rec.Code, rec.Body)
+	}
+	cookie := sessionCookie(rec)
+	if cookie == nil {
+		t.Fatal("no session cookie")
+	}
+
+	if rec := serve(h.VerifyOTP, http.MethodPost, `{"email":"ada@example.com","otp":"`+code+`"}`, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("second verify: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	if rec := serve(h.Me, http.MethodGet, "", cookie.Value); rec.Code != http.StatusOK {
+		t.Fatalf("me: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(h.RequireUser(http.HandlerFunc(h.ExportMe)).ServeHTTP, http.MethodGet, "", cookie.Value)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: status = %d: %s", rec.Code, rec.Body)
+	}
+	var export struct {
+		Logins  []struct{ Method string } `json:"logins"`
+		Devices []struct{ Name string }   `json:"user_devices"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&export); err != nil {
+		t.Fatal(err)
+	}
+	if len(export.Logins) != 1 || export.Logins[0].Method != auth.LoginMethodEmail || len(export.Devices) != 1 {
+		t.Fatalf("exported %d logins and %d devices, want 1 of each", len(export.Logins), len(export.Devices))
+	}
+
+	if rec := serve(h.Logout, http.MethodPost, "", cookie.Value); rec.Code != http.StatusOK {
+		t.Fatalf("logout: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := serve(h.Me, http.MethodGet, "", cookie.Value); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("me after logout: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/audit"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/device"
+	"github.com/trnahnh/katana-id/internal/email"
+	"github.com/trnahnh/katana-id/util"
+)
+
+// Ways a user can sign in, as recorded in their login history.
+const (
+	LoginMethodEmail = "email"
+	LoginMethodPhone = "phone"
+)
+
+type loginResponse struct {
+	ID         string     `json:"id"`
+	Method     string     `json:"method"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	Country    string     `json:"country"`
+	NewDevice  bool       `json:"new_device"`
+	NewCountry bool       `json:"new_country"`
+	Current    bool       `json:"current"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// recordLogin adds session to user's login history and remembers the device
+// it came from. When the user has signed in before and this sign-in is from
+// a device or country they haven't used, they're emailed a link that signs
+// the session out. A user's first sign-in never alerts, so neither do
+// accounts that predate the history.
+func (h *Handler) recordLogin(ctx context.Context, q Store, r *http.Request, user gendb.User, session gendb.Session, method string) error {
+	ip := util.ClientIP(r)
+	dev := device.Identify(r.UserAgent(), ip)
+
+	var country string
+	if h.Locator != nil {
+		country = h.Locator.Country(r)
+	}
+
+	known, err := q.HasLogins(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.TouchUserDevice(ctx, gendb.TouchUserDeviceParams{
+		Name:        dev.Name,
+		UserID:      user.ID,
+		Fingerprint: dev.Fingerprint,
+	})
+	newDevice := errors.Is(err, pgx.ErrNoRows)
+	if err != nil && !newDevice {
+		return err
+	}
+	if newDevice {
+		if _, err := q.CreateUserDevice(ctx, gendb.CreateUserDeviceParams{
+			UserID:      user.ID,
+			Fingerprint: dev.Fingerprint,
+			Name:        dev.Name,
+		}); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+	}
+
+	// A country is only new once the user has signed in from a known one,
+	// so turning on the Locator doesn't alert everyone.
+	var newCountry bool
+	if country != "" {
+		if newCountry, err = q.IsNewLoginCountry(ctx, gendb.IsNewLoginCountryParams{
+			UserID:  user.ID,
+			Country: country,
+		}); err != nil {
+			return err
+		}
+	}
+
+	login, err := q.CreateLogin(ctx, gendb.CreateLoginParams{
+		UserID:       user.ID,
+		SessionToken: session.Token,
+		Method:       method,
+		Fingerprint:  dev.Fingerprint,
+		DeviceName:   dev.Name,
+		UserAgent:    session.UserAgent,
+		IpAddress:    session.IpAddress,
+		Country:      pgtype.Text{String: country, Valid: country != ""},
+		NewDevice:    newDevice,
+		NewCountry:   newCountry,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !known || (!newDevice && !newCountry) {
+		return nil
+	}
+
+	revokeLink := fmt.Sprintf("%s/auth/logins/revoke?token=%s", h.APIURL, login.RevokeToken.String())
+	err = h.Mailer.Enqueue(ctx, q, "new_device:"+login.ID.String(), time.Time{}, user.Email, email.TemplateNewDevice, h.emailLocale(user, r), email.NewDeviceData{
+		Device:     dev.Name,
+		UserAgent:  r.UserAgent(),
+		IPAddress:  ip,
+		Country:    country,
+		Time:       login.CreatedAt.Time,
+		RevokeLink: revokeLink,
+	})
+	// An address that bounces can't be alerted, but that mustn't stop the
+	// user from signing in.
+	if errors.Is(err, email.ErrSuppressed) {
+		return nil
+	}
+
+	return err
+}
+
+// ListLogins returns the signed-in user's login history, newest first.
+func (h *Handler) ListLogins(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	limit := queryInt(r, "limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := queryInt(r, "offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	logins, err := h.Store.ListLoginsByUserID(r.Context(), gendb.ListLoginsByUserIDParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	current, _ := h.sessionToken(r)
+
+	res := make([]loginResponse, 0, len(logins))
+	for _, login := range logins {
+		entry := loginResponse{
+			ID:         login.ID.String(),
+			Method:     login.Method,
+			Device:     login.DeviceName,
+			UserAgent:  login.UserAgent.String,
+			IPAddress:  login.IpAddress.String,
+			Country:    login.Country.String,
+			NewDevice:  login.NewDevice,
+			NewCountry: login.NewCountry,
+			Current:    login.SessionToken.Valid && login.SessionToken == current,
+			CreatedAt:  login.CreatedAt.Time,
+		}
+		if login.RevokedAt.Valid {
+			entry.RevokedAt = &login.RevokedAt.Time
+		}
+		res = append(res, entry)
+	}
+
+	util.WriteJSON(w, http.StatusOK, res)
+}
+
+// RevokeLoginPage serves the page the link in the new device alert opens,
+// asking to sign out the session of that sign-in.
+func (h *Handler) RevokeLoginPage(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("token"))
+	if err != nil {
+		writePage(w, http.StatusBadRequest, invalidLinkPage)
+		return
+	}
+
+	login, err := h.Store.GetLoginByRevokeToken(r.Context(), pgtype.UUID{Bytes: id, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		writePage(w, http.StatusNotFound, expiredLinkPage)
+		return
+	}
+	if err != nil {
+		writePage(w, http.StatusInternalServerError, errorPage)
+		return
+	}
+
+	writePage(w, http.StatusOK, linkPage{
+		Title:   "Sign out new device",
+		Message: "Someone signed in to your account from " + login.DeviceName + " at " + login.CreatedAt.Time.UTC().Format("15:04 MST on 2 January 2006") + ". Sign the device out if it wasn't you.",
+		Action:  "/auth/logins/revoke",
+		Token:   id.String(),
+		Button:  "Sign it out",
+	})
+}
+
+// RevokeLogin is posted from RevokeLoginPage. It signs out the session of
+// the sign-in and forgets the device, so signing in from it alerts again.
+func (h *Handler) RevokeLogin(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.FormValue("token"))
+	if err != nil {
+		writePage(w, http.StatusBadRequest, invalidLinkPage)
+		return
+	}
+
+	ctx := r.Context()
+	var login gendb.Login
+	err = h.Store.InTx(ctx, func(q Store) error {
+		var err error
+		if login, err = q.RevokeLogin(ctx, pgtype.UUID{Bytes: id, Valid: true}); err != nil {
+			return err
+		}
+
+		if login.SessionToken.Valid {
+			if err := q.DeleteSessionByToken(ctx, login.SessionToken); err != nil {
+				return err
+			}
+		}
+
+		return q.DeleteUserDevice(ctx, gendb.DeleteUserDeviceParams{
+			UserID:      login.UserID,
+			Fingerprint: login.Fingerprint,
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		writePage(w, http.StatusNotFound, expiredLinkPage)
+		return
+	}
+	if err != nil {
+		writePage(w, http.StatusInternalServerError, errorPage)
+		return
+	}
+
+	if login.SessionToken.Valid {
+		h.Sessions.InvalidateToken(ctx, login.SessionToken)
+	}
+	audit.Record(ctx, h.Store, r, audit.ActionLoginRevoked, login.UserID, login.UserID)
+
+	writePage(w, http.StatusOK, linkPage{
+		Title:   "Device signed out",
+		Message: "The device was signed out. Signing in from it again needs a new code.",
+	})
+}
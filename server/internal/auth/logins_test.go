@@ -0,0 +1,88 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/trnahnh/katana-id/internal/auth/authtest"
+)
+
+func TestRevokeLogin(t *testing.T) {
+	store := &authtest.Store{}
+	h := newHandler(t, store)
+	createOTP(t, store, "ada@example.com", "123456")
+
+	rec := serve(h.VerifyOTP, http.MethodPost, `{"email":"ada@example.com","otp":"123456"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify: status = %d: %s", rec.Code, rec.Body)
+	}
+	session := sessionCookie(rec).Value
+	token := store.Logins()[0].RevokeToken.String()
+
+	// Opening the link, as mail scanners do, only shows the page.
+	req := httptest.NewRequest(http.MethodGet, "/auth/logins/revoke?token="+token, nil)
+	rec = httptest.NewRecorder()
+	h.RevokeLoginPage(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `action="/auth/logins/revoke"`) {
+		t.Fatalf("page: status = %d: %s", rec.Code, rec.Body)
+	}
+	if store.Logins()[0].RevokedAt.Valid || len(store.Sessions()) != 1 || len(store.Devices()) != 1 {
+		t.Fatal("opening the link revoked the sign-in")
+	}
+
+	if rec := postForm(h.RevokeLogin, token); rec.Code != http.StatusOK {
+		t.Fatalf("revoke: status = %d: %s", rec.Code, rec.Body)
+	}
+	if !store.Logins()[0].RevokedAt.Valid {
+		t.Fatal("login not marked revoked")
+	}
+	if got := len(store.Sessions()); got != 0 {
+		t.Fatalf("got %d sessions, want 0", got)
+	}
+	if got := len(store.Devices()); got != 0 {
+		t.Fatalf("got %d devices, want 0", got)
+	}
+	if rec := serve(h.Me, http.MethodGet, "", session); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("me after revoke: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "already revoked", token: token, wantStatus: http.StatusNotFound},
+		{name: "unknown token", token: "0b7c4e52-2f0a-4a4e-9a4c-2f8f1f1d9a11", wantStatus: http.StatusNotFound},
+		{name: "malformed token", token: "nope", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/logins/revoke?token="+tt.token, nil)
+			rec := httptest.NewRecorder()
+			h.RevokeLoginPage(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("page: status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if rec := postForm(h.RevokeLogin, tt.token); rec.Code != tt.wantStatus {
+				t.Errorf("revoke: status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// postForm posts token the way the form on a link page does.
+func postForm(handler http.HandlerFunc, token string) *httptest.ResponseRecorder {
+	form := url.Values{"token": {token}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	return rec
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/util"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// RequireUser resolves the session cookie into an active user and stores it
+// in the request context. Requests without a valid session are rejected.
+func (h *Handler) RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := h.sessionUser(r)
+		if err != nil {
+			util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequirePermission only lets the request through when the user stored by
+// RequireUser holds the given permission through one of their roles.
+func (h *Handler) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+				return
+			}
+
+			allowed, err := h.Queries.UserHasPermission(r.Context(), gendb.UserHasPermissionParams{
+				UserID: user.ID,
+				Name:   permission,
+			})
+			if err != nil {
+				util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+				return
+			}
+			if !allowed {
+				util.WriteJSON(w, http.StatusForbidden, util.ErrorResponse{Error: "Forbidden"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UserFromContext returns the user stored by RequireUser.
+func UserFromContext(ctx context.Context) (gendb.User, bool) {
+	user, ok := ctx.Value(userContextKey).(gendb.User)
+	return user, ok
+}
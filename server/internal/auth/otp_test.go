@@ -0,0 +1,130 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/auth"
+	"github.com/trnahnh/katana-id/internal/auth/authtest"
+	"github.com/trnahnh/katana-id/internal/db/dbtest"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+const concurrentVerifies = 20
+
+func TestVerifyOTPRedeemsCodeOnce(t *testing.T) {
+	store := &authtest.Store{}
+	h := &auth.Handler{Store: store}
+	createOTP(t, store, "ada@example.com", "123456")
+
+	if got := verifyConcurrently(h, "ada@example.com", "123456"); got != 1 {
+		t.Fatalf("%d of %d concurrent verifies succeeded, want 1", got, concurrentVerifies)
+	}
+	if got := len(store.Sessions()); got != 1 {
+		t.Fatalf("got %d sessions, want 1", got)
+	}
+	if got := len(store.OTPs("ada@example.com")); got != 0 {
+		t.Fatalf("got %d codes left, want 0", got)
+	}
+}
+
+func TestConsumeOTPConcurrentlyPostgres(t *testing.T) {
+	pool := dbtest.New(t)
+	queries := gendb.New(pool)
+	createOTP(t, queries, "ada@example.com", "123456")
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		consumed int
+	)
+	for range concurrentVerifies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := queries.ConsumeOTP(context.Background(), gendb.ConsumeOTPParams{Email: "ada@example.com", Otp: "123456"})
+			if err == nil {
+				mu.Lock()
+				consumed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if consumed != 1 {
+		t.Fatalf("code consumed %d times, want 1", consumed)
+	}
+}
+
+func TestVerifyOTPRedeemsCodeOncePostgres(t *testing.T) {
+	pool := dbtest.New(t)
+	queries := gendb.New(pool)
+	h := &auth.Handler{Store: auth.PgStore{Queries: queries, Pool: pool}, Queries: queries, Pool: pool}
+	createOTP(t, queries, "ada@example.com", "123456")
+
+	if got := verifyConcurrently(h, "ada@example.com", "123456"); got != 1 {
+		t.Fatalf("%d of %d concurrent verifies succeeded, want 1", got, concurrentVerifies)
+	}
+
+	var sessions, users int
+	if err := pool.QueryRow(context.Background(), "SELECT (SELECT COUNT(*) FROM sessions), (SELECT COUNT(*) FROM users)").Scan(&sessions, &users); err != nil {
+		t.Fatal(err)
+	}
+	if sessions != 1 || users != 1 {
+		t.Fatalf("got %d sessions and %d users, want 1 of each", sessions, users)
+	}
+}
+
+func createOTP(t *testing.T, store auth.OTPStore, email string, code string) {
+	t.Helper()
+
+	if _, err := store.CreateOTP(context.Background(), gendb.CreateOTPParams{
+		Email:     email,
+		Otp:       code,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(time.Minute), Valid: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verifyConcurrently posts the same code to VerifyOTP from
+// concurrentVerifies goroutines at once and returns how many succeeded.
+func verifyConcurrently(h *auth.Handler, email string, code string) int {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		verified int
+		start    = make(chan struct{})
+	)
+	for range concurrentVerifies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			body := `{"email":"` + email + `","otp":"` + code + `"}`
+			req := httptest.NewRequest(http.MethodPost, "/auth/verify-otp", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			<-start
+			h.VerifyOTP(rec, req)
+
+			if rec.Code == http.StatusOK {
+				mu.Lock()
+				verified++
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	return verified
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// linkPage is the page served for links sent by email that change account
+// state. Mail scanners fetch every link in a message as it arrives, so
+// opening the link only shows the page, and the change happens when its
+// form is posted.
+type linkPage struct {
+	Title   string
+	Message string
+	// Action is where the form posts Token. Without it the page has no
+	// form, as for the result of posting it.
+	Action string
+	Token  string
+	Button string
+}
+
+var linkPageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} - KatanaID</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{- if .Action}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">{{.Button}}</button>
+</form>
+{{- end}}
+</body>
+</html>
+`))
+
+func writePage(w http.ResponseWriter, status int, page linkPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	if err := linkPageTemplate.Execute(w, page); err != nil {
+		log.Print("Failed to render page: ", err)
+	}
+}
+
+var (
+	invalidLinkPage = linkPage{
+		Title:   "Invalid link",
+		Message: "This link is invalid. Check that you copied all of it.",
+	}
+	expiredLinkPage = linkPage{
+		Title:   "Link expired",
+		Message: "This link has expired or was already used.",
+	}
+	errorPage = linkPage{
+		Title:   "Something went wrong",
+		Message: "Something went wrong. Please try again.",
+	}
+)
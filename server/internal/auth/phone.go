@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/audit"
+	"github.com/trnahnh/katana-id/internal/db"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/phone"
+	"github.com/trnahnh/katana-id/util"
+)
+
+const phoneOTPMessage = "%s is your KatanaID verification code. It expires in %d minutes."
+
+var errPhoneTaken = errors.New("phone already in use")
+
+type phoneRequest struct {
+	Phone   string
+	Channel string
+}
+
+type confirmPhoneRequest struct {
+	Phone string
+	OTP   string
+}
+
+// sendPhoneOTP texts a sign-in code to a phone verified on an account.
+// Numbers that aren't on any account get the same response without a
+// message, so the endpoint can't be used to look up accounts or to text
+// arbitrary numbers.
+func (h *Handler) sendPhoneOTP(w http.ResponseWriter, r *http.Request, req sendOTPRequest) {
+	number, channel, ok := h.parsePhone(w, req.Phone, req.Channel)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	_, err := h.Store.GetUserByPhone(ctx, number)
+	if errors.Is(err, pgx.ErrNoRows) {
+		util.WriteJSON(w, http.StatusOK, successResponse{Message: "OTP sent"})
+		return
+	}
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	if err := h.textOTP(ctx, number, channel, pgtype.UUID{}); err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	util.WriteJSON(w, http.StatusOK, successResponse{Message: "OTP sent"})
+}
+
+// RequestPhoneVerification texts a code to a phone the signed-in user wants
+// to add to their account. Once confirmed, they can sign in with it.
+func (h *Handler) RequestPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	var req phoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	number, channel, ok := h.parsePhone(w, req.Phone, req.Channel)
+	if !ok {
+		return
+	}
+
+	if user.Phone.Valid && user.Phone.String == number {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Phone unchanged"})
+		return
+	}
+
+	ctx := r.Context()
+	_, err := h.Store.GetUserByPhone(ctx, number)
+	if err == nil {
+		util.WriteJSON(w, http.StatusConflict, util.ErrorResponse{Error: "Phone number already in use"})
+		return
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	if err := h.textOTP(ctx, number, channel, user.ID); err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	audit.Record(ctx, h.Queries, r, audit.ActionPhoneVerificationRequested, user.ID, user.ID)
+
+	util.WriteJSON(w, http.StatusOK, successResponse{Message: "Verification code sent"})
+}
+
+// ConfirmPhone adds a phone to the signed-in user's account once the code
+// texted to it is entered, replacing any phone they had.
+func (h *Handler) ConfirmPhone(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	var req confirmPhoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	number, err := phone.Normalize(req.Phone)
+	if err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid phone number"})
+		return
+	}
+
+	ctx := r.Context()
+	db.MarkWrite(ctx)
+	err = pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+
+		if _, err := q.ConsumePhoneOTP(ctx, gendb.ConsumePhoneOTPParams{
+			Phone:  number,
+			UserID: user.ID,
+			Otp:    req.OTP,
+		}); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errInvalidOTP
+			}
+			return err
+		}
+
+		if err := q.DeletePhoneOTPs(ctx, number); err != nil {
+			return err
+		}
+
+		user, err = q.UpdateUserPhone(ctx, gendb.UpdateUserPhoneParams{
+			ID:    user.ID,
+			Phone: pgtype.Text{String: number, Valid: true},
+		})
+		if isUniqueViolation(err, "users_phone_key") {
+			return errPhoneTaken
+		}
+		if err != nil {
+			return err
+		}
+
+		audit.Record(ctx, q, r, audit.ActionPhoneVerified, user.ID, user.ID)
+		return nil
+	})
+	switch {
+	case errors.Is(err, errInvalidOTP):
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Invalid or expired OTP"})
+		return
+	case errors.Is(err, errPhoneTaken):
+		util.WriteJSON(w, http.StatusConflict, util.ErrorResponse{Error: "Phone number already in use"})
+		return
+	case err != nil:
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	h.Sessions.InvalidateUser(ctx, user.ID)
+
+	util.WriteJSON(w, http.StatusOK, toMeResponse(user))
+}
+
+// RemovePhone takes the phone off the signed-in user's account, so it can
+// no longer be used to sign in.
+func (h *Handler) RemovePhone(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	if !user.Phone.Valid {
+		util.WriteJSON(w, http.StatusNotFound, util.ErrorResponse{Error: "No phone on account"})
+		return
+	}
+
+	ctx := r.Context()
+	user, err := h.Queries.ClearUserPhone(ctx, user.ID)
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	h.Sessions.InvalidateUser(ctx, user.ID)
+	audit.Record(ctx, h.Queries, r, audit.ActionPhoneRemoved, user.ID, user.ID)
+
+	util.WriteJSON(w, http.StatusOK, toMeResponse(user))
+}
+
+// parsePhone validates a phone number and delivery channel, writing an
+// error response and returning false when either can't be used.
+func (h *Handler) parsePhone(w http.ResponseWriter, number string, channel string) (string, string, bool) {
+	if h.Phone == nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Phone sign-in is not available"})
+		return "", "", false
+	}
+
+	if channel == "" {
+		channel = ChannelSMS
+	}
+	if channel != ChannelSMS && channel != ChannelWhatsApp {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid channel"})
+		return "", "", false
+	}
+	if !h.Phone.Supports(channel) {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Channel not available"})
+		return "", "", false
+	}
+
+	number, err := phone.Normalize(number)
+	if err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid phone number"})
+		return "", "", false
+	}
+
+	return number, channel, true
+}
+
+// textOTP stores a code for number and texts it over channel. userID is set
+// for codes verifying a phone for that user, and unset for sign-in codes.
+func (h *Handler) textOTP(ctx context.Context, number string, channel string, userID pgtype.UUID) error {
+	otp, err := genOTP()
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.Store.CreatePhoneOTP(ctx, gendb.CreatePhoneOTPParams{
+		Phone:     number,
+		Otp:       otp,
+		UserID:    userID,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(otpTTL), Valid: true},
+	}); err != nil {
+		return err
+	}
+
+	if err := h.Phone.Send(ctx, channel, number, fmt.Sprintf(phoneOTPMessage, otp, int(otpTTL/time.Minute))); err != nil {
+		log.Print("Failed to send ", channel, " code: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// consumePhoneOTP redeems a sign-in code texted to number and returns the
+// user the phone is verified on.
+func consumePhoneOTP(ctx context.Context, q Store, number string, otp string) (gendb.User, error) {
+	if _, err := q.ConsumePhoneOTP(ctx, gendb.ConsumePhoneOTPParams{Phone: number, Otp: otp}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return gendb.User{}, errInvalidOTP
+		}
+		return gendb.User{}, err
+	}
+
+	if err := q.DeletePhoneOTPs(ctx, number); err != nil {
+		return gendb.User{}, err
+	}
+
+	// The phone may have been removed from the account since the code was
+	// sent.
+	user, err := q.GetUserByPhone(ctx, number)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return gendb.User{}, errInvalidOTP
+	}
+
+	return user, err
+}
@@ -0,0 +1,205 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/auth"
+	"github.com/trnahnh/katana-id/internal/auth/authtest"
+	"github.com/trnahnh/katana-id/internal/db/dbtest"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/phone"
+)
+
+const adaPhone = "+14155552671"
+
+func TestSendPhoneOTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		disabled    bool // phone sign-in turned off
+		wantStatus  int
+		wantError   string
+		wantChannel string // channel of the message sent, if any
+	}{
+		{name: "sms", body: `{"phone":"+1 (415) 555-2671"}`, wantStatus: http.StatusOK, wantChannel: phone.ChannelSMS},
+		{name: "whatsapp", body: `{"phone":"+14155552671","channel":"whatsapp"}`, wantStatus: http.StatusOK, wantChannel: phone.ChannelWhatsApp},
+		{name: "unknown number", body: `{"phone":"+14155550000"}`, wantStatus: http.StatusOK},
+		{name: "invalid number", body: `{"phone":"4155552671"}`, wantStatus: http.StatusBadRequest, wantError: "Invalid phone number"},
+		{name: "invalid channel", body: `{"phone":"+14155552671","channel":"fax"}`, wantStatus: http.StatusBadRequest, wantError: "Invalid channel"},
+		{name: "phone sign-in off", body: `{"phone":"+14155552671"}`, disabled: true, wantStatus: http.StatusBadRequest, wantError: "Phone sign-in is not available"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &authtest.Store{}
+			store.AddUser(gendb.User{
+				Email:  "ada@example.com",
+				Phone:  pgtype.Text{String: adaPhone, Valid: true},
+				Status: auth.StatusActive,
+			})
+			fake := &phone.Fake{}
+			h := newHandler(t, store)
+			if !tt.disabled {
+				h.Phone = fake
+			}
+
+			rec := serve(h.SendOTP, http.MethodPost, tt.body, "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantError != "" {
+				var res struct{ Error string }
+				json.NewDecoder(rec.Body).Decode(&res)
+				if res.Error != tt.wantError {
+					t.Errorf("error = %q, want %q", res.Error, tt.wantError)
+				}
+			}
+
+			messages := fake.Messages()
+			if tt.wantChannel == "" {
+				if len(messages) != 0 {
+					t.Fatalf("got %d messages, want none", len(messages))
+				}
+				return
+			}
+			if len(messages) != 1 {
+				t.Fatalf("got %d messages, want 1", len(messages))
+			}
+			if messages[0].Channel != tt.wantChannel || messages[0].To != adaPhone {
+				t.Errorf("sent %s to %s, want %s to %s", messages[0].Channel, messages[0].To, tt.wantChannel, adaPhone)
+			}
+			otps := store.PhoneOTPs(adaPhone)
+			if len(otps) != 1 || !strings.Contains(messages[0].Body, otps[0].Otp) {
+				t.Errorf("message %q doesn't contain the stored code", messages[0].Body)
+			}
+		})
+	}
+}
+
+func TestPhoneSignIn(t *testing.T) {
+	store := &authtest.Store{}
+	store.AddUser(gendb.User{
+		Email:  "ada@example.com",
+		Phone:  pgtype.Text{String: adaPhone, Valid: true},
+		Status: auth.StatusActive,
+	})
+	fake := &phone.Fake{}
+	h := newHandler(t, store)
+	h.Phone = fake
+
+	if rec := serve(h.SendOTP, http.MethodPost, `{"phone":"`+adaPhone+`"}`, ""); rec.Code != http.StatusOK {
+		t.Fatalf("send: status = %d: %s", rec.Code, rec.Body)
+	}
+	code := textedCode(t, fake)
+
+	if rec := serve(h.VerifyOTP, http.MethodPost, `{"phone":"`+adaPhone+`","otp":"000000"}`, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec := serve(h.VerifyOTP, http.MethodPost, `{"phone":"`+adaPhone+`","otp":"`+code+`"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify: status = %d: %s", rec.Code, rec.Body)
+	}
+	if sessionCookie(rec) == nil {
+		t.Fatal("no session cookie")
+	}
+
+	logins := store.Logins()
+	if len(logins) != 1 || logins[0].Method != auth.LoginMethodPhone {
+		t.Fatalf("got logins %+v, want one phone login", logins)
+	}
+	if got := len(store.PhoneOTPs(adaPhone)); got != 0 {
+		t.Fatalf("got %d codes left, want 0", got)
+	}
+
+	if rec := serve(h.VerifyOTP, http.MethodPost, `{"phone":"`+adaPhone+`","otp":"`+code+`"}`, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("second verify: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestPhoneVerificationPostgres(t *testing.T) {
+	pool := dbtest.New(t)
+	queries := gendb.New(pool)
+	fake := &phone.Fake{}
+	h := newHandler(t, auth.PgStore{Queries: queries, Pool: pool})
+	h.Queries, h.Pool, h.Phone = queries, pool, fake
+	ctx := context.Background()
+
+	user, err := queries.CreateUser(ctx, gendb.CreateUserParams{
+		Username:        "ada",
+		Email:           "ada@example.com",
+		EmailNormalized: pgtype.Text{String: "ada@example.com", Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queries.UpdateUserLocale(ctx, gendb.UpdateUserLocaleParams{
+		ID:     user.ID,
+		Locale: pgtype.Text{String: "vi", Valid: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	session := createSession(t, queries, user.ID)
+
+	rec := serve(h.RequireUser(http.HandlerFunc(h.RequestPhoneVerification)).ServeHTTP, http.MethodPost, `{"phone":"`+adaPhone+`"}`, session)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("request: status = %d: %s", rec.Code, rec.Body)
+	}
+	code := textedCode(t, fake)
+
+	// A code sent to verify a phone can't be used to sign in with it.
+	if rec := serve(h.VerifyOTP, http.MethodPost, `{"phone":"`+adaPhone+`","otp":"`+code+`"}`, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("sign in with verification code: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = serve(h.RequireUser(http.HandlerFunc(h.ConfirmPhone)).ServeHTTP, http.MethodPost, `{"phone":"`+adaPhone+`","otp":"`+code+`"}`, session)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(h.RequireUser(http.HandlerFunc(h.ExportMe)).ServeHTTP, http.MethodGet, "", session)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: status = %d: %s", rec.Code, rec.Body)
+	}
+	var export struct {
+		User struct {
+			Phone           string     `json:"phone"`
+			PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+			Locale          string     `json:"locale"`
+		} `json:"user"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&export); err != nil {
+		t.Fatal(err)
+	}
+	if export.User.Phone != adaPhone || export.User.PhoneVerifiedAt == nil || export.User.Locale != "vi" {
+		t.Fatalf("exported phone %q verified at %v, locale %q", export.User.Phone, export.User.PhoneVerifiedAt, export.User.Locale)
+	}
+
+	if rec := serve(h.SendOTP, http.MethodPost, `{"phone":"`+adaPhone+`"}`, ""); rec.Code != http.StatusOK {
+		t.Fatalf("send: status = %d: %s", rec.Code, rec.Body)
+	}
+	code = textedCode(t, fake)
+
+	if rec := serve(h.VerifyOTP, http.MethodPost, `{"phone":"`+adaPhone+`","otp":"`+code+`"}`, ""); rec.Code != http.StatusOK {
+		t.Fatalf("sign in: status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+// textedCode returns the code in the last message sent through fake.
+func textedCode(t *testing.T, fake *phone.Fake) string {
+	t.Helper()
+
+	messages := fake.Messages()
+	if len(messages) == 0 {
+		t.Fatal("no message sent")
+	}
+
+	return strings.Fields(messages[len(messages)-1].Body)[0]
+}
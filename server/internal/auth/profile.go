@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/util"
+)
+
+const usernameChangeCooldown = 7 * 24 * time.Hour
+
+type updateMeRequest struct {
+	Username    *string `json:"username"`
+	DisplayName *string `json:"display_name"`
+	Locale      *string `json:"locale"`
+}
+
+// UpdateMe edits the signed-in user's username, display name and email
+// locale. Fields left out of the request are unchanged. Usernames can only be
+// changed once per usernameChangeCooldown.
+func (h *Handler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	var req updateMeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	var displayName string
+	if req.DisplayName != nil {
+		var err error
+		displayName, err = normalizeDisplayName(*req.DisplayName)
+		if err != nil {
+			util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	if req.Locale != nil && *req.Locale != "" && !h.Mailer.Templates.Supports(*req.Locale) {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Unsupported locale"})
+		return
+	}
+
+	username := user.Username
+	if req.Username != nil {
+		username = normalizeUsername(*req.Username)
+	}
+	if username != user.Username {
+		if err := validateUsername(username); err != nil {
+			util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		if user.UsernameChangedAt.Valid && time.Since(user.UsernameChangedAt.Time) < usernameChangeCooldown {
+			util.WriteJSON(w, http.StatusTooManyRequests, util.ErrorResponse{Error: "Username can only be changed once every 7 days"})
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	// The fields are updated together so a failure leaves none of them
+	// changed.
+	err := h.Store.InTx(ctx, func(q Store) error {
+		if username != user.Username {
+			taken, err := q.IsUsernameTaken(ctx, username)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return errUsernameTaken
+			}
+
+			user, err = q.UpdateUsername(ctx, gendb.UpdateUsernameParams{
+				ID:       user.ID,
+				Username: username,
+			})
+			if isUniqueViolation(err, "users_username_lower_idx") {
+				return errUsernameTaken
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if req.DisplayName != nil {
+			var err error
+			user, err = q.UpdateDisplayName(ctx, gendb.UpdateDisplayNameParams{
+				ID:          user.ID,
+				DisplayName: pgtype.Text{String: displayName, Valid: displayName != ""},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if req.Locale != nil {
+			var err error
+			user, err = q.UpdateUserLocale(ctx, gendb.UpdateUserLocaleParams{
+				ID:     user.ID,
+				Locale: pgtype.Text{String: *req.Locale, Valid: *req.Locale != ""},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if errors.Is(err, errUsernameTaken) {
+		util.WriteJSON(w, http.StatusConflict, util.ErrorResponse{Error: "Username already taken"})
+		return
+	}
+	if err != nil {
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	h.Sessions.InvalidateUser(ctx, user.ID)
+
+	util.WriteJSON(w, http.StatusOK, toMeResponse(user))
+}
+
+func toMeResponse(user gendb.User) meResponse {
+	return meResponse{
+		Email:       user.Email,
+		Username:    user.Username,
+		DisplayName: user.DisplayName.String,
+		Locale:      user.Locale.String,
+		Phone:       user.Phone.String,
+	}
+}
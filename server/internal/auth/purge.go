@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+// PurgeDeletedUsers permanently removes users whose deletion was requested
+// more than grace ago, along with their providers, sessions, OTPs, and the
+// IP and user agent recorded on their audit events. Each user is purged in
+// its own transaction so one failure doesn't roll back or hold up the rest;
+// the failures are returned together.
+func PurgeDeletedUsers(ctx context.Context, pool *pgxpool.Pool, grace time.Duration) (int, error) {
+	queries := gendb.New(pool)
+
+	users, err := queries.ListUsersDueForPurge(ctx, pgtype.Timestamptz{
+		Time:  time.Now().Add(-grace),
+		Valid: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		purged int
+		errs   []error
+	)
+	for _, user := range users {
+		err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+			q := queries.WithTx(tx)
+
+			if err := q.DeleteOTPsByEmail(ctx, user.Email); err != nil {
+				return err
+			}
+			if user.EmailNormalized.Valid {
+				if err := q.DeleteOTPsByEmail(ctx, user.EmailNormalized.String); err != nil {
+					return err
+				}
+			}
+			if err := q.ScrubAuditEventsForUser(ctx, user.ID); err != nil {
+				return err
+			}
+
+			// Providers, sessions, and roles cascade; audit events keep a
+			// NULL user_id.
+			return q.DeleteUser(ctx, user.ID)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("purge user %s: %w", user.ID.String(), err))
+			continue
+		}
+		purged++
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+// StartPurgeJob runs PurgeDeletedUsers, drops expired data exports and
+// forgets logins and devices older than loginRetention, once at startup and
+// then every interval until ctx is done.
+func StartPurgeJob(ctx context.Context, pool *pgxpool.Pool, interval time.Duration, grace time.Duration, loginRetention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		runPurge(ctx, pool, grace, loginRetention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runPurge(ctx context.Context, pool *pgxpool.Pool, grace time.Duration, loginRetention time.Duration) {
+	purged, err := PurgeDeletedUsers(ctx, pool, grace)
+	if err != nil {
+		log.Print("Failed to purge deleted users: ", err)
+	}
+	if purged > 0 {
+		log.Print("🧹 Purged ", purged, " deleted users")
+	}
+
+	queries := gendb.New(pool)
+	if err := queries.DeleteExpiredDataExports(ctx); err != nil {
+		log.Print("Failed to delete expired data exports: ", err)
+	}
+
+	cutoff := pgtype.Timestamptz{Time: time.Now().Add(-loginRetention), Valid: true}
+	if err := queries.DeleteOldLogins(ctx, cutoff); err != nil {
+		log.Print("Failed to delete old logins: ", err)
+	}
+	if err := queries.DeleteStaleUserDevices(ctx, cutoff); err != nil {
+		log.Print("Failed to delete stale devices: ", err)
+	}
+	if err := queries.DeleteExpiredEmailChanges(ctx); err != nil {
+		log.Print("Failed to delete expired email changes: ", err)
+	}
+}
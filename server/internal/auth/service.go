@@ -2,11 +2,22 @@ package auth
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"math/big"
-	mathrand "math/rand"
+	"net/http"
+	"strconv"
 
-	"github.com/resend/resend-go/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/sessioncache"
+)
+
+var (
+	errInactiveUser    = errors.New("user is not active")
+	errInvalidOTP      = errors.New("invalid or expired otp")
+	errPendingDeletion = errors.New("user is pending deletion")
 )
 
 func genOTP() (string, error) {
@@ -20,33 +31,62 @@ func genOTP() (string, error) {
 	return otp, nil
 }
 
-func sendOTP(client *resend.Client, email string, otp string) error {
-	from := []string{"Khiem", "Anh"}[mathrand.Intn(2)]
-	content := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head><meta charset="UTF-8"></head>
-		<body>
-			<div style="font-family: sans-serif; max-width: 400px; margin: 0 auto; padding: 20px;">
-				<p>Hello, this is %s from KatanaID</p>
-				<p>Your verification code is</p>
-				<div style="font-size: 32px; font-weight: bold; letter-spacing: 8px; padding: 20px; background: #f4f4f4; text-align: center; border-radius: 8px;">
-					%s
-				</div>
-				<p style="color: #666; margin-top: 16px;">It will expire in 5 minutes.</p>
-				<p style="color: #999; font-size: 12px;">If you didn&#39;t request this, you can ignore this email.</p>
-				<p>Thanks, from KatanaID team</p>
-			</div>
-		</body>
-		</html>
-	`, from, otp)
-
-	_, err := client.Emails.Send(&resend.SendEmailRequest{
-		From:    fmt.Sprintf("%s@katanaid.com", from),
-		To:      []string{email},
-		Subject: "Your OTP Code for KatanaID",
-		Html:    content,
-	})
-
-	return err
+// emailLocale picks the locale for emails to user about request r. user
+// may be the zero value when the recipient has no account yet.
+func (h *Handler) emailLocale(user gendb.User, r *http.Request) string {
+	return h.Mailer.Templates.Locale(user.Locale.String, r.Header.Get("Accept-Language"))
+}
+
+// sessionToken parses the session cookie on r.
+func (h *Handler) sessionToken(r *http.Request) (pgtype.UUID, error) {
+	value, err := h.Cookies.Get(r, "session")
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+
+	token, err := uuid.Parse(value)
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+
+	return pgtype.UUID{Bytes: token, Valid: true}, nil
+}
+
+// sessionUser resolves the session cookie on r into the user it belongs to.
+func (h *Handler) sessionUser(r *http.Request) (gendb.User, error) {
+	token, err := h.sessionToken(r)
+	if err != nil {
+		return gendb.User{}, err
+	}
+
+	if entry, ok := h.Sessions.Get(token); ok {
+		return entry.User, nil
+	}
+
+	ctx := r.Context()
+	session, err := h.Store.GetSession(ctx, token)
+	if err != nil {
+		return gendb.User{}, err
+	}
+
+	user, err := h.Store.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return gendb.User{}, err
+	}
+
+	if user.Status != StatusActive {
+		return gendb.User{}, errInactiveUser
+	}
+
+	h.Sessions.Put(token, sessioncache.Entry{Session: session, User: user})
+
+	return user, nil
+}
+
+func queryInt(r *http.Request, key string, fallback int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil {
+		return fallback
+	}
+	return n
 }
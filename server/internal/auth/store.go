@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trnahnh/katana-id/internal/audit"
+	"github.com/trnahnh/katana-id/internal/db"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/email"
+)
+
+// OTPStore persists one-time sign-in codes.
+type OTPStore interface {
+	CreateOTP(ctx context.Context, arg gendb.CreateOTPParams) (gendb.Otp, error)
+	ConsumeOTP(ctx context.Context, arg gendb.ConsumeOTPParams) (gendb.Otp, error)
+	DeleteOTPsByEmail(ctx context.Context, email string) error
+}
+
+// PhoneOTPStore persists codes sent by text message, both for signing in
+// with a verified phone and for verifying one.
+type PhoneOTPStore interface {
+	CreatePhoneOTP(ctx context.Context, arg gendb.CreatePhoneOTPParams) (gendb.PhoneOtp, error)
+	ConsumePhoneOTP(ctx context.Context, arg gendb.ConsumePhoneOTPParams) (gendb.PhoneOtp, error)
+	DeletePhoneOTPs(ctx context.Context, phone string) error
+}
+
+// SessionStore persists sign-in sessions.
+type SessionStore interface {
+	CreateSession(ctx context.Context, arg gendb.CreateSessionParams) (gendb.Session, error)
+	GetSession(ctx context.Context, token pgtype.UUID) (gendb.Session, error)
+	DeleteSessionByToken(ctx context.Context, token pgtype.UUID) error
+}
+
+// UserStore persists users as far as sign-in is concerned.
+type UserStore interface {
+	CreateUser(ctx context.Context, arg gendb.CreateUserParams) (gendb.User, error)
+	GetUserByEmail(ctx context.Context, arg gendb.GetUserByEmailParams) (gendb.User, error)
+	GetUserByID(ctx context.Context, id pgtype.UUID) (gendb.User, error)
+	GetUserByPhone(ctx context.Context, phone string) (gendb.User, error)
+	IsUsernameTaken(ctx context.Context, username string) (bool, error)
+	RestoreUser(ctx context.Context, id pgtype.UUID) (gendb.User, error)
+}
+
+// ProfileStore persists the profile fields users edit themselves.
+type ProfileStore interface {
+	UpdateUsername(ctx context.Context, arg gendb.UpdateUsernameParams) (gendb.User, error)
+	UpdateDisplayName(ctx context.Context, arg gendb.UpdateDisplayNameParams) (gendb.User, error)
+	UpdateUserLocale(ctx context.Context, arg gendb.UpdateUserLocaleParams) (gendb.User, error)
+}
+
+// LoginStore persists the sign-in history and the devices users sign in
+// from.
+type LoginStore interface {
+	TouchUserDevice(ctx context.Context, arg gendb.TouchUserDeviceParams) (gendb.UserDevice, error)
+	CreateUserDevice(ctx context.Context, arg gendb.CreateUserDeviceParams) (gendb.UserDevice, error)
+	DeleteUserDevice(ctx context.Context, arg gendb.DeleteUserDeviceParams) error
+	HasLogins(ctx context.Context, userID pgtype.UUID) (bool, error)
+	IsNewLoginCountry(ctx context.Context, arg gendb.IsNewLoginCountryParams) (bool, error)
+	CreateLogin(ctx context.Context, arg gendb.CreateLoginParams) (gendb.Login, error)
+	GetLoginByRevokeToken(ctx context.Context, revokeToken pgtype.UUID) (gendb.Login, error)
+	RevokeLogin(ctx context.Context, revokeToken pgtype.UUID) (gendb.Login, error)
+	ListLoginsByUserID(ctx context.Context, arg gendb.ListLoginsByUserIDParams) ([]gendb.Login, error)
+}
+
+// Store is everything the sign-in handlers (SendOTP, VerifyOTP, Me,
+// UpdateMe, Logout, ListLogins, RevokeLoginPage, RevokeLogin and
+// RequireUser) read and write.
+type Store interface {
+	OTPStore
+	PhoneOTPStore
+	SessionStore
+	UserStore
+	ProfileStore
+	LoginStore
+	audit.Store
+	email.OutboxStore
+}
+
+// TxStore is a Store that can run a group of calls atomically. fn receives a
+// Store bound to the transaction; returning an error rolls it back.
+type TxStore interface {
+	Store
+	InTx(ctx context.Context, fn func(Store) error) error
+}
+
+var (
+	_ Store   = (*gendb.Queries)(nil)
+	_ TxStore = PgStore{}
+)
+
+// PgStore is the Postgres TxStore.
+type PgStore struct {
+	*gendb.Queries
+	Pool *pgxpool.Pool
+}
+
+func (s PgStore) InTx(ctx context.Context, fn func(Store) error) error {
+	db.MarkWrite(ctx)
+
+	return pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		return fn(s.Queries.WithTx(tx))
+	})
+}
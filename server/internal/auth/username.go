@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+//go:embed wordlists/reserved.txt
+var reservedList string
+
+//go:embed wordlists/profanity.txt
+var profanityList string
+
+const (
+	usernameMinLength    = 3
+	usernameMaxLength    = 30
+	displayNameMaxLength = 50
+	usernameAttempts     = 10
+)
+
+var (
+	reservedUsernames = loadWordList(reservedList)
+	profaneWords      = loadWordList(profanityList)
+
+	usernameRegex     = regexp.MustCompile(`^[a-z0-9_]+$`)
+	usernameStripper  = regexp.MustCompile(`[^a-z0-9_]+`)
+	whitespaceRunsExp = regexp.MustCompile(`\s+`)
+	wordSeparators    = regexp.MustCompile(`[_.0-9]+`)
+
+	errInvalidUsername    = errors.New("usernames must be 3-30 characters of letters, numbers, and underscores")
+	errReservedUsername   = errors.New("username is reserved")
+	errInappropriateName  = errors.New("name contains inappropriate language")
+	errInvalidDisplayName = errors.New("display names must be at most 50 characters with no control characters")
+	errUsernameExhausted  = errors.New("could not generate a unique username")
+	errUsernameTaken      = errors.New("username already taken")
+)
+
+func loadWordList(list string) map[string]bool {
+	words := map[string]bool{}
+	for _, line := range strings.Split(list, "\n") {
+		word := strings.TrimSpace(line)
+		if word != "" {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// validateUsername checks an already normalized username.
+func validateUsername(username string) error {
+	if len(username) < usernameMinLength || len(username) > usernameMaxLength || !usernameRegex.MatchString(username) {
+		return errInvalidUsername
+	}
+	if reservedUsernames[username] {
+		return errReservedUsername
+	}
+	if containsProfanity(username) {
+		return errInappropriateName
+	}
+	return nil
+}
+
+// normalizeDisplayName trims and collapses whitespace in name and validates
+// the result. An empty result clears the display name.
+func normalizeDisplayName(name string) (string, error) {
+	name = whitespaceRunsExp.ReplaceAllString(strings.TrimSpace(name), " ")
+
+	if utf8.RuneCountInString(name) > displayNameMaxLength {
+		return "", errInvalidDisplayName
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", errInvalidDisplayName
+		}
+	}
+	for _, word := range strings.Fields(strings.ToLower(name)) {
+		if profaneWords[strings.Trim(word, ".,!?'\"")] {
+			return "", errInappropriateName
+		}
+	}
+
+	return name, nil
+}
+
+// containsProfanity reports whether any word of s, split on underscores,
+// dots and digits, is profane. Whole words are matched so names like
+// "scunthorpe" aren't caught by a word they happen to contain.
+func containsProfanity(s string) bool {
+	for _, word := range wordSeparators.Split(s, -1) {
+		if profaneWords[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// usernameFromEmail derives a username candidate from the local part of
+// email. The result may still be taken or reserved.
+func usernameFromEmail(email string) string {
+	local := strings.ToLower(strings.Split(email, "@")[0])
+	local, _, _ = strings.Cut(local, "+")
+	local = strings.Trim(usernameStripper.ReplaceAllString(local, "_"), "_")
+
+	if len(local) > usernameMaxLength-5 {
+		local = local[:usernameMaxLength-5]
+	}
+	if len(local) < usernameMinLength || containsProfanity(local) {
+		local = "user"
+	}
+
+	return local
+}
+
+// CreateUserForEmail creates a user for email, matched by its normalized
+// form from then on, with a username derived from the address. When that
+// username is taken or reserved, a random numeric suffix is appended and
+// creation retried. Conflicts are resolved with ON CONFLICT DO NOTHING rather
+// than errors, so queries may be bound to a transaction. If another request
+// created a user for email first, that user is returned.
+func CreateUserForEmail(ctx context.Context, queries UserStore, email string, normalized string) (gendb.User, error) {
+	base := usernameFromEmail(email)
+
+	for attempt := 0; attempt < usernameAttempts; attempt++ {
+		candidate := base
+		if attempt > 0 || reservedUsernames[base] {
+			n, err := rand.Int(rand.Reader, big.NewInt(10000))
+			if err != nil {
+				return gendb.User{}, err
+			}
+			candidate = fmt.Sprintf("%s_%04d", base, n.Int64())
+		}
+
+		taken, err := queries.IsUsernameTaken(ctx, candidate)
+		if err != nil {
+			return gendb.User{}, err
+		}
+		if taken {
+			continue
+		}
+
+		user, err := queries.CreateUser(ctx, gendb.CreateUserParams{
+			Username:        candidate,
+			Email:           email,
+			EmailNormalized: pgtype.Text{String: normalized, Valid: true},
+		})
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return user, err
+		}
+
+		user, err = queries.GetUserByEmail(ctx, gendb.GetUserByEmailParams{
+			Email:           email,
+			EmailNormalized: normalized,
+		})
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return user, err
+		}
+	}
+
+	return gendb.User{}, errUsernameExhausted
+}
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
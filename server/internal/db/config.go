@@ -0,0 +1,40 @@
+package db
+
+import (
+	"time"
+
+	"github.com/trnahnh/katana-id/util"
+)
+
+// Config tunes the connection pool and how queries are bounded.
+type Config struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+
+	// ConnectTimeout bounds how long Connect keeps retrying an unreachable
+	// database before giving up.
+	ConnectTimeout time.Duration
+	// QueryTimeout bounds each statement, both through the request context
+	// and as the server-side statement_timeout. Zero disables it.
+	QueryTimeout time.Duration
+	// SlowQuery is the duration above which a query is logged as slow.
+	SlowQuery time.Duration
+}
+
+// ConfigFromEnv reads Config from DB_* env vars, using defaults suited to a
+// single small instance.
+func ConfigFromEnv() Config {
+	return Config{
+		MaxConns:          int32(util.EnvInt("DB_MAX_CONNS", 10)),
+		MinConns:          int32(util.EnvInt("DB_MIN_CONNS", 1)),
+		MaxConnLifetime:   util.EnvDuration("DB_MAX_CONN_LIFETIME", time.Hour),
+		MaxConnIdleTime:   util.EnvDuration("DB_MAX_CONN_IDLE_TIME", 30*time.Minute),
+		HealthCheckPeriod: util.EnvDuration("DB_HEALTH_CHECK_PERIOD", time.Minute),
+		ConnectTimeout:    util.EnvDuration("DB_CONNECT_TIMEOUT", 30*time.Second),
+		QueryTimeout:      util.EnvDuration("DB_QUERY_TIMEOUT", 5*time.Second),
+		SlowQuery:         util.EnvDuration("DB_SLOW_QUERY", 500*time.Millisecond),
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"context"
 	"embed"
 	"errors"
+	"fmt"
+	"io/fs"
 	"log"
+	"strconv"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/trnahnh/katana-id/internal/db/generated"
 )
@@ -16,35 +21,194 @@ import (
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-func Connect(ctx context.Context, connString string) (*gendb.Queries, *pgxpool.Pool, error) {
-	pool, err := pgxpool.New(ctx, connString)
+// Connect opens a pool tuned by cfg and pings it, retrying with backoff
+// until cfg.ConnectTimeout passes. The returned Queries bound every
+// statement by cfg.QueryTimeout; transactions started from the pool are
+// bounded by the server-side statement_timeout instead.
+func Connect(ctx context.Context, connString string, cfg Config) (*gendb.Queries, *pgxpool.Pool, error) {
+	pool, err := OpenPool(ctx, connString, cfg)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	queries := gendb.New(pool)
-
 	log.Print("☁️  DB connected")
-	
-	return queries, pool, nil
+
+	return NewQueries(pool, cfg), pool, nil
+}
+
+// OpenPool opens and pings a pool tuned by cfg without wrapping it in
+// Queries, e.g. for a read replica.
+func OpenPool(ctx context.Context, connString string, cfg Config) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+
+	poolConfig.MaxConns = cfg.MaxConns
+	poolConfig.MinConns = cfg.MinConns
+	poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod
+	poolConfig.ConnConfig.Tracer = queryTracer{slow: cfg.SlowQuery}
+	if cfg.QueryTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.QueryTimeout.Milliseconds(), 10)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ping(ctx, pool, cfg.ConnectTimeout); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// NewQueries wraps dbtx in Queries that bound each statement by
+// cfg.QueryTimeout.
+func NewQueries(dbtx gendb.DBTX, cfg Config) *gendb.Queries {
+	if cfg.QueryTimeout > 0 {
+		dbtx = timeoutDB{db: dbtx, timeout: cfg.QueryTimeout}
+	}
+
+	return gendb.New(dbtx)
+}
+
+// ping waits for pool to answer, backing off exponentially between attempts
+// until timeout passes.
+func ping(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	backoff := 250 * time.Millisecond
+	for {
+		err := pool.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+
+		log.Print("⏳ DB not reachable, retrying in ", backoff, ": ", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database not reachable after %s: %w", timeout, err)
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, 5*time.Second)
+	}
+}
+
+// migrationLockID keys the advisory lock that serializes migrations across
+// replicas starting at the same time.
+const migrationLockID = 7_391_004_221
+
+// MigrationStatus describes the applied and available migrations.
+type MigrationStatus struct {
+	Version   uint
+	Dirty     bool
+	Available []uint
 }
 
 func RunMigrations(dbURL string) error {
+	err := withMigrations(dbURL, func(m *migrate.Migrate) error {
+		return m.Up()
+	})
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	log.Print("🌙 Successful migration")
+
+	return nil
+}
+
+// MigrateDown rolls back the last n applied migrations.
+func MigrateDown(dbURL string, n int) error {
+	return withMigrations(dbURL, func(m *migrate.Migrate) error {
+		return m.Steps(-n)
+	})
+}
+
+// MigrateTo migrates up or down to exactly version.
+func MigrateTo(dbURL string, version uint) error {
+	return withMigrations(dbURL, func(m *migrate.Migrate) error {
+		return m.Migrate(version)
+	})
+}
+
+// ForceMigrationVersion records version as applied and clears the dirty
+// flag without running anything, for recovering from a failed migration.
+func ForceMigrationVersion(dbURL string, version int) error {
+	return withMigrations(dbURL, func(m *migrate.Migrate) error {
+		return m.Force(version)
+	})
+}
+
+func GetMigrationStatus(dbURL string) (MigrationStatus, error) {
+	var status MigrationStatus
+
+	err := withMigrations(dbURL, func(m *migrate.Migrate) error {
+		version, dirty, err := m.Version()
+		if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+			return err
+		}
+		status.Version = version
+		status.Dirty = dirty
+		return nil
+	})
+	if err != nil {
+		return status, err
+	}
+
 	source, err := iofs.New(migrationsFS, "migrations")
 	if err != nil {
-		return err
+		return status, err
 	}
+	defer source.Close()
 
-	m, err := migrate.NewWithSourceInstance("iofs", source, dbURL)
+	version, err := source.First()
+	for err == nil {
+		status.Available = append(status.Available, version)
+		version, err = source.Next(version)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return status, err
+	}
+
+	return status, nil
+}
+
+// withMigrations runs fn against the embedded migrations while holding the
+// migration advisory lock, so only one replica migrates at a time and the
+// others wait and then find nothing left to do.
+func withMigrations(dbURL string, fn func(m *migrate.Migrate) error) error {
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, dbURL)
 	if err != nil {
 		return err
 	}
+	defer conn.Close(ctx)
 
-	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
 		return err
 	}
+	defer conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
 
-	log.Print("🌙 Successful migration")
+	source, err := iofs.New(migrationsFS, "migrations")
+	if err != nil {
+		return err
+	}
 
-	return nil
-}
\ No newline at end of file
+	m, err := migrate.NewWithSourceInstance("iofs", source, dbURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	return fn(m)
+}
@@ -0,0 +1,69 @@
+// Package dbtest provides throwaway, fully migrated Postgres databases for
+// tests.
+package dbtest
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trnahnh/katana-id/internal/db"
+)
+
+// New returns a pool on a new migrated database, dropped when t ends. t is
+// skipped unless TEST_DB_URL points to a Postgres server it can create
+// databases on.
+func New(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	adminURL := os.Getenv("TEST_DB_URL")
+	if adminURL == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+
+	return create(t, adminURL)
+}
+
+// NewReplica returns a pool standing in for a read replica: a separate new
+// migrated database on the server at TEST_REPLICA_DB_URL, or at TEST_DB_URL
+// when that is unset. Nothing is replicated to it, so tests can tell which
+// pool served a read.
+func NewReplica(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	adminURL := os.Getenv("TEST_REPLICA_DB_URL")
+	if adminURL == "" {
+		adminURL = os.Getenv("TEST_DB_URL")
+	}
+	if adminURL == "" {
+		t.Skip("TEST_REPLICA_DB_URL and TEST_DB_URL not set")
+	}
+
+	return create(t, adminURL)
+}
+
+func create(t testing.TB, adminURL string) *pgxpool.Pool {
+	t.Helper()
+
+	ctx := context.Background()
+	dbURL, drop, err := db.CreateMigratedDatabase(ctx, adminURL, "katanaid_test")
+	if err != nil {
+		t.Fatal("create test database: ", err)
+	}
+
+	pool, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		drop(ctx)
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		pool.Close()
+		if err := drop(context.Background()); err != nil {
+			t.Log("drop test database: ", err)
+		}
+	})
+
+	return pool
+}
@@ -8,6 +8,113 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AppOrigin struct {
+	ID        pgtype.UUID
+	Origin    string
+	AppName   string
+	CreatedAt pgtype.Timestamptz
+}
+
+type AuditEvent struct {
+	ID        pgtype.UUID
+	UserID    pgtype.UUID
+	ActorID   pgtype.UUID
+	Action    string
+	IpAddress pgtype.Text
+	UserAgent pgtype.Text
+	CreatedAt pgtype.Timestamptz
+}
+
+type DataExport struct {
+	ID         pgtype.UUID
+	UserID     pgtype.UUID
+	Format     string
+	Status     string
+	Data       []byte
+	CreatedAt  pgtype.Timestamptz
+	ExpiresAt  pgtype.Timestamptz
+	Attempts   int32
+	LeaseUntil pgtype.Timestamptz
+}
+
+type EmailChange struct {
+	ID                 pgtype.UUID
+	UserID             pgtype.UUID
+	NewEmail           string
+	Otp                string
+	CancelToken        pgtype.UUID
+	ExpiresAt          pgtype.Timestamptz
+	CreatedAt          pgtype.Timestamptz
+	OldEmail           pgtype.Text
+	OldEmailNormalized pgtype.Text
+	CompletedAt        pgtype.Timestamptz
+	RevertUntil        pgtype.Timestamptz
+	Attempts           int32
+}
+
+type EmailDuplicate struct {
+	UserID          pgtype.UUID
+	Email           string
+	EmailNormalized string
+	KeptUserID      pgtype.UUID
+	DetectedAt      pgtype.Timestamptz
+}
+
+type EmailEvent struct {
+	ID                pgtype.UUID
+	Provider          string
+	WebhookID         string
+	OutboxID          pgtype.UUID
+	ProviderMessageID string
+	Type              string
+	Recipient         string
+	Detail            pgtype.Text
+	OccurredAt        pgtype.Timestamptz
+	CreatedAt         pgtype.Timestamptz
+}
+
+type EmailOutbox struct {
+	ID                pgtype.UUID
+	IdempotencyKey    string
+	Recipient         string
+	Template          string
+	Subject           string
+	Html              string
+	BodyText          string
+	Status            string
+	Attempts          int32
+	NextAttemptAt     pgtype.Timestamptz
+	LastError         pgtype.Text
+	ProviderMessageID pgtype.Text
+	CreatedAt         pgtype.Timestamptz
+	SentAt            pgtype.Timestamptz
+	DeliveryStatus    pgtype.Text
+	ExpiresAt         pgtype.Timestamptz
+}
+
+type EmailSuppression struct {
+	Email     string
+	Reason    string
+	CreatedAt pgtype.Timestamptz
+}
+
+type Login struct {
+	ID           pgtype.UUID
+	UserID       pgtype.UUID
+	SessionToken pgtype.UUID
+	Method       string
+	Fingerprint  string
+	DeviceName   string
+	UserAgent    pgtype.Text
+	IpAddress    pgtype.Text
+	Country      pgtype.Text
+	NewDevice    bool
+	NewCountry   bool
+	RevokeToken  pgtype.UUID
+	RevokedAt    pgtype.Timestamptz
+	CreatedAt    pgtype.Timestamptz
+}
+
 type Otp struct {
 	ID        pgtype.UUID
 	Email     string
@@ -15,6 +122,20 @@ type Otp struct {
 	ExpiresAt pgtype.Timestamptz
 }
 
+type Permission struct {
+	ID   pgtype.UUID
+	Name string
+}
+
+type PhoneOtp struct {
+	ID        pgtype.UUID
+	Phone     string
+	Otp       string
+	UserID    pgtype.UUID
+	ExpiresAt pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+}
+
 type Provider struct {
 	ID                pgtype.UUID
 	UserID            pgtype.UUID
@@ -23,15 +144,59 @@ type Provider struct {
 	CreatedAt         pgtype.Timestamptz
 }
 
+type RateLimit struct {
+	Key         string
+	WindowStart pgtype.Timestamptz
+	Count       int32
+	ExpiresAt   pgtype.Timestamptz
+}
+
+type Role struct {
+	ID        pgtype.UUID
+	Name      string
+	CreatedAt pgtype.Timestamptz
+}
+
+type RolePermission struct {
+	RoleID       pgtype.UUID
+	PermissionID pgtype.UUID
+}
+
 type Session struct {
 	Token     pgtype.UUID
-	Email     string
 	ExpiresAt pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+	UserAgent pgtype.Text
+	IpAddress pgtype.Text
+	UserID    pgtype.UUID
 }
 
 type User struct {
-	ID        pgtype.UUID
-	Username  string
-	Email     string
+	ID                  pgtype.UUID
+	Username            string
+	Email               string
+	CreatedAt           pgtype.Timestamptz
+	Status              string
+	DeletionRequestedAt pgtype.Timestamptz
+	DisplayName         pgtype.Text
+	UsernameChangedAt   pgtype.Timestamptz
+	Locale              pgtype.Text
+	Phone               pgtype.Text
+	PhoneVerifiedAt     pgtype.Timestamptz
+	EmailNormalized     pgtype.Text
+}
+
+type UserDevice struct {
+	ID          pgtype.UUID
+	UserID      pgtype.UUID
+	Fingerprint string
+	Name        string
+	FirstSeenAt pgtype.Timestamptz
+	LastSeenAt  pgtype.Timestamptz
+}
+
+type UserRole struct {
+	UserID    pgtype.UUID
+	RoleID    pgtype.UUID
 	CreatedAt pgtype.Timestamptz
 }
@@ -11,9 +11,537 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const createOTP = `-- name: CreateOTP :exec
+const assignRole = `-- name: AssignRole :exec
+INSERT INTO user_roles (user_id, role_id)
+SELECT $1::uuid, id FROM roles WHERE name = $2
+ON CONFLICT DO NOTHING
+`
+
+type AssignRoleParams struct {
+	UserID   pgtype.UUID
+	RoleName string
+}
+
+func (q *Queries) AssignRole(ctx context.Context, arg AssignRoleParams) error {
+	_, err := q.db.Exec(ctx, assignRole, arg.UserID, arg.RoleName)
+	return err
+}
+
+const cancelEmailChange = `-- name: CancelEmailChange :one
+DELETE FROM email_changes WHERE cancel_token = $1 AND completed_at IS NULL
+RETURNING id, user_id, new_email, otp, cancel_token, expires_at, created_at, old_email, old_email_normalized, completed_at, revert_until, attempts
+`
+
+func (q *Queries) CancelEmailChange(ctx context.Context, cancelToken pgtype.UUID) (EmailChange, error) {
+	row := q.db.QueryRow(ctx, cancelEmailChange, cancelToken)
+	var i EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.NewEmail,
+		&i.Otp,
+		&i.CancelToken,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.OldEmail,
+		&i.OldEmailNormalized,
+		&i.CompletedAt,
+		&i.RevertUntil,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const claimDataExports = `-- name: ClaimDataExports :many
+UPDATE data_exports
+SET status = 'running', attempts = attempts + 1, lease_until = $1
+WHERE id IN (
+  SELECT id FROM data_exports
+  WHERE status IN ('pending', 'running') AND lease_until <= NOW() AND expires_at > NOW()
+  ORDER BY created_at
+  LIMIT $2::int
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id, format, status, data, created_at, expires_at, attempts, lease_until
+`
+
+type ClaimDataExportsParams struct {
+	LeaseUntil pgtype.Timestamptz
+	BatchSize  int32
+}
+
+func (q *Queries) ClaimDataExports(ctx context.Context, arg ClaimDataExportsParams) ([]DataExport, error) {
+	rows, err := q.db.Query(ctx, claimDataExports, arg.LeaseUntil, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DataExport
+	for rows.Next() {
+		var i DataExport
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Format,
+			&i.Status,
+			&i.Data,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.Attempts,
+			&i.LeaseUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimOutboxEmails = `-- name: ClaimOutboxEmails :many
+UPDATE email_outbox
+SET status = 'sending', attempts = attempts + 1, next_attempt_at = $1
+WHERE id IN (
+  SELECT id FROM email_outbox
+  WHERE status IN ('pending', 'sending') AND next_attempt_at <= NOW()
+    AND (expires_at IS NULL OR expires_at > NOW())
+  ORDER BY next_attempt_at
+  LIMIT $2::int
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, idempotency_key, recipient, template, subject, html, body_text, status, attempts, next_attempt_at, last_error, provider_message_id, created_at, sent_at, delivery_status, expires_at
+`
+
+type ClaimOutboxEmailsParams struct {
+	LeaseUntil pgtype.Timestamptz
+	BatchSize  int32
+}
+
+func (q *Queries) ClaimOutboxEmails(ctx context.Context, arg ClaimOutboxEmailsParams) ([]EmailOutbox, error) {
+	rows, err := q.db.Query(ctx, claimOutboxEmails, arg.LeaseUntil, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []EmailOutbox
+	for rows.Next() {
+		var i EmailOutbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.IdempotencyKey,
+			&i.Recipient,
+			&i.Template,
+			&i.Subject,
+			&i.Html,
+			&i.BodyText,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.ProviderMessageID,
+			&i.CreatedAt,
+			&i.SentAt,
+			&i.DeliveryStatus,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const clearUserPhone = `-- name: ClearUserPhone :one
+UPDATE users SET phone = NULL, phone_verified_at = NULL WHERE id = $1
+RETURNING id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized
+`
+
+func (q *Queries) ClearUserPhone(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, clearUserPhone, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const completeDataExport = `-- name: CompleteDataExport :exec
+UPDATE data_exports SET status = 'ready', data = $2 WHERE id = $1
+`
+
+type CompleteDataExportParams struct {
+	ID   pgtype.UUID
+	Data []byte
+}
+
+func (q *Queries) CompleteDataExport(ctx context.Context, arg CompleteDataExportParams) error {
+	_, err := q.db.Exec(ctx, completeDataExport, arg.ID, arg.Data)
+	return err
+}
+
+const completeEmailChange = `-- name: CompleteEmailChange :one
+UPDATE email_changes
+SET completed_at = NOW(), old_email = $1, old_email_normalized = $2, revert_until = $3
+WHERE id = (
+  SELECT id FROM email_changes
+  WHERE user_id = $4 AND completed_at IS NULL AND expires_at > NOW()
+  ORDER BY created_at DESC LIMIT 1
+  FOR UPDATE
+) AND otp = $5 AND attempts < $6::int
+RETURNING id, user_id, new_email, otp, cancel_token, expires_at, created_at, old_email, old_email_normalized, completed_at, revert_until, attempts
+`
+
+type CompleteEmailChangeParams struct {
+	OldEmail           pgtype.Text
+	OldEmailNormalized pgtype.Text
+	RevertUntil        pgtype.Timestamptz
+	UserID             pgtype.UUID
+	Otp                string
+	MaxAttempts        int32
+}
+
+func (q *Queries) CompleteEmailChange(ctx context.Context, arg CompleteEmailChangeParams) (EmailChange, error) {
+	row := q.db.QueryRow(ctx, completeEmailChange,
+		arg.OldEmail,
+		arg.OldEmailNormalized,
+		arg.RevertUntil,
+		arg.UserID,
+		arg.Otp,
+		arg.MaxAttempts,
+	)
+	var i EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.NewEmail,
+		&i.Otp,
+		&i.CancelToken,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.OldEmail,
+		&i.OldEmailNormalized,
+		&i.CompletedAt,
+		&i.RevertUntil,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const consumeOTP = `-- name: ConsumeOTP :one
+DELETE FROM otps
+WHERE id = (
+  SELECT id FROM otps
+  WHERE email = $1 AND expires_at > NOW()
+  ORDER BY expires_at DESC
+  LIMIT 1
+) AND otp = $2
+RETURNING id, email, otp, expires_at
+`
+
+type ConsumeOTPParams struct {
+	Email string
+	Otp   string
+}
+
+func (q *Queries) ConsumeOTP(ctx context.Context, arg ConsumeOTPParams) (Otp, error) {
+	row := q.db.QueryRow(ctx, consumeOTP, arg.Email, arg.Otp)
+	var i Otp
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Otp,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const consumePhoneOTP = `-- name: ConsumePhoneOTP :one
+DELETE FROM phone_otps
+WHERE id = (
+  SELECT id FROM phone_otps
+  WHERE phone = $1::text AND user_id IS NOT DISTINCT FROM $2::uuid AND expires_at > NOW()
+  ORDER BY expires_at DESC
+  LIMIT 1
+) AND otp = $3::text
+RETURNING id, phone, otp, user_id, expires_at, created_at
+`
+
+type ConsumePhoneOTPParams struct {
+	Phone  string
+	UserID pgtype.UUID
+	Otp    string
+}
+
+func (q *Queries) ConsumePhoneOTP(ctx context.Context, arg ConsumePhoneOTPParams) (PhoneOtp, error) {
+	row := q.db.QueryRow(ctx, consumePhoneOTP, arg.Phone, arg.UserID, arg.Otp)
+	var i PhoneOtp
+	err := row.Scan(
+		&i.ID,
+		&i.Phone,
+		&i.Otp,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const countAuditEventsByUser = `-- name: CountAuditEventsByUser :one
+SELECT COUNT(*) FROM audit_events WHERE user_id = $1
+`
+
+func (q *Queries) CountAuditEventsByUser(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countAuditEventsByUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUsersWithRole = `-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM user_roles ur
+JOIN roles r ON r.id = ur.role_id
+WHERE r.name = $1
+`
+
+func (q *Queries) CountUsersWithRole(ctx context.Context, name string) (int64, error) {
+	row := q.db.QueryRow(ctx, countUsersWithRole, name)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAppOrigin = `-- name: CreateAppOrigin :one
+INSERT INTO app_origins (origin, app_name)
+VALUES ($1, $2)
+ON CONFLICT (origin) DO NOTHING
+RETURNING id, origin, app_name, created_at
+`
+
+type CreateAppOriginParams struct {
+	Origin  string
+	AppName string
+}
+
+func (q *Queries) CreateAppOrigin(ctx context.Context, arg CreateAppOriginParams) (AppOrigin, error) {
+	row := q.db.QueryRow(ctx, createAppOrigin, arg.Origin, arg.AppName)
+	var i AppOrigin
+	err := row.Scan(
+		&i.ID,
+		&i.Origin,
+		&i.AppName,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createAuditEvent = `-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (user_id, actor_id, action, ip_address, user_agent)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateAuditEventParams struct {
+	UserID    pgtype.UUID
+	ActorID   pgtype.UUID
+	Action    string
+	IpAddress pgtype.Text
+	UserAgent pgtype.Text
+}
+
+func (q *Queries) CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) error {
+	_, err := q.db.Exec(ctx, createAuditEvent,
+		arg.UserID,
+		arg.ActorID,
+		arg.Action,
+		arg.IpAddress,
+		arg.UserAgent,
+	)
+	return err
+}
+
+const createDataExport = `-- name: CreateDataExport :one
+INSERT INTO data_exports (user_id, format, expires_at)
+VALUES ($1, $2, $3)
+RETURNING id, user_id, format, status, data, created_at, expires_at, attempts, lease_until
+`
+
+type CreateDataExportParams struct {
+	UserID    pgtype.UUID
+	Format    string
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) CreateDataExport(ctx context.Context, arg CreateDataExportParams) (DataExport, error) {
+	row := q.db.QueryRow(ctx, createDataExport, arg.UserID, arg.Format, arg.ExpiresAt)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Format,
+		&i.Status,
+		&i.Data,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.Attempts,
+		&i.LeaseUntil,
+	)
+	return i, err
+}
+
+const createEmailChange = `-- name: CreateEmailChange :one
+INSERT INTO email_changes (user_id, new_email, otp, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, new_email, otp, cancel_token, expires_at, created_at, old_email, old_email_normalized, completed_at, revert_until, attempts
+`
+
+type CreateEmailChangeParams struct {
+	UserID    pgtype.UUID
+	NewEmail  string
+	Otp       string
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) CreateEmailChange(ctx context.Context, arg CreateEmailChangeParams) (EmailChange, error) {
+	row := q.db.QueryRow(ctx, createEmailChange,
+		arg.UserID,
+		arg.NewEmail,
+		arg.Otp,
+		arg.ExpiresAt,
+	)
+	var i EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.NewEmail,
+		&i.Otp,
+		&i.CancelToken,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.OldEmail,
+		&i.OldEmailNormalized,
+		&i.CompletedAt,
+		&i.RevertUntil,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const createEmailEvent = `-- name: CreateEmailEvent :one
+INSERT INTO email_events (provider, webhook_id, outbox_id, provider_message_id, type, recipient, detail, occurred_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (provider, webhook_id) DO NOTHING
+RETURNING id, provider, webhook_id, outbox_id, provider_message_id, type, recipient, detail, occurred_at, created_at
+`
+
+type CreateEmailEventParams struct {
+	Provider          string
+	WebhookID         string
+	OutboxID          pgtype.UUID
+	ProviderMessageID string
+	Type              string
+	Recipient         string
+	Detail            pgtype.Text
+	OccurredAt        pgtype.Timestamptz
+}
+
+func (q *Queries) CreateEmailEvent(ctx context.Context, arg CreateEmailEventParams) (EmailEvent, error) {
+	row := q.db.QueryRow(ctx, createEmailEvent,
+		arg.Provider,
+		arg.WebhookID,
+		arg.OutboxID,
+		arg.ProviderMessageID,
+		arg.Type,
+		arg.Recipient,
+		arg.Detail,
+		arg.OccurredAt,
+	)
+	var i EmailEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Provider,
+		&i.WebhookID,
+		&i.OutboxID,
+		&i.ProviderMessageID,
+		&i.Type,
+		&i.Recipient,
+		&i.Detail,
+		&i.OccurredAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createLogin = `-- name: CreateLogin :one
+INSERT INTO logins (user_id, session_token, method, fingerprint, device_name, user_agent, ip_address, country, new_device, new_country)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING id, user_id, session_token, method, fingerprint, device_name, user_agent, ip_address, country, new_device, new_country, revoke_token, revoked_at, created_at
+`
+
+type CreateLoginParams struct {
+	UserID       pgtype.UUID
+	SessionToken pgtype.UUID
+	Method       string
+	Fingerprint  string
+	DeviceName   string
+	UserAgent    pgtype.Text
+	IpAddress    pgtype.Text
+	Country      pgtype.Text
+	NewDevice    bool
+	NewCountry   bool
+}
+
+func (q *Queries) CreateLogin(ctx context.Context, arg CreateLoginParams) (Login, error) {
+	row := q.db.QueryRow(ctx, createLogin,
+		arg.UserID,
+		arg.SessionToken,
+		arg.Method,
+		arg.Fingerprint,
+		arg.DeviceName,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.Country,
+		arg.NewDevice,
+		arg.NewCountry,
+	)
+	var i Login
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.SessionToken,
+		&i.Method,
+		&i.Fingerprint,
+		&i.DeviceName,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.Country,
+		&i.NewDevice,
+		&i.NewCountry,
+		&i.RevokeToken,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createOTP = `-- name: CreateOTP :one
 INSERT INTO otps (email, otp, expires_at)
 VALUES ($1, $2, $3)
+RETURNING id, email, otp, expires_at
 `
 
 type CreateOTPParams struct {
@@ -22,9 +550,97 @@ type CreateOTPParams struct {
 	ExpiresAt pgtype.Timestamptz
 }
 
-func (q *Queries) CreateOTP(ctx context.Context, arg CreateOTPParams) error {
-	_, err := q.db.Exec(ctx, createOTP, arg.Email, arg.Otp, arg.ExpiresAt)
-	return err
+func (q *Queries) CreateOTP(ctx context.Context, arg CreateOTPParams) (Otp, error) {
+	row := q.db.QueryRow(ctx, createOTP, arg.Email, arg.Otp, arg.ExpiresAt)
+	var i Otp
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Otp,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const createOutboxEmail = `-- name: CreateOutboxEmail :one
+INSERT INTO email_outbox (idempotency_key, recipient, template, subject, html, body_text, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (idempotency_key) DO NOTHING
+RETURNING id, idempotency_key, recipient, template, subject, html, body_text, status, attempts, next_attempt_at, last_error, provider_message_id, created_at, sent_at, delivery_status, expires_at
+`
+
+type CreateOutboxEmailParams struct {
+	IdempotencyKey string
+	Recipient      string
+	Template       string
+	Subject        string
+	Html           string
+	BodyText       string
+	ExpiresAt      pgtype.Timestamptz
+}
+
+func (q *Queries) CreateOutboxEmail(ctx context.Context, arg CreateOutboxEmailParams) (EmailOutbox, error) {
+	row := q.db.QueryRow(ctx, createOutboxEmail,
+		arg.IdempotencyKey,
+		arg.Recipient,
+		arg.Template,
+		arg.Subject,
+		arg.Html,
+		arg.BodyText,
+		arg.ExpiresAt,
+	)
+	var i EmailOutbox
+	err := row.Scan(
+		&i.ID,
+		&i.IdempotencyKey,
+		&i.Recipient,
+		&i.Template,
+		&i.Subject,
+		&i.Html,
+		&i.BodyText,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastError,
+		&i.ProviderMessageID,
+		&i.CreatedAt,
+		&i.SentAt,
+		&i.DeliveryStatus,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const createPhoneOTP = `-- name: CreatePhoneOTP :one
+INSERT INTO phone_otps (phone, otp, user_id, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, phone, otp, user_id, expires_at, created_at
+`
+
+type CreatePhoneOTPParams struct {
+	Phone     string
+	Otp       string
+	UserID    pgtype.UUID
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) CreatePhoneOTP(ctx context.Context, arg CreatePhoneOTPParams) (PhoneOtp, error) {
+	row := q.db.QueryRow(ctx, createPhoneOTP,
+		arg.Phone,
+		arg.Otp,
+		arg.UserID,
+		arg.ExpiresAt,
+	)
+	var i PhoneOtp
+	err := row.Scan(
+		&i.ID,
+		&i.Phone,
+		&i.Otp,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
 }
 
 const createProvider = `-- name: CreateProvider :one
@@ -53,103 +669,1543 @@ func (q *Queries) CreateProvider(ctx context.Context, arg CreateProviderParams)
 }
 
 const createSession = `-- name: CreateSession :one
-INSERT INTO sessions (email, expires_at)
-VALUES ($1, $2)
-RETURNING token, email, expires_at
+INSERT INTO sessions (user_id, expires_at, user_agent, ip_address)
+VALUES ($1, $2, $3, $4)
+RETURNING token, expires_at, created_at, user_agent, ip_address, user_id
 `
 
 type CreateSessionParams struct {
-	Email     string
+	UserID    pgtype.UUID
 	ExpiresAt pgtype.Timestamptz
+	UserAgent pgtype.Text
+	IpAddress pgtype.Text
 }
 
 func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
-	row := q.db.QueryRow(ctx, createSession, arg.Email, arg.ExpiresAt)
+	row := q.db.QueryRow(ctx, createSession,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.UserAgent,
+		arg.IpAddress,
+	)
 	var i Session
-	err := row.Scan(&i.Token, &i.Email, &i.ExpiresAt)
+	err := row.Scan(
+		&i.Token,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.UserID,
+	)
 	return i, err
 }
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (username, email)
-VALUES ($1, $2)
-RETURNING id, username, email, created_at
+INSERT INTO users (username, email, email_normalized)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING
+RETURNING id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized
 `
 
 type CreateUserParams struct {
-	Username string
-	Email    string
+	Username        string
+	Email           string
+	EmailNormalized pgtype.Text
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRow(ctx, createUser, arg.Username, arg.Email)
+	row := q.db.QueryRow(ctx, createUser, arg.Username, arg.Email, arg.EmailNormalized)
 	var i User
 	err := row.Scan(
 		&i.ID,
 		&i.Username,
 		&i.Email,
 		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
 	)
 	return i, err
 }
 
-const deleteOTPsByEmail = `-- name: DeleteOTPsByEmail :exec
-DELETE FROM otps WHERE email = $1
-`
-
-func (q *Queries) DeleteOTPsByEmail(ctx context.Context, email string) error {
-	_, err := q.db.Exec(ctx, deleteOTPsByEmail, email)
-	return err
-}
-
-const deleteSessionByToken = `-- name: DeleteSessionByToken :exec
-DELETE FROM sessions WHERE token = $1
+const createUserDevice = `-- name: CreateUserDevice :one
+INSERT INTO user_devices (user_id, fingerprint, name)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, fingerprint) DO NOTHING
+RETURNING id, user_id, fingerprint, name, first_seen_at, last_seen_at
 `
 
-func (q *Queries) DeleteSessionByToken(ctx context.Context, token pgtype.UUID) error {
-	_, err := q.db.Exec(ctx, deleteSessionByToken, token)
-	return err
+type CreateUserDeviceParams struct {
+	UserID      pgtype.UUID
+	Fingerprint string
+	Name        string
 }
 
-const getOTPByEmail = `-- name: GetOTPByEmail :one
-SELECT id, email, otp, expires_at FROM otps WHERE email = $1 AND expires_at > NOW() ORDER BY expires_at DESC LIMIT 1
-`
-
-func (q *Queries) GetOTPByEmail(ctx context.Context, email string) (Otp, error) {
-	row := q.db.QueryRow(ctx, getOTPByEmail, email)
-	var i Otp
+func (q *Queries) CreateUserDevice(ctx context.Context, arg CreateUserDeviceParams) (UserDevice, error) {
+	row := q.db.QueryRow(ctx, createUserDevice, arg.UserID, arg.Fingerprint, arg.Name)
+	var i UserDevice
 	err := row.Scan(
 		&i.ID,
-		&i.Email,
-		&i.Otp,
-		&i.ExpiresAt,
+		&i.UserID,
+		&i.Fingerprint,
+		&i.Name,
+		&i.FirstSeenAt,
+		&i.LastSeenAt,
 	)
 	return i, err
 }
 
-const getSession = `-- name: GetSession :one
-SELECT token, email, expires_at FROM sessions WHERE token = $1 AND expires_at > NOW()
+const deleteAppOrigin = `-- name: DeleteAppOrigin :execrows
+DELETE FROM app_origins WHERE id = $1
 `
 
-func (q *Queries) GetSession(ctx context.Context, token pgtype.UUID) (Session, error) {
-	row := q.db.QueryRow(ctx, getSession, token)
-	var i Session
-	err := row.Scan(&i.Token, &i.Email, &i.ExpiresAt)
+func (q *Queries) DeleteAppOrigin(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteAppOrigin, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteEmailChangesSince = `-- name: DeleteEmailChangesSince :exec
+DELETE FROM email_changes WHERE user_id = $1 AND created_at >= $2
+`
+
+type DeleteEmailChangesSinceParams struct {
+	UserID    pgtype.UUID
+	CreatedAt pgtype.Timestamptz
+}
+
+func (q *Queries) DeleteEmailChangesSince(ctx context.Context, arg DeleteEmailChangesSinceParams) error {
+	_, err := q.db.Exec(ctx, deleteEmailChangesSince, arg.UserID, arg.CreatedAt)
+	return err
+}
+
+const deleteEmailSuppression = `-- name: DeleteEmailSuppression :execrows
+DELETE FROM email_suppressions WHERE email = LOWER($1::text)
+`
+
+func (q *Queries) DeleteEmailSuppression(ctx context.Context, email string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteEmailSuppression, email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteExpiredDataExports = `-- name: DeleteExpiredDataExports :exec
+DELETE FROM data_exports WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredDataExports(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredDataExports)
+	return err
+}
+
+const deleteExpiredEmailChanges = `-- name: DeleteExpiredEmailChanges :exec
+DELETE FROM email_changes
+WHERE (completed_at IS NULL AND expires_at <= NOW()) OR revert_until <= NOW()
+`
+
+func (q *Queries) DeleteExpiredEmailChanges(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredEmailChanges)
+	return err
+}
+
+const deleteExpiredRateLimits = `-- name: DeleteExpiredRateLimits :exec
+DELETE FROM rate_limits WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredRateLimits(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredRateLimits)
+	return err
+}
+
+const deleteOTPsByEmail = `-- name: DeleteOTPsByEmail :exec
+DELETE FROM otps WHERE email = $1
+`
+
+func (q *Queries) DeleteOTPsByEmail(ctx context.Context, email string) error {
+	_, err := q.db.Exec(ctx, deleteOTPsByEmail, email)
+	return err
+}
+
+const deleteOldLogins = `-- name: DeleteOldLogins :exec
+DELETE FROM logins WHERE created_at < $1
+`
+
+func (q *Queries) DeleteOldLogins(ctx context.Context, createdAt pgtype.Timestamptz) error {
+	_, err := q.db.Exec(ctx, deleteOldLogins, createdAt)
+	return err
+}
+
+const deleteOtherSessions = `-- name: DeleteOtherSessions :exec
+DELETE FROM sessions WHERE user_id = $1 AND token <> $2
+`
+
+type DeleteOtherSessionsParams struct {
+	UserID pgtype.UUID
+	Token  pgtype.UUID
+}
+
+func (q *Queries) DeleteOtherSessions(ctx context.Context, arg DeleteOtherSessionsParams) error {
+	_, err := q.db.Exec(ctx, deleteOtherSessions, arg.UserID, arg.Token)
+	return err
+}
+
+const deletePendingEmailChanges = `-- name: DeletePendingEmailChanges :exec
+DELETE FROM email_changes WHERE user_id = $1 AND completed_at IS NULL
+`
+
+func (q *Queries) DeletePendingEmailChanges(ctx context.Context, userID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, deletePendingEmailChanges, userID)
+	return err
+}
+
+const deletePhoneOTPs = `-- name: DeletePhoneOTPs :exec
+DELETE FROM phone_otps WHERE phone = $1
+`
+
+func (q *Queries) DeletePhoneOTPs(ctx context.Context, phone string) error {
+	_, err := q.db.Exec(ctx, deletePhoneOTPs, phone)
+	return err
+}
+
+const deleteSentOutboxEmails = `-- name: DeleteSentOutboxEmails :execrows
+DELETE FROM email_outbox WHERE status = 'sent' AND sent_at < $1
+`
+
+func (q *Queries) DeleteSentOutboxEmails(ctx context.Context, sentAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteSentOutboxEmails, sentAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteSessionByToken = `-- name: DeleteSessionByToken :exec
+DELETE FROM sessions WHERE token = $1
+`
+
+func (q *Queries) DeleteSessionByToken(ctx context.Context, token pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, deleteSessionByToken, token)
+	return err
+}
+
+const deleteSessionsByUserID = `-- name: DeleteSessionsByUserID :exec
+DELETE FROM sessions WHERE user_id = $1
+`
+
+func (q *Queries) DeleteSessionsByUserID(ctx context.Context, userID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, deleteSessionsByUserID, userID)
+	return err
+}
+
+const deleteStaleUserDevices = `-- name: DeleteStaleUserDevices :exec
+DELETE FROM user_devices WHERE last_seen_at < $1
+`
+
+func (q *Queries) DeleteStaleUserDevices(ctx context.Context, lastSeenAt pgtype.Timestamptz) error {
+	_, err := q.db.Exec(ctx, deleteStaleUserDevices, lastSeenAt)
+	return err
+}
+
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, deleteUser, id)
+	return err
+}
+
+const deleteUserDevice = `-- name: DeleteUserDevice :exec
+DELETE FROM user_devices WHERE user_id = $1 AND fingerprint = $2
+`
+
+type DeleteUserDeviceParams struct {
+	UserID      pgtype.UUID
+	Fingerprint string
+}
+
+func (q *Queries) DeleteUserDevice(ctx context.Context, arg DeleteUserDeviceParams) error {
+	_, err := q.db.Exec(ctx, deleteUserDevice, arg.UserID, arg.Fingerprint)
+	return err
+}
+
+const expireOutboxEmails = `-- name: ExpireOutboxEmails :execrows
+UPDATE email_outbox
+SET status = 'dead', last_error = 'expired before it could be sent', html = '', body_text = ''
+WHERE expires_at <= NOW()
+  AND (status = 'pending' OR (status = 'sending' AND next_attempt_at <= NOW()))
+`
+
+func (q *Queries) ExpireOutboxEmails(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, expireOutboxEmails)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const failDataExport = `-- name: FailDataExport :exec
+UPDATE data_exports SET status = 'failed' WHERE id = $1
+`
+
+func (q *Queries) FailDataExport(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, failDataExport, id)
+	return err
+}
+
+const failEmailChangeAttempt = `-- name: FailEmailChangeAttempt :one
+UPDATE email_changes SET attempts = attempts + 1
+WHERE id = (
+  SELECT id FROM email_changes
+  WHERE user_id = $1 AND completed_at IS NULL AND expires_at > NOW()
+  ORDER BY created_at DESC LIMIT 1
+)
+RETURNING attempts
+`
+
+func (q *Queries) FailEmailChangeAttempt(ctx context.Context, userID pgtype.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, failEmailChangeAttempt, userID)
+	var attempts int32
+	err := row.Scan(&attempts)
+	return attempts, err
+}
+
+const getDataExport = `-- name: GetDataExport :one
+SELECT id, user_id, format, status, data, created_at, expires_at, attempts, lease_until FROM data_exports WHERE id = $1 AND user_id = $2 AND expires_at > NOW()
+`
+
+type GetDataExportParams struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) GetDataExport(ctx context.Context, arg GetDataExportParams) (DataExport, error) {
+	row := q.db.QueryRow(ctx, getDataExport, arg.ID, arg.UserID)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Format,
+		&i.Status,
+		&i.Data,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.Attempts,
+		&i.LeaseUntil,
+	)
+	return i, err
+}
+
+const getEmailChangeByCancelToken = `-- name: GetEmailChangeByCancelToken :one
+SELECT id, user_id, new_email, otp, cancel_token, expires_at, created_at, old_email, old_email_normalized, completed_at, revert_until, attempts FROM email_changes
+WHERE cancel_token = $1 AND (completed_at IS NULL OR revert_until > NOW())
+`
+
+func (q *Queries) GetEmailChangeByCancelToken(ctx context.Context, cancelToken pgtype.UUID) (EmailChange, error) {
+	row := q.db.QueryRow(ctx, getEmailChangeByCancelToken, cancelToken)
+	var i EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.NewEmail,
+		&i.Otp,
+		&i.CancelToken,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.OldEmail,
+		&i.OldEmailNormalized,
+		&i.CompletedAt,
+		&i.RevertUntil,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const getLoginByRevokeToken = `-- name: GetLoginByRevokeToken :one
+SELECT id, user_id, session_token, method, fingerprint, device_name, user_agent, ip_address, country, new_device, new_country, revoke_token, revoked_at, created_at FROM logins
+WHERE revoke_token = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) GetLoginByRevokeToken(ctx context.Context, revokeToken pgtype.UUID) (Login, error) {
+	row := q.db.QueryRow(ctx, getLoginByRevokeToken, revokeToken)
+	var i Login
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.SessionToken,
+		&i.Method,
+		&i.Fingerprint,
+		&i.DeviceName,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.Country,
+		&i.NewDevice,
+		&i.NewCountry,
+		&i.RevokeToken,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getOutboxEmailByProviderMessageID = `-- name: GetOutboxEmailByProviderMessageID :one
+SELECT id, idempotency_key, recipient, template, subject, html, body_text, status, attempts, next_attempt_at, last_error, provider_message_id, created_at, sent_at, delivery_status, expires_at FROM email_outbox WHERE provider_message_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetOutboxEmailByProviderMessageID(ctx context.Context, providerMessageID pgtype.Text) (EmailOutbox, error) {
+	row := q.db.QueryRow(ctx, getOutboxEmailByProviderMessageID, providerMessageID)
+	var i EmailOutbox
+	err := row.Scan(
+		&i.ID,
+		&i.IdempotencyKey,
+		&i.Recipient,
+		&i.Template,
+		&i.Subject,
+		&i.Html,
+		&i.BodyText,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastError,
+		&i.ProviderMessageID,
+		&i.CreatedAt,
+		&i.SentAt,
+		&i.DeliveryStatus,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getRateLimit = `-- name: GetRateLimit :one
+SELECT count FROM rate_limits WHERE key = $1 AND window_start = $2
+`
+
+type GetRateLimitParams struct {
+	Key         string
+	WindowStart pgtype.Timestamptz
+}
+
+func (q *Queries) GetRateLimit(ctx context.Context, arg GetRateLimitParams) (int32, error) {
+	row := q.db.QueryRow(ctx, getRateLimit, arg.Key, arg.WindowStart)
+	var count int32
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getSession = `-- name: GetSession :one
+SELECT token, expires_at, created_at, user_agent, ip_address, user_id FROM sessions WHERE token = $1 AND expires_at > NOW()
+`
+
+func (q *Queries) GetSession(ctx context.Context, token pgtype.UUID) (Session, error) {
+	row := q.db.QueryRow(ctx, getSession, token)
+	var i Session
+	err := row.Scan(
+		&i.Token,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.UserID,
+	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, username, email, created_at FROM users WHERE email = $1 LIMIT 1
+SELECT id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized FROM users
+WHERE email = $1::text OR email_normalized = $2::text
+ORDER BY email = $1::text DESC
+LIMIT 1
 `
 
-func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
-	row := q.db.QueryRow(ctx, getUserByEmail, email)
+type GetUserByEmailParams struct {
+	Email           string
+	EmailNormalized string
+}
+
+func (q *Queries) GetUserByEmail(ctx context.Context, arg GetUserByEmailParams) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByEmail, arg.Email, arg.EmailNormalized)
 	var i User
 	err := row.Scan(
 		&i.ID,
 		&i.Username,
 		&i.Email,
 		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
 	)
 	return i, err
 }
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized FROM users WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const getUserByPhone = `-- name: GetUserByPhone :one
+SELECT id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized FROM users WHERE phone = $1::text LIMIT 1
+`
+
+func (q *Queries) GetUserByPhone(ctx context.Context, phone string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByPhone, phone)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const hasLogins = `-- name: HasLogins :one
+SELECT EXISTS (
+  SELECT 1 FROM logins WHERE user_id = $1
+)
+`
+
+func (q *Queries) HasLogins(ctx context.Context, userID pgtype.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, hasLogins, userID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const incrementRateLimit = `-- name: IncrementRateLimit :one
+INSERT INTO rate_limits (key, window_start, count, expires_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (key, window_start) DO UPDATE SET count = rate_limits.count + EXCLUDED.count
+RETURNING count
+`
+
+type IncrementRateLimitParams struct {
+	Key         string
+	WindowStart pgtype.Timestamptz
+	Count       int32
+	ExpiresAt   pgtype.Timestamptz
+}
+
+func (q *Queries) IncrementRateLimit(ctx context.Context, arg IncrementRateLimitParams) (int32, error) {
+	row := q.db.QueryRow(ctx, incrementRateLimit,
+		arg.Key,
+		arg.WindowStart,
+		arg.Count,
+		arg.ExpiresAt,
+	)
+	var count int32
+	err := row.Scan(&count)
+	return count, err
+}
+
+const isEmailSuppressed = `-- name: IsEmailSuppressed :one
+SELECT EXISTS (
+  SELECT 1 FROM email_suppressions WHERE email = LOWER($1::text)
+)
+`
+
+func (q *Queries) IsEmailSuppressed(ctx context.Context, email string) (bool, error) {
+	row := q.db.QueryRow(ctx, isEmailSuppressed, email)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const isNewLoginCountry = `-- name: IsNewLoginCountry :one
+SELECT EXISTS (
+  SELECT 1 FROM logins WHERE user_id = $1::uuid AND country IS NOT NULL
+) AND NOT EXISTS (
+  SELECT 1 FROM logins WHERE user_id = $1::uuid AND country = $2::text
+)
+`
+
+type IsNewLoginCountryParams struct {
+	UserID  pgtype.UUID
+	Country string
+}
+
+func (q *Queries) IsNewLoginCountry(ctx context.Context, arg IsNewLoginCountryParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isNewLoginCountry, arg.UserID, arg.Country)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const isUsernameTaken = `-- name: IsUsernameTaken :one
+SELECT EXISTS (
+  SELECT 1 FROM users WHERE LOWER(username) = LOWER($1::text)
+)
+`
+
+func (q *Queries) IsUsernameTaken(ctx context.Context, username string) (bool, error) {
+	row := q.db.QueryRow(ctx, isUsernameTaken, username)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const listAllLoginsByUserID = `-- name: ListAllLoginsByUserID :many
+SELECT id, user_id, session_token, method, fingerprint, device_name, user_agent, ip_address, country, new_device, new_country, revoke_token, revoked_at, created_at FROM logins
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListAllLoginsByUserID(ctx context.Context, userID pgtype.UUID) ([]Login, error) {
+	rows, err := q.db.Query(ctx, listAllLoginsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Login
+	for rows.Next() {
+		var i Login
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.SessionToken,
+			&i.Method,
+			&i.Fingerprint,
+			&i.DeviceName,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.Country,
+			&i.NewDevice,
+			&i.NewCountry,
+			&i.RevokeToken,
+			&i.RevokedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAppOrigins = `-- name: ListAppOrigins :many
+SELECT id, origin, app_name, created_at FROM app_origins ORDER BY created_at
+`
+
+func (q *Queries) ListAppOrigins(ctx context.Context) ([]AppOrigin, error) {
+	rows, err := q.db.Query(ctx, listAppOrigins)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AppOrigin
+	for rows.Next() {
+		var i AppOrigin
+		if err := rows.Scan(
+			&i.ID,
+			&i.Origin,
+			&i.AppName,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditEventsByUser = `-- name: ListAuditEventsByUser :many
+SELECT id, user_id, actor_id, action, ip_address, user_agent, created_at FROM audit_events WHERE user_id = $1 ORDER BY created_at
+`
+
+func (q *Queries) ListAuditEventsByUser(ctx context.Context, userID pgtype.UUID) ([]AuditEvent, error) {
+	rows, err := q.db.Query(ctx, listAuditEventsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ActorID,
+			&i.Action,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEmailDuplicates = `-- name: ListEmailDuplicates :many
+SELECT user_id, email, email_normalized, kept_user_id, detected_at FROM email_duplicates
+WHERE user_id IN (SELECT id FROM users WHERE email_normalized IS NULL)
+ORDER BY email_normalized, detected_at
+`
+
+func (q *Queries) ListEmailDuplicates(ctx context.Context) ([]EmailDuplicate, error) {
+	rows, err := q.db.Query(ctx, listEmailDuplicates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []EmailDuplicate
+	for rows.Next() {
+		var i EmailDuplicate
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Email,
+			&i.EmailNormalized,
+			&i.KeptUserID,
+			&i.DetectedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEmailSuppressions = `-- name: ListEmailSuppressions :many
+SELECT email, reason, created_at FROM email_suppressions
+ORDER BY created_at DESC
+LIMIT $1 OFFSET $2
+`
+
+type ListEmailSuppressionsParams struct {
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) ListEmailSuppressions(ctx context.Context, arg ListEmailSuppressionsParams) ([]EmailSuppression, error) {
+	rows, err := q.db.Query(ctx, listEmailSuppressions, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []EmailSuppression
+	for rows.Next() {
+		var i EmailSuppression
+		if err := rows.Scan(&i.Email, &i.Reason, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLoginsByUserID = `-- name: ListLoginsByUserID :many
+SELECT id, user_id, session_token, method, fingerprint, device_name, user_agent, ip_address, country, new_device, new_country, revoke_token, revoked_at, created_at FROM logins
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3
+`
+
+type ListLoginsByUserIDParams struct {
+	UserID pgtype.UUID
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) ListLoginsByUserID(ctx context.Context, arg ListLoginsByUserIDParams) ([]Login, error) {
+	rows, err := q.db.Query(ctx, listLoginsByUserID, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Login
+	for rows.Next() {
+		var i Login
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.SessionToken,
+			&i.Method,
+			&i.Fingerprint,
+			&i.DeviceName,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.Country,
+			&i.NewDevice,
+			&i.NewCountry,
+			&i.RevokeToken,
+			&i.RevokedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOutboxEmails = `-- name: ListOutboxEmails :many
+SELECT id, idempotency_key, recipient, template, subject, html, body_text, status, attempts, next_attempt_at, last_error, provider_message_id, created_at, sent_at, delivery_status, expires_at FROM email_outbox
+WHERE status = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3
+`
+
+type ListOutboxEmailsParams struct {
+	Status string
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) ListOutboxEmails(ctx context.Context, arg ListOutboxEmailsParams) ([]EmailOutbox, error) {
+	rows, err := q.db.Query(ctx, listOutboxEmails, arg.Status, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []EmailOutbox
+	for rows.Next() {
+		var i EmailOutbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.IdempotencyKey,
+			&i.Recipient,
+			&i.Template,
+			&i.Subject,
+			&i.Html,
+			&i.BodyText,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.ProviderMessageID,
+			&i.CreatedAt,
+			&i.SentAt,
+			&i.DeliveryStatus,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listProvidersByUserID = `-- name: ListProvidersByUserID :many
+SELECT id, user_id, provider_name, provider_account_id, created_at FROM providers WHERE user_id = $1 ORDER BY created_at
+`
+
+func (q *Queries) ListProvidersByUserID(ctx context.Context, userID pgtype.UUID) ([]Provider, error) {
+	rows, err := q.db.Query(ctx, listProvidersByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Provider
+	for rows.Next() {
+		var i Provider
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ProviderName,
+			&i.ProviderAccountID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSessionsByUserID = `-- name: ListSessionsByUserID :many
+SELECT token, expires_at, created_at, user_agent, ip_address, user_id FROM sessions WHERE user_id = $1 AND expires_at > NOW() ORDER BY expires_at DESC
+`
+
+func (q *Queries) ListSessionsByUserID(ctx context.Context, userID pgtype.UUID) ([]Session, error) {
+	rows, err := q.db.Query(ctx, listSessionsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Session
+	for rows.Next() {
+		var i Session
+		if err := rows.Scan(
+			&i.Token,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserDevicesByUserID = `-- name: ListUserDevicesByUserID :many
+SELECT id, user_id, fingerprint, name, first_seen_at, last_seen_at FROM user_devices
+WHERE user_id = $1
+ORDER BY last_seen_at DESC
+`
+
+func (q *Queries) ListUserDevicesByUserID(ctx context.Context, userID pgtype.UUID) ([]UserDevice, error) {
+	rows, err := q.db.Query(ctx, listUserDevicesByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserDevice
+	for rows.Next() {
+		var i UserDevice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Fingerprint,
+			&i.Name,
+			&i.FirstSeenAt,
+			&i.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserRoles = `-- name: ListUserRoles :many
+SELECT r.name FROM roles r
+JOIN user_roles ur ON ur.role_id = r.id
+WHERE ur.user_id = $1
+ORDER BY r.name
+`
+
+func (q *Queries) ListUserRoles(ctx context.Context, userID pgtype.UUID) ([]string, error) {
+	rows, err := q.db.Query(ctx, listUserRoles, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		items = append(items, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersDueForPurge = `-- name: ListUsersDueForPurge :many
+SELECT id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized FROM users
+WHERE status = 'pending_deletion' AND deletion_requested_at < $1::timestamptz
+ORDER BY deletion_requested_at
+LIMIT 100
+`
+
+func (q *Queries) ListUsersDueForPurge(ctx context.Context, cutoff pgtype.Timestamptz) ([]User, error) {
+	rows, err := q.db.Query(ctx, listUsersDueForPurge, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Email,
+			&i.CreatedAt,
+			&i.Status,
+			&i.DeletionRequestedAt,
+			&i.DisplayName,
+			&i.UsernameChangedAt,
+			&i.Locale,
+			&i.Phone,
+			&i.PhoneVerifiedAt,
+			&i.EmailNormalized,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markOutboxEmailFailed = `-- name: MarkOutboxEmailFailed :exec
+UPDATE email_outbox SET status = $2, next_attempt_at = $3, last_error = $4
+WHERE id = $1
+`
+
+type MarkOutboxEmailFailedParams struct {
+	ID            pgtype.UUID
+	Status        string
+	NextAttemptAt pgtype.Timestamptz
+	LastError     pgtype.Text
+}
+
+func (q *Queries) MarkOutboxEmailFailed(ctx context.Context, arg MarkOutboxEmailFailedParams) error {
+	_, err := q.db.Exec(ctx, markOutboxEmailFailed,
+		arg.ID,
+		arg.Status,
+		arg.NextAttemptAt,
+		arg.LastError,
+	)
+	return err
+}
+
+const markOutboxEmailSent = `-- name: MarkOutboxEmailSent :exec
+UPDATE email_outbox
+SET status = 'sent', sent_at = NOW(), provider_message_id = $2, last_error = NULL, html = '', body_text = ''
+WHERE id = $1
+`
+
+type MarkOutboxEmailSentParams struct {
+	ID                pgtype.UUID
+	ProviderMessageID pgtype.Text
+}
+
+func (q *Queries) MarkOutboxEmailSent(ctx context.Context, arg MarkOutboxEmailSentParams) error {
+	_, err := q.db.Exec(ctx, markOutboxEmailSent, arg.ID, arg.ProviderMessageID)
+	return err
+}
+
+const requestUserDeletion = `-- name: RequestUserDeletion :one
+UPDATE users SET status = 'pending_deletion', deletion_requested_at = NOW() WHERE id = $1
+RETURNING id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized
+`
+
+func (q *Queries) RequestUserDeletion(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, requestUserDeletion, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users SET status = 'active', deletion_requested_at = NULL
+WHERE id = $1 AND status = 'pending_deletion'
+RETURNING id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized
+`
+
+func (q *Queries) RestoreUser(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, restoreUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const retryDataExport = `-- name: RetryDataExport :exec
+UPDATE data_exports SET status = 'pending', lease_until = $2 WHERE id = $1
+`
+
+type RetryDataExportParams struct {
+	ID         pgtype.UUID
+	LeaseUntil pgtype.Timestamptz
+}
+
+func (q *Queries) RetryDataExport(ctx context.Context, arg RetryDataExportParams) error {
+	_, err := q.db.Exec(ctx, retryDataExport, arg.ID, arg.LeaseUntil)
+	return err
+}
+
+const retryOutboxEmail = `-- name: RetryOutboxEmail :one
+UPDATE email_outbox
+SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = NULL
+WHERE id = $1 AND status = 'dead' AND (expires_at IS NULL OR expires_at > NOW())
+RETURNING id, idempotency_key, recipient, template, subject, html, body_text, status, attempts, next_attempt_at, last_error, provider_message_id, created_at, sent_at, delivery_status, expires_at
+`
+
+func (q *Queries) RetryOutboxEmail(ctx context.Context, id pgtype.UUID) (EmailOutbox, error) {
+	row := q.db.QueryRow(ctx, retryOutboxEmail, id)
+	var i EmailOutbox
+	err := row.Scan(
+		&i.ID,
+		&i.IdempotencyKey,
+		&i.Recipient,
+		&i.Template,
+		&i.Subject,
+		&i.Html,
+		&i.BodyText,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastError,
+		&i.ProviderMessageID,
+		&i.CreatedAt,
+		&i.SentAt,
+		&i.DeliveryStatus,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const revertEmailChange = `-- name: RevertEmailChange :one
+DELETE FROM email_changes
+WHERE cancel_token = $1 AND completed_at IS NOT NULL AND revert_until > NOW()
+RETURNING id, user_id, new_email, otp, cancel_token, expires_at, created_at, old_email, old_email_normalized, completed_at, revert_until, attempts
+`
+
+func (q *Queries) RevertEmailChange(ctx context.Context, cancelToken pgtype.UUID) (EmailChange, error) {
+	row := q.db.QueryRow(ctx, revertEmailChange, cancelToken)
+	var i EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.NewEmail,
+		&i.Otp,
+		&i.CancelToken,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.OldEmail,
+		&i.OldEmailNormalized,
+		&i.CompletedAt,
+		&i.RevertUntil,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const revokeLogin = `-- name: RevokeLogin :one
+UPDATE logins SET revoked_at = NOW()
+WHERE revoke_token = $1 AND revoked_at IS NULL
+RETURNING id, user_id, session_token, method, fingerprint, device_name, user_agent, ip_address, country, new_device, new_country, revoke_token, revoked_at, created_at
+`
+
+func (q *Queries) RevokeLogin(ctx context.Context, revokeToken pgtype.UUID) (Login, error) {
+	row := q.db.QueryRow(ctx, revokeLogin, revokeToken)
+	var i Login
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.SessionToken,
+		&i.Method,
+		&i.Fingerprint,
+		&i.DeviceName,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.Country,
+		&i.NewDevice,
+		&i.NewCountry,
+		&i.RevokeToken,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const scrubAuditEventsForUser = `-- name: ScrubAuditEventsForUser :exec
+UPDATE audit_events SET ip_address = NULL, user_agent = NULL
+WHERE user_id = $1 OR actor_id = $1
+`
+
+func (q *Queries) ScrubAuditEventsForUser(ctx context.Context, userID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, scrubAuditEventsForUser, userID)
+	return err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized FROM users
+WHERE email ILIKE '%' || $1::text || '%' ESCAPE '\' OR username ILIKE '%' || $1::text || '%' ESCAPE '\'
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3
+`
+
+type SearchUsersParams struct {
+	Query  string
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, searchUsers, arg.Query, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Email,
+			&i.CreatedAt,
+			&i.Status,
+			&i.DeletionRequestedAt,
+			&i.DisplayName,
+			&i.UsernameChangedAt,
+			&i.Locale,
+			&i.Phone,
+			&i.PhoneVerifiedAt,
+			&i.EmailNormalized,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const suppressEmail = `-- name: SuppressEmail :exec
+INSERT INTO email_suppressions (email, reason)
+VALUES (LOWER($1::text), $2::text)
+ON CONFLICT (email) DO NOTHING
+`
+
+type SuppressEmailParams struct {
+	Email  string
+	Reason string
+}
+
+func (q *Queries) SuppressEmail(ctx context.Context, arg SuppressEmailParams) error {
+	_, err := q.db.Exec(ctx, suppressEmail, arg.Email, arg.Reason)
+	return err
+}
+
+const touchUserDevice = `-- name: TouchUserDevice :one
+UPDATE user_devices SET last_seen_at = NOW(), name = $1::text
+WHERE user_id = $2::uuid AND fingerprint = $3::text
+RETURNING id, user_id, fingerprint, name, first_seen_at, last_seen_at
+`
+
+type TouchUserDeviceParams struct {
+	Name        string
+	UserID      pgtype.UUID
+	Fingerprint string
+}
+
+func (q *Queries) TouchUserDevice(ctx context.Context, arg TouchUserDeviceParams) (UserDevice, error) {
+	row := q.db.QueryRow(ctx, touchUserDevice, arg.Name, arg.UserID, arg.Fingerprint)
+	var i UserDevice
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Fingerprint,
+		&i.Name,
+		&i.FirstSeenAt,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const updateDisplayName = `-- name: UpdateDisplayName :one
+UPDATE users SET display_name = $2 WHERE id = $1
+RETURNING id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized
+`
+
+type UpdateDisplayNameParams struct {
+	ID          pgtype.UUID
+	DisplayName pgtype.Text
+}
+
+func (q *Queries) UpdateDisplayName(ctx context.Context, arg UpdateDisplayNameParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateDisplayName, arg.ID, arg.DisplayName)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const updateOutboxDeliveryStatus = `-- name: UpdateOutboxDeliveryStatus :exec
+UPDATE email_outbox SET delivery_status = $2 WHERE id = $1
+`
+
+type UpdateOutboxDeliveryStatusParams struct {
+	ID             pgtype.UUID
+	DeliveryStatus pgtype.Text
+}
+
+func (q *Queries) UpdateOutboxDeliveryStatus(ctx context.Context, arg UpdateOutboxDeliveryStatusParams) error {
+	_, err := q.db.Exec(ctx, updateOutboxDeliveryStatus, arg.ID, arg.DeliveryStatus)
+	return err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
+UPDATE users SET email = $2, email_normalized = $3 WHERE id = $1
+RETURNING id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized
+`
+
+type UpdateUserEmailParams struct {
+	ID              pgtype.UUID
+	Email           string
+	EmailNormalized pgtype.Text
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserEmail, arg.ID, arg.Email, arg.EmailNormalized)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const updateUserLocale = `-- name: UpdateUserLocale :one
+UPDATE users SET locale = $2 WHERE id = $1
+RETURNING id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized
+`
+
+type UpdateUserLocaleParams struct {
+	ID     pgtype.UUID
+	Locale pgtype.Text
+}
+
+func (q *Queries) UpdateUserLocale(ctx context.Context, arg UpdateUserLocaleParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserLocale, arg.ID, arg.Locale)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const updateUserPhone = `-- name: UpdateUserPhone :one
+UPDATE users SET phone = $2, phone_verified_at = NOW() WHERE id = $1
+RETURNING id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized
+`
+
+type UpdateUserPhoneParams struct {
+	ID    pgtype.UUID
+	Phone pgtype.Text
+}
+
+func (q *Queries) UpdateUserPhone(ctx context.Context, arg UpdateUserPhoneParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserPhone, arg.ID, arg.Phone)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const updateUserStatus = `-- name: UpdateUserStatus :one
+UPDATE users SET status = $2 WHERE id = $1
+RETURNING id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized
+`
+
+type UpdateUserStatusParams struct {
+	ID     pgtype.UUID
+	Status string
+}
+
+func (q *Queries) UpdateUserStatus(ctx context.Context, arg UpdateUserStatusParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserStatus, arg.ID, arg.Status)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const updateUsername = `-- name: UpdateUsername :one
+UPDATE users SET username = $2, username_changed_at = NOW() WHERE id = $1
+RETURNING id, username, email, created_at, status, deletion_requested_at, display_name, username_changed_at, locale, phone, phone_verified_at, email_normalized
+`
+
+type UpdateUsernameParams struct {
+	ID       pgtype.UUID
+	Username string
+}
+
+func (q *Queries) UpdateUsername(ctx context.Context, arg UpdateUsernameParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUsername, arg.ID, arg.Username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.CreatedAt,
+		&i.Status,
+		&i.DeletionRequestedAt,
+		&i.DisplayName,
+		&i.UsernameChangedAt,
+		&i.Locale,
+		&i.Phone,
+		&i.PhoneVerifiedAt,
+		&i.EmailNormalized,
+	)
+	return i, err
+}
+
+const userHasPermission = `-- name: UserHasPermission :one
+SELECT EXISTS (
+  SELECT 1 FROM user_roles ur
+  JOIN role_permissions rp ON rp.role_id = ur.role_id
+  JOIN permissions p ON p.id = rp.permission_id
+  WHERE ur.user_id = $1 AND p.name = $2
+)
+`
+
+type UserHasPermissionParams struct {
+	UserID pgtype.UUID
+	Name   string
+}
+
+func (q *Queries) UserHasPermission(ctx context.Context, arg UserHasPermissionParams) (bool, error) {
+	row := q.db.QueryRow(ctx, userHasPermission, arg.UserID, arg.Name)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
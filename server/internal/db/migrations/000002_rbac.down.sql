@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
+ALTER TABLE users DROP COLUMN IF EXISTS status;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_pending_deletion_idx;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_requested_at;
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN deletion_requested_at TIMESTAMPTZ;
+
+ALTER TABLE users ADD CONSTRAINT users_status_check
+  CHECK (status IN ('active', 'disabled', 'pending_deletion'));
+
+CREATE INDEX users_pending_deletion_idx ON users (deletion_requested_at)
+  WHERE status = 'pending_deletion';
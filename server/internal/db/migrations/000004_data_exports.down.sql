@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS data_exports;
+ALTER TABLE sessions
+  DROP COLUMN IF EXISTS ip_address,
+  DROP COLUMN IF EXISTS user_agent,
+  DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,16 @@
+ALTER TABLE sessions
+  ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  ADD COLUMN user_agent TEXT,
+  ADD COLUMN ip_address TEXT;
+
+CREATE TABLE data_exports (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  format TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending',
+  data BYTEA,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS email_changes;
+
+ALTER TABLE sessions ADD COLUMN email TEXT;
+
+UPDATE sessions s SET email = u.email FROM users u WHERE u.id = s.user_id;
+
+ALTER TABLE sessions ALTER COLUMN email SET NOT NULL;
+DROP INDEX IF EXISTS sessions_user_id_idx;
+ALTER TABLE sessions DROP COLUMN user_id;
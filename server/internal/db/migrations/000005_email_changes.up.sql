@@ -0,0 +1,22 @@
+ALTER TABLE sessions ADD COLUMN user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+
+UPDATE sessions s SET user_id = u.id FROM users u WHERE u.email = s.email;
+
+DELETE FROM sessions WHERE user_id IS NULL;
+
+ALTER TABLE sessions ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE sessions DROP COLUMN email;
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+CREATE TABLE email_changes (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  new_email TEXT NOT NULL,
+  otp TEXT NOT NULL,
+  cancel_token UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX email_changes_user_id_idx ON email_changes (user_id);
@@ -0,0 +1,15 @@
+ALTER TABLE users
+  ADD COLUMN display_name TEXT,
+  ADD COLUMN username_changed_at TIMESTAMPTZ;
+
+-- Usernames were derived from email local parts, so different domains could
+-- collide. Keep the oldest and suffix the rest before enforcing uniqueness.
+UPDATE users u
+SET username = LOWER(u.username) || '_' || SUBSTR(MD5(u.id::text), 1, 6)
+FROM (
+  SELECT id, ROW_NUMBER() OVER (PARTITION BY LOWER(username) ORDER BY created_at) AS rn
+  FROM users
+) d
+WHERE d.id = u.id AND d.rn > 1;
+
+CREATE UNIQUE INDEX users_username_lower_idx ON users (LOWER(username));
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE name IN ('origins:read', 'origins:write');
+DROP TABLE IF EXISTS app_origins;
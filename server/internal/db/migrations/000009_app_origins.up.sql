@@ -0,0 +1,12 @@
+CREATE TABLE app_origins (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  origin TEXT NOT NULL UNIQUE,
+  app_name TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO permissions (name) VALUES ('origins:read'), ('origins:write');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin' AND p.name IN ('origins:read', 'origins:write');
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE name IN ('emails:read', 'emails:write');
+DROP TABLE IF EXISTS email_outbox;
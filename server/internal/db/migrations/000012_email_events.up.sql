@@ -0,0 +1,25 @@
+ALTER TABLE email_outbox ADD COLUMN delivery_status TEXT;
+
+CREATE INDEX email_outbox_provider_message_id_idx ON email_outbox (provider_message_id);
+
+CREATE TABLE email_events (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  provider TEXT NOT NULL,
+  webhook_id TEXT NOT NULL,
+  outbox_id UUID REFERENCES email_outbox(id) ON DELETE SET NULL,
+  provider_message_id TEXT NOT NULL,
+  type TEXT NOT NULL,
+  recipient TEXT NOT NULL,
+  detail TEXT,
+  occurred_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (provider, webhook_id)
+);
+
+CREATE INDEX email_events_outbox_id_idx ON email_events (outbox_id);
+
+CREATE TABLE email_suppressions (
+  email TEXT PRIMARY KEY,
+  reason TEXT NOT NULL CHECK (reason IN ('bounced', 'complained')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN phone TEXT UNIQUE;
+ALTER TABLE users ADD COLUMN phone_verified_at TIMESTAMPTZ;
+
+CREATE TABLE phone_otps (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  phone TEXT NOT NULL,
+  otp TEXT NOT NULL,
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX phone_otps_phone_idx ON phone_otps (phone);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS email_duplicates;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_normalized_key;
+ALTER TABLE users DROP COLUMN IF EXISTS email_normalized;
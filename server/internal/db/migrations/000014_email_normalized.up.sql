@@ -0,0 +1,41 @@
+ALTER TABLE users ADD COLUMN email_normalized TEXT;
+
+-- Existing addresses were limited to ASCII, so lowercasing them gives the
+-- same result as the default normalization rules.
+UPDATE users SET email_normalized = LOWER(email);
+
+-- Accounts created before normalization may differ only in case. The
+-- oldest account of each group keeps the normalized address; the others
+-- are recorded here for an admin to resolve and keep a NULL normalized
+-- address, so they can still sign in with their exact address.
+CREATE TABLE email_duplicates (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  email_normalized TEXT NOT NULL,
+  kept_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  detected_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO email_duplicates (user_id, email, email_normalized, kept_user_id)
+SELECT id, email, email_normalized, kept_user_id
+FROM (
+  SELECT id, email, email_normalized,
+    FIRST_VALUE(id) OVER (PARTITION BY email_normalized ORDER BY created_at, id) AS kept_user_id
+  FROM users
+) ranked
+WHERE id <> kept_user_id;
+
+UPDATE users SET email_normalized = NULL
+WHERE id IN (SELECT user_id FROM email_duplicates);
+
+DO $$
+DECLARE
+  duplicates INTEGER;
+BEGIN
+  SELECT COUNT(*) INTO duplicates FROM email_duplicates;
+  IF duplicates > 0 THEN
+    RAISE WARNING '% accounts share a normalized email with an older account. Run `katanaid email-duplicates` to list them.', duplicates;
+  END IF;
+END $$;
+
+ALTER TABLE users ADD CONSTRAINT users_email_normalized_key UNIQUE (email_normalized);
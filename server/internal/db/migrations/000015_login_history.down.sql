@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS logins;
+DROP TABLE IF EXISTS user_devices;
@@ -0,0 +1,28 @@
+CREATE TABLE user_devices (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  fingerprint TEXT NOT NULL,
+  name TEXT NOT NULL,
+  first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (user_id, fingerprint)
+);
+
+CREATE TABLE logins (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  session_token UUID REFERENCES sessions(token) ON DELETE SET NULL,
+  method TEXT NOT NULL,
+  fingerprint TEXT NOT NULL,
+  device_name TEXT NOT NULL,
+  user_agent TEXT,
+  ip_address TEXT,
+  country TEXT,
+  new_device BOOLEAN NOT NULL DEFAULT FALSE,
+  new_country BOOLEAN NOT NULL DEFAULT FALSE,
+  revoke_token UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX logins_user_id_created_at_idx ON logins (user_id, created_at);
@@ -0,0 +1,3 @@
+ALTER TABLE data_exports
+  DROP COLUMN IF EXISTS lease_until,
+  DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,3 @@
+ALTER TABLE data_exports
+  ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN lease_until TIMESTAMPTZ NOT NULL DEFAULT NOW();
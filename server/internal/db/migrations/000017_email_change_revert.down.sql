@@ -0,0 +1,7 @@
+DELETE FROM email_changes WHERE completed_at IS NOT NULL;
+
+ALTER TABLE email_changes
+  DROP COLUMN IF EXISTS revert_until,
+  DROP COLUMN IF EXISTS completed_at,
+  DROP COLUMN IF EXISTS old_email_normalized,
+  DROP COLUMN IF EXISTS old_email;
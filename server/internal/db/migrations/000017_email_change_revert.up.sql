@@ -0,0 +1,5 @@
+ALTER TABLE email_changes
+  ADD COLUMN old_email TEXT,
+  ADD COLUMN old_email_normalized TEXT,
+  ADD COLUMN completed_at TIMESTAMPTZ,
+  ADD COLUMN revert_until TIMESTAMPTZ;
@@ -0,0 +1,6 @@
+ALTER TABLE email_outbox ADD COLUMN expires_at TIMESTAMPTZ;
+
+UPDATE email_outbox SET expires_at = created_at + INTERVAL '15 minutes'
+WHERE template IN ('otp', 'email_change_code');
+
+UPDATE email_outbox SET html = '', body_text = '' WHERE status = 'sent';
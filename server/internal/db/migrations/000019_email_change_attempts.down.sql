@@ -0,0 +1,2 @@
+ALTER TABLE email_changes
+  DROP COLUMN IF EXISTS attempts;
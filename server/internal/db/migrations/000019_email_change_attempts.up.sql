@@ -0,0 +1,2 @@
+ALTER TABLE email_changes
+  ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
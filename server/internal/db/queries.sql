@@ -1,22 +1,34 @@
 -- name: CreateUser :one
-INSERT INTO users (username, email)
-VALUES ($1, $2)
+INSERT INTO users (username, email, email_normalized)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING
 RETURNING *;
 
--- name: CreateOTP :exec
+-- name: CreateOTP :one
 INSERT INTO otps (email, otp, expires_at)
-VALUES ($1, $2, $3);
+VALUES ($1, $2, $3)
+RETURNING *;
 
 -- name: CreateSession :one
-INSERT INTO sessions (email, expires_at)
-VALUES ($1, $2)
+INSERT INTO sessions (user_id, expires_at, user_agent, ip_address)
+VALUES ($1, $2, $3, $4)
 RETURNING *;
 
 -- name: GetUserByEmail :one
-SELECT * FROM users WHERE email = $1 LIMIT 1;
+SELECT * FROM users
+WHERE email = @email::text OR email_normalized = @email_normalized::text
+ORDER BY email = @email::text DESC
+LIMIT 1;
 
--- name: GetOTPByEmail :one
-SELECT * FROM otps WHERE email = $1 AND expires_at > NOW() ORDER BY expires_at DESC LIMIT 1;
+-- name: ConsumeOTP :one
+DELETE FROM otps
+WHERE id = (
+  SELECT id FROM otps
+  WHERE email = $1 AND expires_at > NOW()
+  ORDER BY expires_at DESC
+  LIMIT 1
+) AND otp = $2
+RETURNING *;
 
 -- name: DeleteOTPsByEmail :exec
 DELETE FROM otps WHERE email = $1;
@@ -30,4 +42,386 @@ RETURNING *;
 SELECT * FROM sessions WHERE token = $1 AND expires_at > NOW();
 
 -- name: DeleteSessionByToken :exec
-DELETE FROM sessions WHERE token = $1;
\ No newline at end of file
+DELETE FROM sessions WHERE token = $1;
+
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1 LIMIT 1;
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE email ILIKE '%' || @query::text || '%' ESCAPE '\' OR username ILIKE '%' || @query::text || '%' ESCAPE '\'
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: UpdateUserStatus :one
+UPDATE users SET status = $2 WHERE id = $1
+RETURNING *;
+
+-- name: ListSessionsByUserID :many
+SELECT * FROM sessions WHERE user_id = $1 AND expires_at > NOW() ORDER BY expires_at DESC;
+
+-- name: DeleteSessionsByUserID :exec
+DELETE FROM sessions WHERE user_id = $1;
+
+-- name: DeleteOtherSessions :exec
+DELETE FROM sessions WHERE user_id = $1 AND token <> $2;
+
+-- name: ListProvidersByUserID :many
+SELECT * FROM providers WHERE user_id = $1 ORDER BY created_at;
+
+-- name: AssignRole :exec
+INSERT INTO user_roles (user_id, role_id)
+SELECT @user_id::uuid, id FROM roles WHERE name = @role_name
+ON CONFLICT DO NOTHING;
+
+-- name: ListUserRoles :many
+SELECT r.name FROM roles r
+JOIN user_roles ur ON ur.role_id = r.id
+WHERE ur.user_id = $1
+ORDER BY r.name;
+
+-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM user_roles ur
+JOIN roles r ON r.id = ur.role_id
+WHERE r.name = $1;
+
+-- name: UserHasPermission :one
+SELECT EXISTS (
+  SELECT 1 FROM user_roles ur
+  JOIN role_permissions rp ON rp.role_id = ur.role_id
+  JOIN permissions p ON p.id = rp.permission_id
+  WHERE ur.user_id = $1 AND p.name = $2
+);
+
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (user_id, actor_id, action, ip_address, user_agent)
+VALUES ($1, $2, $3, $4, $5);
+
+
+-- name: RequestUserDeletion :one
+UPDATE users SET status = 'pending_deletion', deletion_requested_at = NOW() WHERE id = $1
+RETURNING *;
+
+-- name: RestoreUser :one
+UPDATE users SET status = 'active', deletion_requested_at = NULL
+WHERE id = $1 AND status = 'pending_deletion'
+RETURNING *;
+
+-- name: ListUsersDueForPurge :many
+SELECT * FROM users
+WHERE status = 'pending_deletion' AND deletion_requested_at < @cutoff::timestamptz
+ORDER BY deletion_requested_at
+LIMIT 100;
+
+-- name: ScrubAuditEventsForUser :exec
+UPDATE audit_events SET ip_address = NULL, user_agent = NULL
+WHERE user_id = $1 OR actor_id = $1;
+
+-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1;
+
+-- name: ListAuditEventsByUser :many
+SELECT * FROM audit_events WHERE user_id = $1 ORDER BY created_at;
+
+-- name: CountAuditEventsByUser :one
+SELECT COUNT(*) FROM audit_events WHERE user_id = $1;
+
+-- name: CreateDataExport :one
+INSERT INTO data_exports (user_id, format, expires_at)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports SET status = 'ready', data = $2 WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports SET status = 'failed' WHERE id = $1;
+
+-- name: ClaimDataExports :many
+UPDATE data_exports
+SET status = 'running', attempts = attempts + 1, lease_until = @lease_until
+WHERE id IN (
+  SELECT id FROM data_exports
+  WHERE status IN ('pending', 'running') AND lease_until <= NOW() AND expires_at > NOW()
+  ORDER BY created_at
+  LIMIT @batch_size::int
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RetryDataExport :exec
+UPDATE data_exports SET status = 'pending', lease_until = $2 WHERE id = $1;
+
+-- name: GetDataExport :one
+SELECT * FROM data_exports WHERE id = $1 AND user_id = $2 AND expires_at > NOW();
+
+-- name: DeleteExpiredDataExports :exec
+DELETE FROM data_exports WHERE expires_at <= NOW();
+
+-- name: CreateEmailChange :one
+INSERT INTO email_changes (user_id, new_email, otp, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: FailEmailChangeAttempt :one
+UPDATE email_changes SET attempts = attempts + 1
+WHERE id = (
+  SELECT id FROM email_changes
+  WHERE user_id = $1 AND completed_at IS NULL AND expires_at > NOW()
+  ORDER BY created_at DESC LIMIT 1
+)
+RETURNING attempts;
+
+-- name: DeletePendingEmailChanges :exec
+DELETE FROM email_changes WHERE user_id = $1 AND completed_at IS NULL;
+
+-- name: CompleteEmailChange :one
+UPDATE email_changes
+SET completed_at = NOW(), old_email = @old_email, old_email_normalized = @old_email_normalized, revert_until = @revert_until
+WHERE id = (
+  SELECT id FROM email_changes
+  WHERE user_id = @user_id AND completed_at IS NULL AND expires_at > NOW()
+  ORDER BY created_at DESC LIMIT 1
+  FOR UPDATE
+) AND otp = @otp AND attempts < @max_attempts::int
+RETURNING *;
+
+-- name: GetEmailChangeByCancelToken :one
+SELECT * FROM email_changes
+WHERE cancel_token = $1 AND (completed_at IS NULL OR revert_until > NOW());
+
+-- name: CancelEmailChange :one
+DELETE FROM email_changes WHERE cancel_token = $1 AND completed_at IS NULL
+RETURNING *;
+
+-- name: RevertEmailChange :one
+DELETE FROM email_changes
+WHERE cancel_token = $1 AND completed_at IS NOT NULL AND revert_until > NOW()
+RETURNING *;
+
+-- name: DeleteEmailChangesSince :exec
+DELETE FROM email_changes WHERE user_id = $1 AND created_at >= $2;
+
+-- name: DeleteExpiredEmailChanges :exec
+DELETE FROM email_changes
+WHERE (completed_at IS NULL AND expires_at <= NOW()) OR revert_until <= NOW();
+
+-- name: UpdateUserEmail :one
+UPDATE users SET email = $2, email_normalized = $3 WHERE id = $1
+RETURNING *;
+
+-- name: IsUsernameTaken :one
+SELECT EXISTS (
+  SELECT 1 FROM users WHERE LOWER(username) = LOWER(@username::text)
+);
+
+-- name: UpdateUsername :one
+UPDATE users SET username = $2, username_changed_at = NOW() WHERE id = $1
+RETURNING *;
+
+-- name: UpdateDisplayName :one
+UPDATE users SET display_name = $2 WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserLocale :one
+UPDATE users SET locale = $2 WHERE id = $1
+RETURNING *;
+
+-- name: IncrementRateLimit :one
+INSERT INTO rate_limits (key, window_start, count, expires_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (key, window_start) DO UPDATE SET count = rate_limits.count + EXCLUDED.count
+RETURNING count;
+
+-- name: GetRateLimit :one
+SELECT count FROM rate_limits WHERE key = $1 AND window_start = $2;
+
+-- name: DeleteExpiredRateLimits :exec
+DELETE FROM rate_limits WHERE expires_at < NOW();
+
+-- name: ListAppOrigins :many
+SELECT * FROM app_origins ORDER BY created_at;
+
+-- name: CreateAppOrigin :one
+INSERT INTO app_origins (origin, app_name)
+VALUES ($1, $2)
+ON CONFLICT (origin) DO NOTHING
+RETURNING *;
+
+-- name: DeleteAppOrigin :execrows
+DELETE FROM app_origins WHERE id = $1;
+
+-- name: CreateOutboxEmail :one
+INSERT INTO email_outbox (idempotency_key, recipient, template, subject, html, body_text, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (idempotency_key) DO NOTHING
+RETURNING *;
+
+-- name: ClaimOutboxEmails :many
+UPDATE email_outbox
+SET status = 'sending', attempts = attempts + 1, next_attempt_at = @lease_until
+WHERE id IN (
+  SELECT id FROM email_outbox
+  WHERE status IN ('pending', 'sending') AND next_attempt_at <= NOW()
+    AND (expires_at IS NULL OR expires_at > NOW())
+  ORDER BY next_attempt_at
+  LIMIT @batch_size::int
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkOutboxEmailSent :exec
+UPDATE email_outbox
+SET status = 'sent', sent_at = NOW(), provider_message_id = $2, last_error = NULL, html = '', body_text = ''
+WHERE id = $1;
+
+-- name: ExpireOutboxEmails :execrows
+UPDATE email_outbox
+SET status = 'dead', last_error = 'expired before it could be sent', html = '', body_text = ''
+WHERE expires_at <= NOW()
+  AND (status = 'pending' OR (status = 'sending' AND next_attempt_at <= NOW()));
+
+-- name: MarkOutboxEmailFailed :exec
+UPDATE email_outbox SET status = $2, next_attempt_at = $3, last_error = $4
+WHERE id = $1;
+
+-- name: ListOutboxEmails :many
+SELECT * FROM email_outbox
+WHERE status = sqlc.arg('status')
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: RetryOutboxEmail :one
+UPDATE email_outbox
+SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = NULL
+WHERE id = $1 AND status = 'dead' AND (expires_at IS NULL OR expires_at > NOW())
+RETURNING *;
+
+-- name: DeleteSentOutboxEmails :execrows
+DELETE FROM email_outbox WHERE status = 'sent' AND sent_at < $1;
+
+-- name: GetOutboxEmailByProviderMessageID :one
+SELECT * FROM email_outbox WHERE provider_message_id = $1 LIMIT 1;
+
+-- name: UpdateOutboxDeliveryStatus :exec
+UPDATE email_outbox SET delivery_status = $2 WHERE id = $1;
+
+-- name: CreateEmailEvent :one
+INSERT INTO email_events (provider, webhook_id, outbox_id, provider_message_id, type, recipient, detail, occurred_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (provider, webhook_id) DO NOTHING
+RETURNING *;
+
+-- name: SuppressEmail :exec
+INSERT INTO email_suppressions (email, reason)
+VALUES (LOWER(@email::text), @reason::text)
+ON CONFLICT (email) DO NOTHING;
+
+-- name: IsEmailSuppressed :one
+SELECT EXISTS (
+  SELECT 1 FROM email_suppressions WHERE email = LOWER(@email::text)
+);
+
+-- name: ListEmailSuppressions :many
+SELECT * FROM email_suppressions
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: DeleteEmailSuppression :execrows
+DELETE FROM email_suppressions WHERE email = LOWER(@email::text);
+
+-- name: CreatePhoneOTP :one
+INSERT INTO phone_otps (phone, otp, user_id, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: ConsumePhoneOTP :one
+DELETE FROM phone_otps
+WHERE id = (
+  SELECT id FROM phone_otps
+  WHERE phone = @phone::text AND user_id IS NOT DISTINCT FROM @user_id::uuid AND expires_at > NOW()
+  ORDER BY expires_at DESC
+  LIMIT 1
+) AND otp = @otp::text
+RETURNING *;
+
+-- name: DeletePhoneOTPs :exec
+DELETE FROM phone_otps WHERE phone = $1;
+
+-- name: GetUserByPhone :one
+SELECT * FROM users WHERE phone = @phone::text LIMIT 1;
+
+-- name: UpdateUserPhone :one
+UPDATE users SET phone = $2, phone_verified_at = NOW() WHERE id = $1
+RETURNING *;
+
+-- name: ClearUserPhone :one
+UPDATE users SET phone = NULL, phone_verified_at = NULL WHERE id = $1
+RETURNING *;
+
+-- name: ListEmailDuplicates :many
+SELECT * FROM email_duplicates
+WHERE user_id IN (SELECT id FROM users WHERE email_normalized IS NULL)
+ORDER BY email_normalized, detected_at;
+
+-- name: TouchUserDevice :one
+UPDATE user_devices SET last_seen_at = NOW(), name = @name::text
+WHERE user_id = @user_id::uuid AND fingerprint = @fingerprint::text
+RETURNING *;
+
+-- name: CreateUserDevice :one
+INSERT INTO user_devices (user_id, fingerprint, name)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, fingerprint) DO NOTHING
+RETURNING *;
+
+-- name: ListUserDevicesByUserID :many
+SELECT * FROM user_devices
+WHERE user_id = $1
+ORDER BY last_seen_at DESC;
+
+-- name: DeleteUserDevice :exec
+DELETE FROM user_devices WHERE user_id = $1 AND fingerprint = $2;
+
+-- name: HasLogins :one
+SELECT EXISTS (
+  SELECT 1 FROM logins WHERE user_id = $1
+);
+
+-- name: IsNewLoginCountry :one
+SELECT EXISTS (
+  SELECT 1 FROM logins WHERE user_id = @user_id::uuid AND country IS NOT NULL
+) AND NOT EXISTS (
+  SELECT 1 FROM logins WHERE user_id = @user_id::uuid AND country = @country::text
+);
+
+-- name: CreateLogin :one
+INSERT INTO logins (user_id, session_token, method, fingerprint, device_name, user_agent, ip_address, country, new_device, new_country)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING *;
+
+-- name: ListLoginsByUserID :many
+SELECT * FROM logins
+WHERE user_id = sqlc.arg('user_id')
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: ListAllLoginsByUserID :many
+SELECT * FROM logins
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetLoginByRevokeToken :one
+SELECT * FROM logins
+WHERE revoke_token = $1 AND revoked_at IS NULL;
+
+-- name: RevokeLogin :one
+UPDATE logins SET revoked_at = NOW()
+WHERE revoke_token = $1 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: DeleteOldLogins :exec
+DELETE FROM logins WHERE created_at < $1;
+
+-- name: DeleteStaleUserDevices :exec
+DELETE FROM user_devices WHERE last_seen_at < $1;
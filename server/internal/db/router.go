@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/util"
+)
+
+// primaryCookie marks a client whose recent writes may not have reached the
+// replica yet.
+const primaryCookie = "db_primary"
+
+var _ gendb.DBTX = (*Router)(nil)
+
+// Router sends read-only statements to a replica and everything else to the
+// primary. A read that fails on the replica is retried on the primary, and
+// reads are kept on the primary when the context asks for it (see
+// WithPrimary and ReadYourWrites).
+type Router struct {
+	primary *pgxpool.Pool
+	replica *pgxpool.Pool
+}
+
+func NewRouter(primary, replica *pgxpool.Pool) *Router {
+	return &Router{primary: primary, replica: replica}
+}
+
+func (r *Router) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	MarkWrite(ctx)
+
+	return r.primary.Exec(ctx, sql, args...)
+}
+
+func (r *Router) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if !r.useReplica(ctx, sql) {
+		return r.primary.Query(ctx, sql, args...)
+	}
+
+	rows, err := r.replica.Query(ctx, sql, args...)
+	if err != nil && ctx.Err() == nil {
+		replicaFailed(sql, err)
+		return r.primary.Query(ctx, sql, args...)
+	}
+
+	return rows, err
+}
+
+func (r *Router) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if !r.useReplica(ctx, sql) {
+		return r.primary.QueryRow(ctx, sql, args...)
+	}
+
+	return fallbackRow{
+		row: r.replica.QueryRow(ctx, sql, args...),
+		fallback: func() pgx.Row {
+			return r.primary.QueryRow(ctx, sql, args...)
+		},
+		ctx: ctx,
+		sql: sql,
+	}
+}
+
+// useReplica reports whether sql may run on the replica, marking the context
+// as having written when it may not. Once a request has written, the rest of
+// its reads stay on the primary too.
+func (r *Router) useReplica(ctx context.Context, sql string) bool {
+	if !isReadOnly(sql) {
+		MarkWrite(ctx)
+		return false
+	}
+
+	return !primaryRequested(ctx) && !wrote(ctx)
+}
+
+// fallbackRow retries the read on the primary when scanning the replica's
+// row fails for any reason other than there being no row.
+type fallbackRow struct {
+	row      pgx.Row
+	fallback func() pgx.Row
+	ctx      context.Context
+	sql      string
+}
+
+func (r fallbackRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if err == nil || errors.Is(err, pgx.ErrNoRows) || r.ctx.Err() != nil {
+		return err
+	}
+
+	replicaFailed(r.sql, err)
+	return r.fallback().Scan(dest...)
+}
+
+func replicaFailed(sql string, err error) {
+	Metrics.Add("replica_fallbacks", 1)
+	log.Print("⚠️  Replica query ", queryName(sql), " failed, retrying on primary: ", err)
+}
+
+// isReadOnly reports whether sql is a plain SELECT. Locking reads and
+// anything else, including CTEs that may write, go to the primary.
+func isReadOnly(sql string) bool {
+	for {
+		sql = strings.TrimSpace(sql)
+		if !strings.HasPrefix(sql, "--") {
+			break
+		}
+		_, sql, _ = strings.Cut(sql, "\n")
+	}
+
+	upper := strings.ToUpper(sql)
+	return strings.HasPrefix(upper, "SELECT") &&
+		!strings.Contains(upper, " FOR UPDATE") &&
+		!strings.Contains(upper, " FOR SHARE")
+}
+
+type primaryKey struct{}
+
+type writeTrackerKey struct{}
+
+type writeTracker struct {
+	wrote atomic.Bool
+}
+
+// WithPrimary returns a context whose reads go to the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// MarkWrite records that the request behind ctx wrote to the primary, so
+// ReadYourWrites pins the client's next reads there. Statements run through
+// a Router are marked automatically; transactions opened on the pool should
+// call it themselves.
+func MarkWrite(ctx context.Context) {
+	if tracker, ok := ctx.Value(writeTrackerKey{}).(*writeTracker); ok {
+		tracker.wrote.Store(true)
+	}
+}
+
+func wrote(ctx context.Context) bool {
+	tracker, ok := ctx.Value(writeTrackerKey{}).(*writeTracker)
+	return ok && tracker.wrote.Load()
+}
+
+func primaryRequested(ctx context.Context) bool {
+	pinned, _ := ctx.Value(primaryKey{}).(bool)
+	return pinned
+}
+
+// ReadYourWrites keeps a client's reads on the primary for window after a
+// request of theirs wrote, so a session created by one request is visible
+// to the next one even if the replica lags. It does so with a short-lived
+// cookie, so it applies across replicas of the server too.
+func ReadYourWrites(window time.Duration, cookies util.Cookies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if _, err := cookies.Get(r, primaryCookie); err == nil {
+				ctx = WithPrimary(ctx)
+			}
+
+			tracker := &writeTracker{}
+			ctx = context.WithValue(ctx, writeTrackerKey{}, tracker)
+
+			next.ServeHTTP(&stickyWriter{ResponseWriter: w, tracker: tracker, window: window, cookies: cookies}, r.WithContext(ctx))
+		})
+	}
+}
+
+// stickyWriter sets the primary cookie before the response goes out if the
+// request wrote anything by then.
+type stickyWriter struct {
+	http.ResponseWriter
+	tracker     *writeTracker
+	window      time.Duration
+	cookies     util.Cookies
+	wroteHeader bool
+}
+
+func (w *stickyWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.tracker.wrote.Load() {
+			w.cookies.Set(w.ResponseWriter, primaryCookie, "1", w.window, true)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *stickyWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *stickyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/trnahnh/katana-id/util"
+)
+
+func TestIsReadOnly(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"SELECT * FROM users WHERE id = $1", true},
+		{"-- name: GetSession :one\nSELECT * FROM sessions", true},
+		{"  select 1", true},
+		{"SELECT * FROM otps WHERE id = $1 FOR UPDATE SKIP LOCKED", false},
+		{"SELECT * FROM users FOR SHARE", false},
+		{"INSERT INTO otps (email) VALUES ($1)", false},
+		{"WITH deleted AS (DELETE FROM otps RETURNING *) SELECT * FROM deleted", false},
+		{"-- name: DeleteOTP :exec\nDELETE FROM otps", false},
+	}
+
+	for _, tt := range tests {
+		if got := isReadOnly(tt.sql); got != tt.want {
+			t.Errorf("isReadOnly(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestUseReplica(t *testing.T) {
+	r := &Router{}
+	read := "SELECT * FROM sessions"
+
+	if !r.useReplica(context.Background(), read) {
+		t.Error("read without a request went to the primary")
+	}
+	if r.useReplica(WithPrimary(context.Background()), read) {
+		t.Error("read pinned to the primary went to the replica")
+	}
+
+	ctx := context.WithValue(context.Background(), writeTrackerKey{}, &writeTracker{})
+	if !r.useReplica(ctx, read) {
+		t.Error("read before any write went to the primary")
+	}
+	if r.useReplica(ctx, "INSERT INTO sessions DEFAULT VALUES") {
+		t.Error("write went to the replica")
+	}
+	if r.useReplica(ctx, read) {
+		t.Error("read after a write in the same request went to the replica")
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	tests := []struct {
+		name       string
+		write      bool
+		cookie     bool
+		wantCookie bool
+		wantPinned bool
+	}{
+		{name: "read"},
+		{name: "write", write: true, wantCookie: true},
+		{name: "read after write", cookie: true, wantPinned: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pinned bool
+			handler := ReadYourWrites(5*time.Second, util.Cookies{Dev: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				pinned = primaryRequested(r.Context())
+				if tt.write {
+					MarkWrite(r.Context())
+				}
+				w.Write([]byte("ok"))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: primaryCookie, Value: "1"})
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if pinned != tt.wantPinned {
+				t.Errorf("pinned to primary = %v, want %v", pinned, tt.wantPinned)
+			}
+			var gotCookie bool
+			for _, cookie := range rec.Result().Cookies() {
+				gotCookie = gotCookie || cookie.Name == primaryCookie
+			}
+			if gotCookie != tt.wantCookie {
+				t.Errorf("primary cookie set = %v, want %v", gotCookie, tt.wantCookie)
+			}
+		})
+	}
+}
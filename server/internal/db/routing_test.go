@@ -0,0 +1,118 @@
+package db_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trnahnh/katana-id/internal/db"
+	"github.com/trnahnh/katana-id/internal/db/dbtest"
+	"github.com/trnahnh/katana-id/util"
+)
+
+// servedBy reports which of the two databases answered a read run through
+// router with ctx.
+func servedBy(t *testing.T, ctx context.Context, router *db.Router, primary *pgxpool.Pool) string {
+	t.Helper()
+
+	var want, got string
+	if err := primary.QueryRow(context.Background(), "SELECT current_database()").Scan(&want); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.QueryRow(ctx, "SELECT current_database()").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got == want {
+		return "primary"
+	}
+	return "replica"
+}
+
+func TestRouterPostgres(t *testing.T) {
+	primary := dbtest.New(t)
+	replica := dbtest.NewReplica(t)
+	router := db.NewRouter(primary, replica)
+	ctx := context.Background()
+
+	if got := servedBy(t, ctx, router, primary); got != "replica" {
+		t.Errorf("read served by %s, want replica", got)
+	}
+	if got := servedBy(t, db.WithPrimary(ctx), router, primary); got != "primary" {
+		t.Errorf("read pinned to the primary served by %s", got)
+	}
+
+	// A write only lands on the primary.
+	if _, err := router.Exec(ctx, "INSERT INTO rate_limits (key, window_start, count, expires_at) VALUES ('k', NOW(), 1, NOW())"); err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	if err := replica.QueryRow(ctx, "SELECT COUNT(*) FROM rate_limits").Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 0 {
+		t.Error("write reached the replica")
+	}
+}
+
+func TestRouterReadYourWritesPostgres(t *testing.T) {
+	primary := dbtest.New(t)
+	replica := dbtest.NewReplica(t)
+	router := db.NewRouter(primary, replica)
+
+	var before, after string
+	handler := db.ReadYourWrites(5*time.Second, util.Cookies{Dev: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		before = servedBy(t, ctx, router, primary)
+		if r.Method == http.MethodPost {
+			if _, err := router.Exec(ctx, "DELETE FROM rate_limits"); err != nil {
+				t.Error(err)
+			}
+		}
+		after = servedBy(t, ctx, router, primary)
+	}))
+
+	// A write pins the rest of the request to the primary.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if before != "replica" || after != "primary" {
+		t.Errorf("writing request read from %s then %s, want replica then primary", before, after)
+	}
+
+	// The client's next request reads from the primary too.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if before != "primary" || after != "primary" {
+		t.Errorf("next request read from %s then %s, want the primary", before, after)
+	}
+
+	// Without the cookie, reads go back to the replica.
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if before != "replica" || after != "replica" {
+		t.Errorf("other client read from %s then %s, want the replica", before, after)
+	}
+}
+
+func TestRouterFallbackPostgres(t *testing.T) {
+	primary := dbtest.New(t)
+	replica := dbtest.NewReplica(t)
+	router := db.NewRouter(primary, replica)
+
+	replica.Close()
+
+	if got := servedBy(t, context.Background(), router, primary); got != "primary" {
+		t.Errorf("read with the replica down served by %s, want primary", got)
+	}
+
+	rows, err := router.Query(context.Background(), "SELECT 1")
+	if err != nil {
+		t.Fatal("query with the replica down: ", err)
+	}
+	rows.Close()
+}
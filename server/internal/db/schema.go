@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const schemaHeader = "-- Code generated by `katanaid schema-dump` from migrations/. DO NOT EDIT.\n"
+
+// DumpMigratedSchema applies every migration to a throwaway database on the
+// server at adminURL and renders the resulting schema as DDL. The database is
+// dropped afterwards. The output is what internal/db/schema.sql must contain.
+func DumpMigratedSchema(ctx context.Context, adminURL string) (string, error) {
+	dbURL, drop, err := CreateMigratedDatabase(ctx, adminURL, "katanaid_schema")
+	if err != nil {
+		return "", err
+	}
+	defer drop(context.Background())
+
+	conn, err := pgx.Connect(ctx, dbURL)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close(ctx)
+
+	return DumpSchema(ctx, conn)
+}
+
+// CreateMigratedDatabase creates a database named prefix plus a random
+// suffix on the server at adminURL, applies every migration to it and
+// returns its URL. drop deletes the database, closing any connections to it.
+func CreateMigratedDatabase(ctx context.Context, adminURL string, prefix string) (dbURL string, drop func(context.Context) error, err error) {
+	u, err := url.Parse(adminURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", nil, err
+	}
+	name := prefix + "_" + hex.EncodeToString(suffix)
+
+	admin, err := pgx.Connect(ctx, adminURL)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = admin.Exec(ctx, "CREATE DATABASE "+name)
+	admin.Close(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	drop = func(ctx context.Context) error {
+		admin, err := pgx.Connect(ctx, adminURL)
+		if err != nil {
+			return err
+		}
+		defer admin.Close(ctx)
+
+		_, err = admin.Exec(ctx, "DROP DATABASE IF EXISTS "+name+" WITH (FORCE)")
+		return err
+	}
+
+	u.Path = "/" + name
+	if err := RunMigrations(u.String()); err != nil {
+		drop(context.Background())
+		return "", nil, err
+	}
+
+	return u.String(), drop, nil
+}
+
+// DumpSchema renders the tables, constraints, and indexes of the public
+// schema as DDL. Tables come first with constraints added afterwards so the
+// output can be applied in order, and everything is sorted so the result is
+// stable across runs.
+func DumpSchema(ctx context.Context, conn *pgx.Conn) (string, error) {
+	var b strings.Builder
+	b.WriteString(schemaHeader)
+
+	tables, err := pgx.CollectRows(queryRows(ctx, conn, `
+		SELECT c.relname::text FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'public' AND c.relkind = 'r' AND c.relname <> 'schema_migrations'
+		ORDER BY c.relname COLLATE "C"`), pgx.RowTo[string])
+	if err != nil {
+		return "", err
+	}
+
+	for _, table := range tables {
+		rows, err := conn.Query(ctx, `
+			SELECT a.attname::text, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+			       COALESCE(pg_get_expr(d.adbin, d.adrelid), '')
+			FROM pg_attribute a
+			LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+			WHERE a.attrelid = ('public.' || $1)::regclass AND a.attnum > 0 AND NOT a.attisdropped
+			ORDER BY a.attnum`, table)
+		if err != nil {
+			return "", err
+		}
+
+		var columns []string
+		for rows.Next() {
+			var name, typ, def string
+			var notNull bool
+			if err := rows.Scan(&name, &typ, &notNull, &def); err != nil {
+				rows.Close()
+				return "", err
+			}
+
+			column := "  " + name + " " + typ
+			if notNull {
+				column += " NOT NULL"
+			}
+			if def != "" {
+				column += " DEFAULT " + def
+			}
+			columns = append(columns, column)
+		}
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "\nCREATE TABLE %s (\n%s\n);\n", table, strings.Join(columns, ",\n"))
+	}
+
+	constraints, err := pgx.CollectRows(queryRows(ctx, conn, `
+		SELECT format('ALTER TABLE %s ADD CONSTRAINT %s %s;', c.relname, co.conname, pg_get_constraintdef(co.oid))
+		FROM pg_constraint co
+		JOIN pg_class c ON c.oid = co.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'public' AND c.relname <> 'schema_migrations' AND co.contype IN ('p', 'u', 'c', 'x', 'f')
+		ORDER BY co.contype = 'f', c.relname COLLATE "C", co.conname COLLATE "C"`), pgx.RowTo[string])
+	if err != nil {
+		return "", err
+	}
+	if len(constraints) > 0 {
+		b.WriteString("\n" + strings.Join(constraints, "\n") + "\n")
+	}
+
+	indexes, err := pgx.CollectRows(queryRows(ctx, conn, `
+		SELECT pg_get_indexdef(i.indexrelid) || ';'
+		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = 'public' AND t.relname <> 'schema_migrations'
+		  AND NOT EXISTS (
+		    SELECT 1 FROM pg_constraint co
+		    WHERE co.conindid = i.indexrelid AND co.contype IN ('p', 'u', 'x')
+		  )
+		ORDER BY t.relname COLLATE "C", ic.relname COLLATE "C"`), pgx.RowTo[string])
+	if err != nil {
+		return "", err
+	}
+	if len(indexes) > 0 {
+		b.WriteString("\n" + strings.Join(indexes, "\n") + "\n")
+	}
+
+	return b.String(), nil
+}
+
+// queryRows defers query errors to pgx.CollectRows, which reports them when
+// it reads the rows.
+func queryRows(ctx context.Context, conn *pgx.Conn, sql string) pgx.Rows {
+	rows, _ := conn.Query(ctx, sql)
+	return rows
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSchemaMatchesMigrations fails when schema.sql, which sqlc compiles the
+// queries against, no longer matches what the migrations build. It needs a
+// Postgres server that SCHEMA_DB_URL can create databases on.
+func TestSchemaMatchesMigrations(t *testing.T) {
+	adminURL := os.Getenv("SCHEMA_DB_URL")
+	if adminURL == "" {
+		t.Skip("SCHEMA_DB_URL not set")
+	}
+
+	committed, err := os.ReadFile("schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := DumpMigratedSchema(context.Background(), adminURL)
+	if err != nil {
+		t.Fatal("dump schema: ", err)
+	}
+
+	if string(committed) == migrated {
+		return
+	}
+
+	committedLines := strings.Split(string(committed), "\n")
+	migratedLines := strings.Split(migrated, "\n")
+	for i := range max(len(committedLines), len(migratedLines)) {
+		var want, got string
+		if i < len(migratedLines) {
+			want = migratedLines[i]
+		}
+		if i < len(committedLines) {
+			got = committedLines[i]
+		}
+		if want != got {
+			t.Fatalf("schema.sql has drifted from migrations, run `make schema`\nline %d:\n  schema.sql: %q\n  migrations: %q", i+1, got, want)
+		}
+	}
+}
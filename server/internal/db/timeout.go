@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+// timeoutDB bounds every statement run through it by timeout, on top of
+// whatever deadline the caller's context already carries.
+type timeoutDB struct {
+	db      gendb.DBTX
+	timeout time.Duration
+}
+
+func (t timeoutDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	return t.db.Exec(ctx, sql, args...)
+}
+
+func (t timeoutDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+
+	rows, err := t.db.Query(ctx, sql, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return timeoutRows{Rows: rows, cancel: cancel}, nil
+}
+
+func (t timeoutDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+
+	return timeoutRow{row: t.db.QueryRow(ctx, sql, args...), cancel: cancel}
+}
+
+// timeoutRows releases the statement's context once the rows are closed.
+type timeoutRows struct {
+	pgx.Rows
+	cancel context.CancelFunc
+}
+
+func (r timeoutRows) Close() {
+	r.Rows.Close()
+	r.cancel()
+}
+
+// timeoutRow releases the statement's context once the row is scanned.
+type timeoutRow struct {
+	row    pgx.Row
+	cancel context.CancelFunc
+}
+
+func (r timeoutRow) Scan(dest ...any) error {
+	defer r.cancel()
+
+	return r.row.Scan(dest...)
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Metrics counts queries across every pool in the process. It is published
+// through expvar as "db".
+var Metrics = expvar.NewMap("db")
+
+type traceStartKey struct{}
+
+type traceStart struct {
+	name string
+	at   time.Time
+}
+
+// queryTracer logs failed and slow queries and feeds Metrics.
+type queryTracer struct {
+	slow time.Duration
+}
+
+func (t queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, traceStartKey{}, traceStart{name: queryName(data.SQL), at: time.Now()})
+}
+
+func (t queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(traceStartKey{}).(traceStart)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(start.at)
+
+	Metrics.Add("queries", 1)
+	Metrics.Add("query_time_us", elapsed.Microseconds())
+
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		Metrics.Add("query_errors", 1)
+		if errors.Is(data.Err, context.DeadlineExceeded) {
+			Metrics.Add("query_timeouts", 1)
+		}
+		log.Print("⚠️  Query ", start.name, " failed after ", elapsed, ": ", data.Err)
+		return
+	}
+
+	if t.slow > 0 && elapsed > t.slow {
+		Metrics.Add("slow_queries", 1)
+		log.Print("🐢 Slow query ", start.name, " took ", elapsed)
+	}
+}
+
+// queryName returns the sqlc query name from the "-- name: X :kind" header,
+// or the first line of sql for hand-written statements.
+func queryName(sql string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(sql), "\n")
+	if name, ok := strings.CutPrefix(line, "-- name: "); ok {
+		name, _, _ = strings.Cut(name, " ")
+		return name
+	}
+
+	return line
+}
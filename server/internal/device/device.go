@@ -0,0 +1,116 @@
+// Package device recognizes the browsers and networks users sign in from,
+// so a sign-in from somewhere new can be flagged.
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"strings"
+)
+
+// Device is what a sign-in is recognized by.
+type Device struct {
+	// Name is a readable description such as "Chrome on Windows".
+	Name string
+	// Fingerprint identifies the device among a user's devices. It is the
+	// same across browser updates and addresses within one network.
+	Fingerprint string
+}
+
+// Identify describes the device a request came from. The fingerprint
+// hashes the user agent with version numbers stripped and the client's /16
+// for IPv4 or /48 for IPv6: coarse enough that an update or a new address
+// from the same ISP isn't a new device, without treating every browser of
+// a kind as one.
+func Identify(userAgent string, ip string) Device {
+	stripped := strings.Map(func(r rune) rune {
+		if '0' <= r && r <= '9' {
+			return -1
+		}
+		return r
+	}, userAgent)
+
+	sum := sha256.Sum256([]byte(stripped + "\n" + network(ip)))
+
+	return Device{
+		Name:        Name(userAgent),
+		Fingerprint: hex.EncodeToString(sum[:16]),
+	}
+}
+
+// network is the prefix ip is grouped by, or "" if it doesn't parse.
+func network(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+
+	bits := 48
+	if addr.Unmap().Is4() {
+		addr, bits = addr.Unmap(), 16
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+
+	return prefix.String()
+}
+
+// uaRule maps a user agent token to a name. Rules are tried in order, since
+// most browsers also claim to be the ones they were derived from.
+type uaRule struct {
+	token string
+	name  string
+}
+
+var browsers = []uaRule{
+	{"Edg", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+}
+
+var systems = []uaRule{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// Name describes userAgent as a browser and operating system, such as
+// "Firefox on macOS", falling back to whichever is known.
+func Name(userAgent string) string {
+	browser, system := match(browsers, userAgent), match(systems, userAgent)
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+
+	return "Unknown device"
+}
+
+func match(rules []uaRule, userAgent string) string {
+	for _, rule := range rules {
+		if strings.Contains(userAgent, rule.token) {
+			return rule.name
+		}
+	}
+
+	return ""
+}
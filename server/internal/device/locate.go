@@ -0,0 +1,47 @@
+package device
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Locator finds the country a request came from.
+type Locator interface {
+	// Country returns the ISO 3166-1 alpha-2 code of the country r came
+	// from, or "" if it isn't known.
+	Country(r *http.Request) string
+}
+
+// HeaderLocator reads the country from a header set by a CDN or proxy,
+// such as Cloudflare's CF-IPCountry. Only use it when that proxy is the
+// sole way in and overwrites the header, since clients can send it too.
+type HeaderLocator struct {
+	Header string
+}
+
+func (l HeaderLocator) Country(r *http.Request) string {
+	code := strings.ToUpper(strings.TrimSpace(r.Header.Get(l.Header)))
+	if len(code) != 2 || code == "XX" {
+		return ""
+	}
+
+	for i := 0; i < len(code); i++ {
+		if code[i] < 'A' || code[i] > 'Z' {
+			return ""
+		}
+	}
+
+	return code
+}
+
+// LocatorFromEnv returns a HeaderLocator for GEOIP_COUNTRY_HEADER, or nil
+// when it is unset, in which case sign-ins are only compared by device.
+func LocatorFromEnv() Locator {
+	header := os.Getenv("GEOIP_COUNTRY_HEADER")
+	if header == "" {
+		return nil
+	}
+
+	return HeaderLocator{Header: header}
+}
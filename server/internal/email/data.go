@@ -0,0 +1,73 @@
+package email
+
+import (
+	"time"
+)
+
+// CodeData fills the otp and email_change_code templates.
+type CodeData struct {
+	Code             string
+	ExpiresInMinutes int
+}
+
+// MagicLinkData fills the magic_link template.
+type MagicLinkData struct {
+	Link             string
+	ExpiresInMinutes int
+}
+
+// NewDeviceData fills the new_device template. Country is empty when it
+// isn't known, and RevokeLink signs the new session out.
+type NewDeviceData struct {
+	Device     string
+	UserAgent  string
+	IPAddress  string
+	Country    string
+	Time       time.Time
+	RevokeLink string
+}
+
+// EmailChangeNoticeData fills the email_change_notice template, sent to the
+// old address.
+type EmailChangeNoticeData struct {
+	NewEmail   string
+	CancelLink string
+	// RevertDays is how long CancelLink can undo the change once it's
+	// confirmed.
+	RevertDays int
+}
+
+// ExportReadyData fills the export_ready template.
+type ExportReadyData struct {
+	Link          string
+	ExpiresInDays int
+}
+
+// SampleData returns placeholder data for previewing the named template.
+func SampleData(name string) (any, bool) {
+	switch name {
+	case TemplateOTP, TemplateEmailChangeCode:
+		return CodeData{Code: "123456", ExpiresInMinutes: 5}, true
+	case TemplateMagicLink:
+		return MagicLinkData{Link: "https://katanaid.com/auth/magic?token=sample", ExpiresInMinutes: 15}, true
+	case TemplateNewDevice:
+		return NewDeviceData{
+			Device:     "Firefox on macOS",
+			UserAgent:  "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) Firefox/131.0",
+			IPAddress:  "203.0.113.7",
+			Country:    "DE",
+			Time:       time.Date(2025, 1, 2, 15, 4, 0, 0, time.UTC),
+			RevokeLink: "https://api.katanaid.com/auth/logins/revoke?token=sample",
+		}, true
+	case TemplateEmailChangeNotice:
+		return EmailChangeNoticeData{
+			NewEmail:   "new@example.com",
+			CancelLink: "https://api.katanaid.com/auth/email-change/cancel?token=sample",
+			RevertDays: 7,
+		}, true
+	case TemplateExportReady:
+		return ExportReadyData{Link: "https://api.katanaid.com/auth/me/export/sample", ExpiresInDays: 7}, true
+	}
+
+	return nil, false
+}
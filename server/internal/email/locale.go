@@ -0,0 +1,44 @@
+package email
+
+import (
+	"golang.org/x/text/language"
+)
+
+// Locale picks the locale to email a user in: their saved locale when it
+// has templates, otherwise the best match for the request's Accept-Language
+// header, otherwise DefaultLocale.
+func (t *Templates) Locale(userLocale string, acceptLanguage string) string {
+	if t.Supports(userLocale) {
+		return userLocale
+	}
+
+	if acceptLanguage == "" {
+		return DefaultLocale
+	}
+
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return DefaultLocale
+	}
+
+	// The matcher prefers its first tag when nothing fits, so the default
+	// locale goes first.
+	supported := []string{DefaultLocale}
+	for _, locale := range t.locales {
+		if locale != DefaultLocale {
+			supported = append(supported, locale)
+		}
+	}
+
+	supportedTags := make([]language.Tag, len(supported))
+	for i, locale := range supported {
+		supportedTags[i] = language.Make(locale)
+	}
+
+	_, index, confidence := language.NewMatcher(supportedTags).Match(tags...)
+	if confidence == language.No {
+		return DefaultLocale
+	}
+
+	return supported[index]
+}
@@ -0,0 +1,86 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/resend/resend-go/v3"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+// DefaultFrom is the sender used when EMAIL_FROM isn't set.
+const DefaultFrom = "KatanaID <noreply@katanaid.com>"
+
+// ErrSuppressed is returned by Enqueue for recipients on the suppression
+// list.
+var ErrSuppressed = errors.New("email address is suppressed")
+
+// OutboxStore persists emails waiting to be delivered.
+type OutboxStore interface {
+	CreateOutboxEmail(ctx context.Context, arg gendb.CreateOutboxEmailParams) (gendb.EmailOutbox, error)
+	IsEmailSuppressed(ctx context.Context, email string) (bool, error)
+}
+
+// Mailer renders templates into the outbox and delivers outbox emails
+// through Resend with both an HTML and a plain-text part.
+type Mailer struct {
+	Client    *resend.Client
+	From      string
+	Templates *Templates
+}
+
+// Enqueue renders the named template in locale and writes it to the outbox
+// through store, which may be bound to the transaction that created whatever
+// the email is about. key identifies the email: enqueueing the same key again
+// is a no-op, and it is passed to the provider so retries are never sent
+// twice. expires is when the email is no longer worth sending, such as when
+// the code in it runs out; the zero time means never. Recipients that
+// hard-bounced or complained get ErrSuppressed.
+func (m *Mailer) Enqueue(ctx context.Context, store OutboxStore, key string, expires time.Time, to string, name string, locale string, data any) error {
+	suppressed, err := store.IsEmailSuppressed(ctx, to)
+	if err != nil {
+		return err
+	}
+	if suppressed {
+		return ErrSuppressed
+	}
+
+	msg, err := m.Templates.Render(name, locale, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.CreateOutboxEmail(ctx, gendb.CreateOutboxEmailParams{
+		IdempotencyKey: key,
+		Recipient:      to,
+		Template:       name,
+		Subject:        msg.Subject,
+		Html:           msg.HTML,
+		BodyText:       msg.Text,
+		ExpiresAt:      pgtype.Timestamptz{Time: expires, Valid: !expires.IsZero()},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+
+	return err
+}
+
+// Deliver sends an outbox email and returns the provider's message ID.
+func (m *Mailer) Deliver(ctx context.Context, email gendb.EmailOutbox) (string, error) {
+	sent, err := m.Client.Emails.SendWithOptions(ctx, &resend.SendEmailRequest{
+		From:    m.From,
+		To:      []string{email.Recipient},
+		Subject: email.Subject,
+		Html:    email.Html,
+		Text:    email.BodyText,
+	}, &resend.SendEmailOptions{IdempotencyKey: email.IdempotencyKey})
+	if err != nil {
+		return "", err
+	}
+
+	return sent.Id, nil
+}
@@ -0,0 +1,169 @@
+package email
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+// Outbox email statuses.
+const (
+	StatusPending = "pending"
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusDead    = "dead"
+)
+
+// Metrics counts outbox deliveries. It is published through expvar as
+// "email_outbox".
+var Metrics = expvar.NewMap("email_outbox")
+
+// Worker delivers emails from the outbox. Claimed emails are leased for
+// Lease; an email whose worker died mid-delivery is picked up again once the
+// lease runs out, and the idempotency key keeps the provider from sending it
+// twice. Failed deliveries are retried with exponential backoff from
+// BaseDelay up to MaxDelay, and dead-lettered after MaxAttempts or once they
+// expire, so a code isn't delivered after it stopped working.
+type Worker struct {
+	Queries     *gendb.Queries
+	Mailer      *Mailer
+	Concurrency int
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Lease       time.Duration
+	// Retention is how long sent emails are kept before they are deleted.
+	Retention time.Duration
+}
+
+// Start polls the outbox every interval until ctx is done.
+func (w *Worker) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.expire(ctx)
+
+			// Keep draining while batches come back full.
+			for ctx.Err() == nil {
+				if w.runBatch(ctx) < w.Concurrency {
+					break
+				}
+			}
+		case <-cleanup.C:
+			w.deleteSent(ctx)
+		}
+	}
+}
+
+// runBatch claims up to Concurrency emails, delivers them in parallel and
+// returns how many it claimed.
+func (w *Worker) runBatch(ctx context.Context) int {
+	emails, err := w.Queries.ClaimOutboxEmails(ctx, gendb.ClaimOutboxEmailsParams{
+		LeaseUntil: pgtype.Timestamptz{Time: time.Now().Add(w.Lease), Valid: true},
+		BatchSize:  int32(w.Concurrency),
+	})
+	if err != nil {
+		log.Print("Failed to claim outbox emails: ", err)
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for _, email := range emails {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.deliver(ctx, email)
+		}()
+	}
+	wg.Wait()
+
+	return len(emails)
+}
+
+func (w *Worker) deliver(ctx context.Context, email gendb.EmailOutbox) {
+	// Give up before the lease runs out so no other worker picks the email
+	// up while this one may still send it.
+	sendCtx, cancel := context.WithTimeout(ctx, w.Lease/2)
+	messageID, err := w.Mailer.Deliver(sendCtx, email)
+	cancel()
+
+	if err == nil {
+		Metrics.Add("sent", 1)
+		if err := w.Queries.MarkOutboxEmailSent(ctx, gendb.MarkOutboxEmailSentParams{
+			ID:                email.ID,
+			ProviderMessageID: pgtype.Text{String: messageID, Valid: messageID != ""},
+		}); err != nil {
+			log.Print("Failed to mark outbox email as sent: ", err)
+		}
+		return
+	}
+
+	status := StatusPending
+	if int(email.Attempts) >= w.MaxAttempts {
+		status = StatusDead
+		Metrics.Add("dead", 1)
+		log.Print("⚠️  Email ", email.ID.String(), " (", email.Template, ") dead-lettered after ", email.Attempts, " attempts: ", err)
+	} else {
+		Metrics.Add("failed", 1)
+	}
+
+	if err := w.Queries.MarkOutboxEmailFailed(ctx, gendb.MarkOutboxEmailFailedParams{
+		ID:            email.ID,
+		Status:        status,
+		NextAttemptAt: pgtype.Timestamptz{Time: time.Now().Add(w.backoff(int(email.Attempts))), Valid: true},
+		LastError:     pgtype.Text{String: err.Error(), Valid: true},
+	}); err != nil {
+		log.Print("Failed to mark outbox email as failed: ", err)
+	}
+}
+
+// backoff is the delay before retrying an email that has failed attempts
+// times: BaseDelay doubled per attempt, capped at MaxDelay, with up to 20%
+// jitter so failures don't retry in lockstep.
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.BaseDelay
+	for i := 1; i < attempts && delay < w.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, w.MaxDelay)
+
+	return delay + time.Duration(rand.Int64N(int64(delay)/5+1))
+}
+
+// expire dead-letters emails that expired before they could be sent.
+func (w *Worker) expire(ctx context.Context) {
+	expired, err := w.Queries.ExpireOutboxEmails(ctx)
+	if err != nil {
+		log.Print("Failed to expire outbox emails: ", err)
+		return
+	}
+	if expired > 0 {
+		Metrics.Add("expired", expired)
+		log.Print("⚠️  ", expired, " outbox emails expired before they could be sent")
+	}
+}
+
+func (w *Worker) deleteSent(ctx context.Context) {
+	deleted, err := w.Queries.DeleteSentOutboxEmails(ctx, pgtype.Timestamptz{Time: time.Now().Add(-w.Retention), Valid: true})
+	if err != nil {
+		log.Print("Failed to delete sent outbox emails: ", err)
+		return
+	}
+	if deleted > 0 {
+		log.Print("🧹 Deleted ", deleted, " sent outbox emails")
+	}
+}
@@ -0,0 +1,71 @@
+package email
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// svixTolerance bounds how far a webhook's timestamp may be from now, so a
+// captured request can't be replayed later.
+const svixTolerance = 5 * time.Minute
+
+var errInvalidSignature = errors.New("invalid webhook signature")
+
+// SvixVerifier checks webhook signatures in the Svix format that Resend
+// uses: svix-signature holds one or more "v1,<base64 HMAC-SHA256>" entries
+// over "<svix-id>.<svix-timestamp>.<body>".
+type SvixVerifier struct {
+	key []byte
+}
+
+// NewSvixVerifier parses a signing secret of the form "whsec_<base64>".
+func NewSvixVerifier(secret string) (SvixVerifier, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil || len(key) == 0 {
+		return SvixVerifier{}, errors.New("invalid webhook signing secret")
+	}
+
+	return SvixVerifier{key: key}, nil
+}
+
+func (v SvixVerifier) Verify(header http.Header, body []byte) error {
+	id := header.Get("svix-id")
+	timestamp := header.Get("svix-timestamp")
+	signatures := header.Get("svix-signature")
+	if id == "" || timestamp == "" || signatures == "" {
+		return errInvalidSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errInvalidSignature
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > svixTolerance || age < -svixTolerance {
+		return errInvalidSignature
+	}
+
+	expected := v.Sign(id, timestamp, body)
+	for _, signature := range strings.Fields(signatures) {
+		version, value, ok := strings.Cut(signature, ",")
+		if ok && version == "v1" && hmac.Equal([]byte(value), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return errInvalidSignature
+}
+
+// Sign returns the base64 v1 signature of a webhook.
+func (v SvixVerifier) Sign(id string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, v.key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,229 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"sort"
+	texttemplate "text/template"
+)
+
+// Template names. Each has a <name>.html and a <name>.txt file per locale;
+// the .txt file also defines the "subject" template.
+const (
+	TemplateOTP               = "otp"
+	TemplateMagicLink         = "magic_link"
+	TemplateNewDevice         = "new_device"
+	TemplateEmailChangeCode   = "email_change_code"
+	TemplateEmailChangeNotice = "email_change_notice"
+	TemplateExportReady       = "export_ready"
+)
+
+// DefaultLocale is used when neither the user nor the request asks for a
+// locale that has templates.
+const DefaultLocale = "en"
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// Message is a rendered email.
+type Message struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+type localized struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Templates holds the parsed email templates of every locale. The HTML body
+// of each template is rendered inside its locale's layout.html.
+type Templates struct {
+	byLocale map[string]map[string]localized
+	locales  []string
+}
+
+// LoadTemplates parses the embedded templates, with files under overrideDir
+// taking their place when present. overrideDir mirrors the embedded layout
+// (<locale>/<name>.html, <locale>/<name>.txt, <locale>/layout.html) and may
+// add locales of its own.
+func LoadTemplates(overrideDir string) (*Templates, error) {
+	base, err := fs.Sub(defaultTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := base
+	if overrideDir != "" {
+		if _, err := os.Stat(overrideDir); err != nil {
+			return nil, fmt.Errorf("email templates: %w", err)
+		}
+		fsys = overlayFS{top: os.DirFS(overrideDir), base: base}
+	}
+
+	locales, err := localeDirs(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{byLocale: map[string]map[string]localized{}}
+	for _, locale := range locales {
+		templates := map[string]localized{}
+		for _, name := range templateNames {
+			tmpl, err := parseLocalized(fsys, locale, name)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("email template %s/%s: %w", locale, name, err)
+			}
+			templates[name] = tmpl
+		}
+		if len(templates) == 0 {
+			continue
+		}
+
+		t.byLocale[locale] = templates
+		t.locales = append(t.locales, locale)
+	}
+
+	if _, ok := t.byLocale[DefaultLocale]; !ok {
+		return nil, fmt.Errorf("email templates: missing default locale %q", DefaultLocale)
+	}
+
+	return t, nil
+}
+
+var templateNames = []string{
+	TemplateOTP,
+	TemplateMagicLink,
+	TemplateNewDevice,
+	TemplateEmailChangeCode,
+	TemplateEmailChangeNotice,
+	TemplateExportReady,
+}
+
+// Names lists the templates that can be rendered.
+func Names() []string {
+	return append([]string(nil), templateNames...)
+}
+
+// Locales lists the locales that have templates, sorted.
+func (t *Templates) Locales() []string {
+	return append([]string(nil), t.locales...)
+}
+
+// Supports reports whether locale has templates of its own.
+func (t *Templates) Supports(locale string) bool {
+	_, ok := t.byLocale[locale]
+	return ok
+}
+
+// Render renders the named template in locale, falling back to
+// DefaultLocale when the locale lacks it.
+func (t *Templates) Render(name string, locale string, data any) (Message, error) {
+	tmpl, ok := t.byLocale[locale][name]
+	if !ok {
+		tmpl, ok = t.byLocale[DefaultLocale][name]
+	}
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout.html", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Subject: string(bytes.TrimSpace(subject.Bytes())),
+		HTML:    html.String(),
+		Text:    string(bytes.TrimSpace(text.Bytes())) + "\n",
+	}, nil
+}
+
+func parseLocalized(fsys fs.FS, locale string, name string) (localized, error) {
+	for _, file := range []string{name + ".txt", name + ".html"} {
+		if _, err := fs.Stat(fsys, locale+"/"+file); err != nil {
+			return localized{}, err
+		}
+	}
+
+	text, err := texttemplate.ParseFS(fsys, locale+"/"+name+".txt")
+	if err != nil {
+		return localized{}, err
+	}
+	if text.Lookup("subject") == nil {
+		return localized{}, errors.New(`missing "subject" template`)
+	}
+
+	html, err := htmltemplate.ParseFS(fsys, locale+"/layout.html", locale+"/"+name+".html")
+	if err != nil {
+		return localized{}, err
+	}
+
+	return localized{html: html, text: text}, nil
+}
+
+func localeDirs(fsys fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var locales []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			locales = append(locales, entry.Name())
+		}
+	}
+	sort.Strings(locales)
+
+	return locales, nil
+}
+
+// overlayFS serves files from top, falling back to base. Directory listings
+// are merged.
+type overlayFS struct {
+	top  fs.FS
+	base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if f, err := o.top.Open(name); err == nil {
+		return f, nil
+	}
+	return o.base.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := map[string]bool{}
+	var entries []fs.DirEntry
+	for _, fsys := range []fs.FS{o.top, o.base} {
+		list, err := fs.ReadDir(fsys, name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		for _, entry := range list {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
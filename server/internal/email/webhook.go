@@ -0,0 +1,224 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trnahnh/katana-id/internal/db"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/util"
+)
+
+// Delivery event types recorded from provider webhooks.
+const (
+	EventDelivered  = "delivered"
+	EventBounced    = "bounced"
+	EventComplained = "complained"
+	EventOpened     = "opened"
+)
+
+// Suppression reasons.
+const (
+	SuppressedBounced    = "bounced"
+	SuppressedComplained = "complained"
+)
+
+const maxWebhookBody = 1 << 20
+
+// DeliveryEvent is a provider webhook in provider-neutral form.
+type DeliveryEvent struct {
+	// WebhookID is unique per delivery attempt of the provider, so retried
+	// webhooks are only recorded once.
+	WebhookID  string
+	MessageID  string
+	Type       string
+	Recipients []string
+	// HardBounce is set on bounces the provider considers permanent.
+	HardBounce bool
+	Detail     string
+	OccurredAt time.Time
+}
+
+// WebhookProvider verifies and parses one provider's delivery webhooks.
+// Parse returns an event with an empty Type for events that aren't tracked.
+type WebhookProvider interface {
+	Verify(header http.Header, body []byte) error
+	Parse(header http.Header, body []byte) (DeliveryEvent, error)
+}
+
+type webhookResponse struct {
+	Message string `json:"message"`
+}
+
+// WebhookHandler records delivery events posted by providers against the
+// outbox email they are about. Hard bounces and spam complaints put the
+// recipient on the suppression list, which Enqueue refuses to send to.
+type WebhookHandler struct {
+	Queries   *gendb.Queries
+	Pool      *pgxpool.Pool
+	Providers map[string]WebhookProvider
+}
+
+func (h *WebhookHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := h.Providers[name]
+	if !ok {
+		util.WriteJSON(w, http.StatusNotFound, util.ErrorResponse{Error: "Unknown provider"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	if err := provider.Verify(r.Header, body); err != nil {
+		util.WriteJSON(w, http.StatusUnauthorized, util.ErrorResponse{Error: "Invalid signature"})
+		return
+	}
+
+	event, err := provider.Parse(r.Header, body)
+	if err != nil {
+		util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+	if event.Type == "" || event.MessageID == "" || len(event.Recipients) == 0 {
+		util.WriteJSON(w, http.StatusOK, webhookResponse{Message: "Ignored"})
+		return
+	}
+
+	if err := h.record(r, name, event); err != nil {
+		log.Print("Failed to record email webhook: ", err)
+		util.WriteJSON(w, http.StatusInternalServerError, util.ErrorResponse{Error: "Something went wrong"})
+		return
+	}
+
+	util.WriteJSON(w, http.StatusOK, webhookResponse{Message: "Recorded"})
+}
+
+func (h *WebhookHandler) record(r *http.Request, provider string, event DeliveryEvent) error {
+	ctx := r.Context()
+	db.MarkWrite(ctx)
+
+	return pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+
+		email, err := q.GetOutboxEmailByProviderMessageID(ctx, pgtype.Text{String: event.MessageID, Valid: true})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		_, err = q.CreateEmailEvent(ctx, gendb.CreateEmailEventParams{
+			Provider:          provider,
+			WebhookID:         event.WebhookID,
+			OutboxID:          email.ID,
+			ProviderMessageID: event.MessageID,
+			Type:              event.Type,
+			Recipient:         event.Recipients[0],
+			Detail:            pgtype.Text{String: event.Detail, Valid: event.Detail != ""},
+			OccurredAt:        pgtype.Timestamptz{Time: event.OccurredAt, Valid: true},
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Already recorded from an earlier delivery of the webhook.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		Metrics.Add("events_"+event.Type, 1)
+
+		if email.ID.Valid {
+			if err := q.UpdateOutboxDeliveryStatus(ctx, gendb.UpdateOutboxDeliveryStatusParams{
+				ID:             email.ID,
+				DeliveryStatus: pgtype.Text{String: event.Type, Valid: true},
+			}); err != nil {
+				return err
+			}
+		}
+
+		reason := ""
+		switch {
+		case event.Type == EventBounced && event.HardBounce:
+			reason = SuppressedBounced
+		case event.Type == EventComplained:
+			reason = SuppressedComplained
+		default:
+			return nil
+		}
+
+		for _, recipient := range event.Recipients {
+			if err := q.SuppressEmail(ctx, gendb.SuppressEmailParams{
+				Email:  recipient,
+				Reason: reason,
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ResendWebhook parses Resend webhooks, which are signed by Svix.
+type ResendWebhook struct {
+	Verifier SvixVerifier
+}
+
+type resendWebhookPayload struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      struct {
+		EmailID string   `json:"email_id"`
+		To      []string `json:"to"`
+		Bounce  struct {
+			Type    string `json:"type"`
+			SubType string `json:"subType"`
+			Message string `json:"message"`
+		} `json:"bounce"`
+	} `json:"data"`
+}
+
+var resendEventTypes = map[string]string{
+	"email.delivered":  EventDelivered,
+	"email.bounced":    EventBounced,
+	"email.complained": EventComplained,
+	"email.opened":     EventOpened,
+}
+
+func (p ResendWebhook) Verify(header http.Header, body []byte) error {
+	return p.Verifier.Verify(header, body)
+}
+
+func (p ResendWebhook) Parse(header http.Header, body []byte) (DeliveryEvent, error) {
+	var payload resendWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return DeliveryEvent{}, err
+	}
+
+	event := DeliveryEvent{
+		WebhookID:  header.Get("svix-id"),
+		MessageID:  payload.Data.EmailID,
+		Type:       resendEventTypes[payload.Type],
+		Recipients: payload.Data.To,
+		OccurredAt: payload.CreatedAt,
+	}
+	if event.Type == EventBounced {
+		event.HardBounce = payload.Data.Bounce.Type == "Permanent"
+		event.Detail = payload.Data.Bounce.Message
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	return event, nil
+}
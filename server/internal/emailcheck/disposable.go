@@ -0,0 +1,129 @@
+package emailcheck
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//go:embed disposable_domains.txt
+var bundledDisposable []byte
+
+// DomainList is the set of disposable email domains: the list bundled with
+// the server plus, optionally, a file of extra domains that Start reloads
+// when it changes, so the list can be updated without a deploy.
+type DomainList struct {
+	path    string
+	modTime time.Time
+	domains atomic.Pointer[map[string]struct{}]
+}
+
+// LoadDisposable loads the bundled list and the file at path, which may be
+// empty to use only the bundled list. Files have one domain per line;
+// blank lines and lines starting with # are ignored.
+func LoadDisposable(path string) (*DomainList, error) {
+	l := &DomainList{path: path}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Contains reports whether domain or any domain it is a subdomain of is on
+// the list.
+func (l *DomainList) Contains(domain string) bool {
+	domains := *l.domains.Load()
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for {
+		if _, ok := domains[domain]; ok {
+			return true
+		}
+
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			return false
+		}
+		domain = parent
+	}
+}
+
+// Len returns the number of domains on the list.
+func (l *DomainList) Len() int {
+	return len(*l.domains.Load())
+}
+
+// Reload rebuilds the list from the bundled domains and the file.
+func (l *DomainList) Reload() error {
+	domains := make(map[string]struct{})
+	parseDomainList(bundledDisposable, domains)
+
+	if l.path != "" {
+		info, err := os.Stat(l.path)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(l.path)
+		if err != nil {
+			return err
+		}
+		parseDomainList(data, domains)
+		l.modTime = info.ModTime()
+	}
+
+	l.domains.Store(&domains)
+	return nil
+}
+
+// Start checks the file of extra domains every interval until ctx is done
+// and reloads the list when the file has changed. A file that fails to load
+// leaves the previous list in place.
+func (l *DomainList) Start(ctx context.Context, interval time.Duration) {
+	if l.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(l.path)
+			if err != nil {
+				log.Print("Failed to check disposable domain list: ", err)
+				continue
+			}
+			if info.ModTime().Equal(l.modTime) {
+				continue
+			}
+
+			if err := l.Reload(); err != nil {
+				log.Print("Failed to reload disposable domain list: ", err)
+				continue
+			}
+			log.Print("📋 Reloaded disposable domain list with ", l.Len(), " domains")
+		}
+	}
+}
+
+func parseDomainList(data []byte, domains map[string]struct{}) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = struct{}{}
+	}
+}
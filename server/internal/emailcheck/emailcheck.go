@@ -0,0 +1,179 @@
+// Package emailcheck decides whether an address is worth sending mail to
+// before a code goes out: syntax, disposable domains, likely typos of
+// common providers and, optionally, whether the domain accepts mail at all.
+package emailcheck
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/trnahnh/katana-id/util"
+)
+
+// Actions a policy takes when a check fails.
+const (
+	ActionBlock = "block"
+	ActionWarn  = "warn"
+	ActionAllow = "allow"
+)
+
+// Checks an address can fail after passing Parse.
+const (
+	CheckDisposable = "disposable"
+	CheckTypo       = "typo"
+	CheckNoMX       = "no_mx"
+)
+
+const defaultLookupTimeout = 2 * time.Second
+
+// Metrics counts failed checks by check and action, and MX lookups that
+// errored.
+var Metrics = expvar.NewMap("email_checks")
+
+// Policy sets the action for each check. Checks that are allowed aren't
+// run, so allowing NoMX skips MX lookups.
+type Policy struct {
+	Disposable string
+	Typo       string
+	NoMX       string
+}
+
+// DefaultPolicy blocks disposable domains, warns about likely typos and
+// doesn't look up MX records.
+var DefaultPolicy = Policy{
+	Disposable: ActionBlock,
+	Typo:       ActionWarn,
+	NoMX:       ActionAllow,
+}
+
+// Result is the outcome of Check.
+type Result struct {
+	Address Address
+	// Blocked is the check that rejected the address, or "" if it may be
+	// used.
+	Blocked string
+	// Warnings are the checks that failed with ActionWarn.
+	Warnings []string
+	// Suggestion is the corrected address when the domain looks like a typo.
+	Suggestion string
+}
+
+// Checker runs the checks enabled by Policy.
+type Checker struct {
+	Policy     Policy
+	Disposable *DomainList
+	// Resolver looks up MX records when Policy.NoMX isn't allow.
+	Resolver Resolver
+	// LookupTimeout bounds MX lookups, 2s when unset. Lookups that fail or
+	// time out let the address through rather than blocking sign-in on DNS
+	// trouble.
+	LookupTimeout time.Duration
+}
+
+// Check parses s and runs the enabled checks, stopping at the first one
+// that blocks. Addresses that don't parse return ErrInvalidAddress.
+func (c *Checker) Check(ctx context.Context, s string) (Result, error) {
+	addr, err := Parse(s)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Address: addr}
+	domain := addr.Domain
+
+	if enabled(c.Policy.Disposable) && c.Disposable != nil && c.Disposable.Contains(domain) {
+		if result.fail(CheckDisposable, c.Policy.Disposable) {
+			return result, nil
+		}
+	}
+
+	if enabled(c.Policy.Typo) {
+		if suggestion := Suggest(domain); suggestion != "" {
+			result.Suggestion = addr.Local + "@" + suggestion
+			if result.fail(CheckTypo, c.Policy.Typo) {
+				return result, nil
+			}
+		}
+	}
+
+	if enabled(c.Policy.NoMX) && c.Resolver != nil {
+		timeout := c.LookupTimeout
+		if timeout <= 0 {
+			timeout = defaultLookupTimeout
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+		ok, err := acceptsMail(lookupCtx, c.Resolver, domain)
+		cancel()
+
+		switch {
+		case err != nil:
+			Metrics.Add("mx_lookup_errors", 1)
+			log.Print("⚠️  MX lookup failed for ", domain, ", allowing address: ", err)
+		case !ok:
+			result.fail(CheckNoMX, c.Policy.NoMX)
+		}
+	}
+
+	return result, nil
+}
+
+// enabled reports whether action makes a check run. An empty action is the
+// same as allow.
+func enabled(action string) bool {
+	return action == ActionBlock || action == ActionWarn
+}
+
+// fail records that check failed with action, which is block or warn,
+// reporting whether the address is now blocked.
+func (r *Result) fail(check string, action string) bool {
+	if action == ActionBlock {
+		r.Blocked = check
+	} else {
+		r.Warnings = append(r.Warnings, check)
+	}
+
+	Metrics.Add(check+"_"+action, 1)
+	return r.Blocked != ""
+}
+
+// CheckerFromEnv builds a Checker from EMAIL_CHECK_DISPOSABLE,
+// EMAIL_CHECK_TYPO and EMAIL_CHECK_MX, each block, warn or allow, plus
+// DISPOSABLE_DOMAINS_FILE for extra disposable domains and
+// EMAIL_CHECK_MX_TIMEOUT for MX lookups.
+func CheckerFromEnv() (*Checker, error) {
+	policy := DefaultPolicy
+	for _, setting := range []struct {
+		env    string
+		action *string
+	}{
+		{"EMAIL_CHECK_DISPOSABLE", &policy.Disposable},
+		{"EMAIL_CHECK_TYPO", &policy.Typo},
+		{"EMAIL_CHECK_MX", &policy.NoMX},
+	} {
+		switch value := os.Getenv(setting.env); value {
+		case "":
+		case ActionBlock, ActionWarn, ActionAllow:
+			*setting.action = value
+		default:
+			return nil, fmt.Errorf("invalid %s %q: must be block, warn or allow", setting.env, value)
+		}
+	}
+
+	disposable, err := LoadDisposable(os.Getenv("DISPOSABLE_DOMAINS_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load disposable domain list: %w", err)
+	}
+
+	return &Checker{
+		Policy:        policy,
+		Disposable:    disposable,
+		Resolver:      net.DefaultResolver,
+		LookupTimeout: util.EnvDuration("EMAIL_CHECK_MX_TIMEOUT", defaultLookupTimeout),
+	}, nil
+}
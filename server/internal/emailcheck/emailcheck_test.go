@@ -0,0 +1,200 @@
+package emailcheck_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/trnahnh/katana-id/internal/emailcheck"
+)
+
+var resolver = emailcheck.FakeResolver{
+	MX: map[string][]string{
+		"example.com":        {"mx1.example.com.", "mx2.example.com."},
+		"nullmx.example.net": {"."},
+	},
+	Hosts: map[string][]string{
+		"example.org": {"93.184.215.14"},
+	},
+}
+
+func TestCheck(t *testing.T) {
+	mx := func(action string) emailcheck.Policy {
+		policy := emailcheck.DefaultPolicy
+		policy.NoMX = action
+		return policy
+	}
+
+	tests := []struct {
+		name           string
+		policy         emailcheck.Policy
+		address        string
+		wantBlocked    string
+		wantWarnings   []string
+		wantSuggestion string
+	}{
+		{name: "plain address", policy: emailcheck.DefaultPolicy, address: "ada@gmail.com"},
+		{name: "disposable", policy: emailcheck.DefaultPolicy, address: "ada@guerrillamail.com", wantBlocked: emailcheck.CheckDisposable},
+		{name: "disposable subdomain", policy: emailcheck.DefaultPolicy, address: "ada@inbox.guerrillamail.com", wantBlocked: emailcheck.CheckDisposable},
+		{
+			name:         "disposable warned",
+			policy:       emailcheck.Policy{Disposable: emailcheck.ActionWarn},
+			address:      "ada@guerrillamail.com",
+			wantWarnings: []string{emailcheck.CheckDisposable},
+		},
+		{name: "disposable allowed", policy: emailcheck.Policy{Disposable: emailcheck.ActionAllow}, address: "ada@guerrillamail.com"},
+		{
+			name:           "typo warned",
+			policy:         emailcheck.DefaultPolicy,
+			address:        "ada@gmial.com",
+			wantWarnings:   []string{emailcheck.CheckTypo},
+			wantSuggestion: "ada@gmail.com",
+		},
+		{
+			name:           "typo blocked",
+			policy:         emailcheck.Policy{Typo: emailcheck.ActionBlock},
+			address:        "ada@hotmail.con",
+			wantBlocked:    emailcheck.CheckTypo,
+			wantSuggestion: "ada@hotmail.com",
+		},
+		{name: "typo allowed", policy: emailcheck.Policy{Typo: emailcheck.ActionAllow}, address: "ada@gmial.com"},
+		{name: "mx records", policy: mx(emailcheck.ActionBlock), address: "ada@example.com"},
+		{name: "address fallback", policy: mx(emailcheck.ActionBlock), address: "ada@example.org"},
+		{name: "null mx", policy: mx(emailcheck.ActionBlock), address: "ada@nullmx.example.net", wantBlocked: emailcheck.CheckNoMX},
+		{name: "no such domain", policy: mx(emailcheck.ActionBlock), address: "ada@example.invalid", wantBlocked: emailcheck.CheckNoMX},
+		{
+			name:         "no such domain warned",
+			policy:       mx(emailcheck.ActionWarn),
+			address:      "ada@example.invalid",
+			wantWarnings: []string{emailcheck.CheckNoMX},
+		},
+		{name: "mx not looked up", policy: emailcheck.DefaultPolicy, address: "ada@example.invalid"},
+		{
+			name:           "typo and no mx warned",
+			policy:         mx(emailcheck.ActionWarn),
+			address:        "ada@gmial.com",
+			wantWarnings:   []string{emailcheck.CheckTypo, emailcheck.CheckNoMX},
+			wantSuggestion: "ada@gmail.com",
+		},
+	}
+
+	disposable, err := emailcheck.LoadDisposable("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := &emailcheck.Checker{
+				Policy:     tt.policy,
+				Disposable: disposable,
+				Resolver:   resolver,
+			}
+
+			result, err := checker.Check(context.Background(), tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Blocked != tt.wantBlocked {
+				t.Errorf("Blocked = %q, want %q", result.Blocked, tt.wantBlocked)
+			}
+			if !slices.Equal(result.Warnings, tt.wantWarnings) {
+				t.Errorf("Warnings = %v, want %v", result.Warnings, tt.wantWarnings)
+			}
+			if result.Suggestion != tt.wantSuggestion {
+				t.Errorf("Suggestion = %q, want %q", result.Suggestion, tt.wantSuggestion)
+			}
+		})
+	}
+}
+
+func TestCheckInvalidAddress(t *testing.T) {
+	checker := &emailcheck.Checker{Policy: emailcheck.DefaultPolicy}
+
+	for _, address := range []string{"", "ada", "ada@", "@example.com", "ada@@example.com", "ada@example..com"} {
+		if _, err := checker.Check(context.Background(), address); !errors.Is(err, emailcheck.ErrInvalidAddress) {
+			t.Errorf("Check(%q) = %v, want ErrInvalidAddress", address, err)
+		}
+	}
+}
+
+// failingResolver fails every lookup the way a resolver that can't be
+// reached does.
+type failingResolver struct{}
+
+func (failingResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+}
+
+func (failingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+}
+
+// hangingResolver never answers before ctx is done.
+type hangingResolver struct{}
+
+func (hangingResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (hangingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCheckLookupFailureAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolver emailcheck.Resolver
+	}{
+		{name: "resolver error", resolver: failingResolver{}},
+		{name: "timeout", resolver: hangingResolver{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := &emailcheck.Checker{
+				Policy:        emailcheck.Policy{NoMX: emailcheck.ActionBlock},
+				Resolver:      tt.resolver,
+				LookupTimeout: 10 * time.Millisecond,
+			}
+
+			result, err := checker.Check(context.Background(), "ada@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Blocked != "" || len(result.Warnings) != 0 {
+				t.Fatalf("got blocked %q, warnings %v, want the address allowed", result.Blocked, result.Warnings)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"gmail.com", ""},
+		{"gmial.com", "gmail.com"},
+		{"gmail.con", "gmail.com"},
+		{"gmai.com", "gmail.com"},
+		{"hotmial.co.uk", "hotmail.co.uk"},
+		{"outlok.cm", "outlook.com"},
+		{"me.com", ""},
+		{"mw.com", "me.com"},
+		{"katanaid.com", ""},
+		{"example.com", ""},
+	}
+
+	for _, tt := range tests {
+		if got := emailcheck.Suggest(tt.domain); got != tt.want {
+			t.Errorf("Suggest(%q) = %q, want %q", tt.domain, got, tt.want)
+		}
+	}
+}
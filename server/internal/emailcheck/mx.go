@@ -0,0 +1,79 @@
+package emailcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Resolver looks up the DNS records that decide whether a domain accepts
+// mail. *net.Resolver implements it.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// acceptsMail reports whether domain can receive mail: it has MX records
+// other than the "." of a null MX (RFC 7505), or no MX records but an
+// address to fall back to (RFC 5321). Only a definite answer from DNS
+// returns false; lookup failures are returned as errors.
+func acceptsMail(ctx context.Context, resolver Resolver, domain string) (bool, error) {
+	records, err := resolver.LookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+
+	if len(records) > 0 {
+		for _, mx := range records {
+			if mx.Host != "." && mx.Host != "" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	hosts, err := resolver.LookupHost(ctx, domain)
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return len(hosts) > 0, nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// FakeResolver answers lookups from fixed records instead of DNS, for tests
+// and local development. Domains missing from both maps don't exist.
+type FakeResolver struct {
+	MX    map[string][]string
+	Hosts map[string][]string
+}
+
+func (f FakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	hosts, ok := f.MX[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	records := make([]*net.MX, len(hosts))
+	for i, host := range hosts {
+		records[i] = &net.MX{Host: host, Pref: uint16(10 * (i + 1))}
+	}
+
+	return records, nil
+}
+
+func (f FakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, ok := f.Hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return addrs, nil
+}
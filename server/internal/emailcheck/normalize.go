@@ -0,0 +1,101 @@
+package emailcheck
+
+import (
+	"strings"
+
+	"github.com/trnahnh/katana-id/util"
+)
+
+// Normalizer produces the normalized address accounts are matched by, so
+// that John@Example.com and john@example.com are one account. The domain is
+// always lowercased by Parse; the local part is lowercased too with
+// FoldLocalCase. RFC 5321 lets a mail server treat local parts as
+// case-sensitive, but no major provider does.
+//
+// Existing accounts were backfilled with folding on. Turning it off only
+// changes how new addresses are normalized; an account can always be found
+// by its exact address.
+//
+// StripMailboxVariants makes Mailbox ignore provider-specific dots and
+// subaddress tags. It never affects Normalize.
+type Normalizer struct {
+	FoldLocalCase        bool
+	StripMailboxVariants bool
+}
+
+// NormalizerFromEnv reads EMAIL_FOLD_LOCAL_CASE and
+// EMAIL_STRIP_MAILBOX_VARIANTS, which both default to true.
+func NormalizerFromEnv() Normalizer {
+	return Normalizer{
+		FoldLocalCase:        util.EnvBool("EMAIL_FOLD_LOCAL_CASE", true),
+		StripMailboxVariants: util.EnvBool("EMAIL_STRIP_MAILBOX_VARIANTS", true),
+	}
+}
+
+// Normalize returns the normalized form of addr.
+func (n Normalizer) Normalize(addr Address) string {
+	if n.FoldLocalCase {
+		return strings.ToLower(addr.Local) + "@" + addr.Domain
+	}
+
+	return addr.String()
+}
+
+// mailboxRule describes how a provider maps address variants onto one inbox.
+type mailboxRule struct {
+	// domain replaces the address's domain, for providers with aliases.
+	domain string
+	// ignoreDots is set for providers that ignore dots in the local part.
+	ignoreDots bool
+	// tag separates the local part from a subaddress tag the provider
+	// ignores when delivering.
+	tag string
+}
+
+var mailboxRules = map[string]mailboxRule{
+	"gmail.com":      {domain: "gmail.com", ignoreDots: true, tag: "+"},
+	"googlemail.com": {domain: "gmail.com", ignoreDots: true, tag: "+"},
+	"outlook.com":    {tag: "+"},
+	"hotmail.com":    {tag: "+"},
+	"live.com":       {tag: "+"},
+	"msn.com":        {tag: "+"},
+	"icloud.com":     {tag: "+"},
+	"me.com":         {tag: "+"},
+	"mac.com":        {tag: "+"},
+	"protonmail.com": {tag: "+"},
+	"proton.me":      {tag: "+"},
+	"pm.me":          {tag: "+"},
+	"fastmail.com":   {tag: "+"},
+	"yahoo.com":      {tag: "-"},
+	"ymail.com":      {tag: "-"},
+}
+
+// Mailbox returns a key for the inbox addr delivers to, for abuse checks
+// such as rate limits: with StripMailboxVariants, provider-specific variants
+// like j.doe+1@gmail.com and jdoe@googlemail.com share the key
+// jdoe@gmail.com; without, the key is just the lowercased address. It is
+// only used to group addresses, never to match accounts or send mail, since
+// a variant may be what the user deliberately signed up with.
+func (n Normalizer) Mailbox(addr Address) string {
+	local := strings.ToLower(addr.Local)
+	domain := addr.Domain
+
+	rule, ok := mailboxRules[domain]
+	if !ok || !n.StripMailboxVariants {
+		return local + "@" + domain
+	}
+
+	if rule.tag != "" {
+		if base, _, found := strings.Cut(local, rule.tag); found && base != "" {
+			local = base
+		}
+	}
+	if rule.ignoreDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	if rule.domain != "" {
+		domain = rule.domain
+	}
+
+	return local + "@" + domain
+}
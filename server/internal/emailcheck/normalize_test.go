@@ -0,0 +1,63 @@
+package emailcheck_test
+
+import (
+	"testing"
+
+	"github.com/trnahnh/katana-id/internal/emailcheck"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		address    string
+		normalizer emailcheck.Normalizer
+		want       string
+	}{
+		{"John.Doe+1@Example.COM", emailcheck.Normalizer{FoldLocalCase: true}, "john.doe+1@example.com"},
+		{"John.Doe+1@Example.COM", emailcheck.Normalizer{}, "John.Doe+1@example.com"},
+		// Normalize matches accounts, so it never strips mailbox variants.
+		{"J.Doe+1@gmail.com", emailcheck.Normalizer{FoldLocalCase: true, StripMailboxVariants: true}, "j.doe+1@gmail.com"},
+	}
+
+	for _, tt := range tests {
+		addr, err := emailcheck.Parse(tt.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tt.normalizer.Normalize(addr); got != tt.want {
+			t.Errorf("%+v.Normalize(%q) = %q, want %q", tt.normalizer, tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestMailbox(t *testing.T) {
+	strip := emailcheck.Normalizer{StripMailboxVariants: true}
+	keep := emailcheck.Normalizer{}
+
+	tests := []struct {
+		name       string
+		normalizer emailcheck.Normalizer
+		address    string
+		want       string
+	}{
+		{name: "gmail", normalizer: strip, address: "J.Doe+news@gmail.com", want: "jdoe@gmail.com"},
+		{name: "googlemail alias", normalizer: strip, address: "j.doe@googlemail.com", want: "jdoe@gmail.com"},
+		{name: "outlook keeps dots", normalizer: strip, address: "j.doe+news@outlook.com", want: "j.doe@outlook.com"},
+		{name: "yahoo tag", normalizer: strip, address: "jdoe-news@yahoo.com", want: "jdoe@yahoo.com"},
+		{name: "tag only", normalizer: strip, address: "+news@gmail.com", want: "+news@gmail.com"},
+		{name: "other provider", normalizer: strip, address: "J.Doe+news@example.com", want: "j.doe+news@example.com"},
+		{name: "disabled", normalizer: keep, address: "J.Doe+news@gmail.com", want: "j.doe+news@gmail.com"},
+		{name: "disabled alias", normalizer: keep, address: "jdoe@googlemail.com", want: "jdoe@googlemail.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := emailcheck.Parse(tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.normalizer.Mailbox(addr); got != tt.want {
+				t.Errorf("Mailbox(%q) = %q, want %q", tt.address, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package emailcheck
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var ErrInvalidAddress = errors.New("invalid email address")
+
+const (
+	maxAddressLength = 254
+	maxLocalLength   = 64
+	maxDomainLength  = 253
+	maxLabelLength   = 63
+)
+
+// Address is an email address that passed Parse.
+type Address struct {
+	Local string
+	// Domain is lowercase ASCII, with internationalized domains converted
+	// to punycode.
+	Domain string
+}
+
+func (a Address) String() string {
+	return a.Local + "@" + a.Domain
+}
+
+// Parse checks s against the subset of RFC 5322 that mail providers
+// reliably deliver to: a dot-atom local part and a domain name of at least
+// two labels. Quoted local parts, comments and IP literals are rejected,
+// as are non-ASCII local parts, which need SMTPUTF8 support all the way to
+// the recipient. Internationalized domains are accepted and converted to
+// punycode. Domains are case-insensitive, so they are lowercased; the local
+// part is kept as entered.
+func Parse(s string) (Address, error) {
+	s = strings.TrimSpace(s)
+
+	at := strings.LastIndexByte(s, '@')
+	if at < 0 {
+		return Address{}, ErrInvalidAddress
+	}
+	local, domain := s[:at], s[at+1:]
+
+	if !validLocal(local) {
+		return Address{}, ErrInvalidAddress
+	}
+
+	domain, ok := asciiDomain(domain)
+	if !ok {
+		return Address{}, ErrInvalidAddress
+	}
+
+	addr := Address{Local: local, Domain: domain}
+	if len(addr.String()) > maxAddressLength {
+		return Address{}, ErrInvalidAddress
+	}
+
+	return addr, nil
+}
+
+// validLocal reports whether local is a dot-atom: runs of atext separated
+// by single dots.
+func validLocal(local string) bool {
+	if local == "" || len(local) > maxLocalLength {
+		return false
+	}
+
+	for _, atom := range strings.Split(local, ".") {
+		if atom == "" {
+			return false
+		}
+		for i := 0; i < len(atom); i++ {
+			if !isAtext(atom[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func isAtext(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+
+	return strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0
+}
+
+// asciiDomain validates domain as a host name and returns it lowercased,
+// converted to punycode if it has non-ASCII characters.
+func asciiDomain(domain string) (string, bool) {
+	for i := 0; i < len(domain); i++ {
+		if domain[i] >= 0x80 {
+			var err error
+			if domain, err = idna.Lookup.ToASCII(domain); err != nil {
+				return "", false
+			}
+			break
+		}
+	}
+
+	if domain == "" || len(domain) > maxDomainLength {
+		return "", false
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", false
+	}
+	for _, label := range labels {
+		if !validLabel(label) {
+			return "", false
+		}
+	}
+
+	// Top-level domains are never all digits, which also rules out
+	// addresses at bare IPv4 addresses.
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return "", false
+	}
+
+	return strings.ToLower(domain), true
+}
+
+// validLabel reports whether label is letters, digits and hyphens, not
+// starting or ending with a hyphen.
+func validLabel(label string) bool {
+	if label == "" || len(label) > maxLabelLength || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,99 @@
+package emailcheck
+
+// commonDomains are the mailbox providers most sign-ups use, most popular
+// first so ties in Suggest go to the likelier one. Addresses at these
+// domains are never flagged as typos.
+var commonDomains = []string{
+	"gmail.com",
+	"yahoo.com",
+	"hotmail.com",
+	"outlook.com",
+	"icloud.com",
+	"live.com",
+	"aol.com",
+	"msn.com",
+	"me.com",
+	"mac.com",
+	"googlemail.com",
+	"protonmail.com",
+	"proton.me",
+	"hotmail.co.uk",
+	"yahoo.co.uk",
+	"ymail.com",
+	"gmx.com",
+	"gmx.de",
+	"gmx.net",
+	"web.de",
+	"mail.com",
+	"email.com",
+	"mail.ru",
+	"yandex.ru",
+	"zoho.com",
+	"fastmail.com",
+	"comcast.net",
+	"verizon.net",
+	"att.net",
+}
+
+var commonDomainSet = func() map[string]struct{} {
+	set := make(map[string]struct{}, len(commonDomains))
+	for _, d := range commonDomains {
+		set[d] = struct{}{}
+	}
+	return set
+}()
+
+// Suggest returns the common provider domain that domain looks like a typo
+// of, such as gmail.com for gmial.com or gmail.con, or "" if there is none.
+// Longer domains are allowed two edits, shorter ones only one, since short
+// real domains are often an edit apart.
+func Suggest(domain string) string {
+	if _, ok := commonDomainSet[domain]; ok {
+		return ""
+	}
+
+	best, bestDistance := "", 3
+	for _, candidate := range commonDomains {
+		allowed := 1
+		if len(candidate) >= 9 {
+			allowed = 2
+		}
+
+		d := editDistance(domain, candidate)
+		if d <= allowed && d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	return best
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// the number of insertions, deletions, substitutions and swaps of adjacent
+// characters that turn one into the other.
+func editDistance(a, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(b)]
+}
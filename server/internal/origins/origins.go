@@ -0,0 +1,228 @@
+// Package origins decides which browser origins may call the API, from
+// ALLOWED_ORIGINS plus the origins registered for apps in the database.
+package origins
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"golang.org/x/net/publicsuffix"
+)
+
+var (
+	ErrInvalidPattern = errors.New("origin must be scheme://host[:port], optionally with a *. subdomain wildcard")
+	ErrPublicWildcard = errors.New("wildcard origins must be under a registrable domain, not a public suffix such as *.com or *.github.io")
+)
+
+// Pattern matches origins. "https://app.example.com" matches only itself;
+// "https://*.example.com" matches any subdomain of example.com at any depth
+// but not example.com itself.
+type Pattern struct {
+	scheme string
+	host   string // without the "*." for wildcards
+	port   string
+	wild   bool
+}
+
+// ParsePattern parses an origin or wildcard origin pattern.
+func ParsePattern(s string) (Pattern, error) {
+	s = strings.TrimSpace(s)
+
+	wild := false
+	if scheme, rest, ok := strings.Cut(s, "://*."); ok {
+		s, wild = scheme+"://"+rest, true
+	}
+
+	scheme, host, port, ok := splitOrigin(s)
+	if !ok || strings.Contains(host, "*") {
+		return Pattern{}, ErrInvalidPattern
+	}
+	if wild && isPublic(host) {
+		return Pattern{}, ErrPublicWildcard
+	}
+
+	return Pattern{scheme: scheme, host: host, port: port, wild: wild}, nil
+}
+
+// isPublic reports whether host is one anyone can register names under, so
+// a wildcard on it would match sites of other owners: a public suffix from
+// ICANN ("com", "co.uk") or a private one ("github.io", "vercel.app"), a
+// single label, or an IP address.
+func isPublic(host string) bool {
+	if _, err := netip.ParseAddr(host); err == nil {
+		return true
+	}
+	if !strings.Contains(host, ".") {
+		return true
+	}
+
+	suffix, _ := publicsuffix.PublicSuffix(host)
+	return suffix == host
+}
+
+func (p Pattern) String() string {
+	host := p.host
+	if p.wild {
+		host = "*." + host
+	}
+	if p.port != "" {
+		host += ":" + p.port
+	}
+
+	return p.scheme + "://" + host
+}
+
+// Match reports whether origin is allowed by p.
+func (p Pattern) Match(origin string) bool {
+	scheme, host, port, ok := splitOrigin(origin)
+	if !ok || scheme != p.scheme || port != p.port {
+		return false
+	}
+
+	if !p.wild {
+		return host == p.host
+	}
+
+	// The label boundary matters: "evil-example.com" and
+	// "example.com.evil.com" must not match "*.example.com".
+	sub, ok := strings.CutSuffix(host, "."+p.host)
+	return ok && sub != "" && !strings.HasPrefix(sub, ".")
+}
+
+// splitOrigin breaks a serialized origin into its lowercased parts. Anything
+// beyond scheme, host and port, such as a path or credentials, makes it
+// invalid.
+func splitOrigin(origin string) (scheme, host, port string, ok bool) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || u.User != nil || u.Opaque != "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return "", "", "", false
+	}
+
+	scheme = strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", "", "", false
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", "", "", false
+	}
+
+	return scheme, host, u.Port(), true
+}
+
+// Validator allows origins matching the static patterns from config or the
+// ones registered in the app_origins table. Registered origins are cached
+// and reloaded by Start and Refresh, so lookups never hit the database.
+type Validator struct {
+	static  []Pattern
+	queries *gendb.Queries
+	dynamic atomic.Pointer[[]Pattern]
+}
+
+// NewValidator parses the comma-separated patterns in static and loads the
+// registered origins through queries, which may be nil to use only static.
+func NewValidator(ctx context.Context, static string, queries *gendb.Queries) (*Validator, error) {
+	v := &Validator{queries: queries}
+
+	for _, s := range strings.Split(static, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+
+		p, err := ParsePattern(s)
+		if err != nil {
+			return nil, errors.New("invalid ALLOWED_ORIGINS entry " + s + ": " + err.Error())
+		}
+		v.static = append(v.static, p)
+	}
+
+	if err := v.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Allowed reports whether origin may call the API.
+func (v *Validator) Allowed(origin string) bool {
+	if v.AllowedStatic(origin) {
+		return true
+	}
+
+	if dynamic := v.dynamic.Load(); dynamic != nil {
+		for _, p := range *dynamic {
+			if p.Match(origin) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// AllowedStatic reports whether origin matches the static patterns,
+// ignoring registered origins. Routes that change the account or administer
+// the service trust only these, so an app's frontend can sign its users in
+// but can't act with their cookies, or an admin's, anywhere else.
+func (v *Validator) AllowedStatic(origin string) bool {
+	for _, p := range v.static {
+		if p.Match(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Refresh reloads the registered origins. Rows that no longer parse are
+// skipped rather than failing the whole reload.
+func (v *Validator) Refresh(ctx context.Context) error {
+	if v.queries == nil {
+		return nil
+	}
+
+	rows, err := v.queries.ListAppOrigins(ctx)
+	if err != nil {
+		return err
+	}
+
+	patterns := make([]Pattern, 0, len(rows))
+	for _, row := range rows {
+		p, err := ParsePattern(row.Origin)
+		if err != nil {
+			log.Print("⚠️  Skipping invalid app origin ", row.Origin, " of ", row.AppName)
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+
+	v.dynamic.Store(&patterns)
+	return nil
+}
+
+// Start refreshes the registered origins every interval until ctx is done,
+// picking up changes made through other replicas.
+func (v *Validator) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := v.Refresh(ctx); err != nil {
+				log.Print("Failed to refresh app origins: ", err)
+			}
+		}
+	}
+}
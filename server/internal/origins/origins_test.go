@@ -0,0 +1,158 @@
+package origins
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr error
+	}{
+		{pattern: "https://app.example.com", want: "https://app.example.com"},
+		{pattern: " HTTPS://App.Example.COM/ ", want: "https://app.example.com"},
+		{pattern: "http://localhost:5173", want: "http://localhost:5173"},
+		{pattern: "https://*.example.com", want: "https://*.example.com"},
+		{pattern: "https://*.example.co.uk", want: "https://*.example.co.uk"},
+		{pattern: "https://*.katana.github.io", want: "https://*.katana.github.io"},
+
+		{pattern: "", wantErr: ErrInvalidPattern},
+		{pattern: "app.example.com", wantErr: ErrInvalidPattern},
+		{pattern: "ftp://example.com", wantErr: ErrInvalidPattern},
+		{pattern: "https://example.com/path", wantErr: ErrInvalidPattern},
+		{pattern: "https://user@example.com", wantErr: ErrInvalidPattern},
+		{pattern: "https://example.com?q=1", wantErr: ErrInvalidPattern},
+		{pattern: "https://*", wantErr: ErrInvalidPattern},
+		{pattern: "https://app.*.example.com", wantErr: ErrInvalidPattern},
+		{pattern: "https://*.*.example.com", wantErr: ErrInvalidPattern},
+		{pattern: "null", wantErr: ErrInvalidPattern},
+
+		// Wildcards under a public suffix match other people's sites.
+		{pattern: "https://*.com", wantErr: ErrPublicWildcard},
+		{pattern: "https://*.co.uk", wantErr: ErrPublicWildcard},
+		{pattern: "https://*.github.io", wantErr: ErrPublicWildcard},
+		{pattern: "https://*.vercel.app", wantErr: ErrPublicWildcard},
+		{pattern: "https://*.herokuapp.com", wantErr: ErrPublicWildcard},
+		{pattern: "http://*.localhost", wantErr: ErrPublicWildcard},
+		{pattern: "http://*.127.0.0.1", wantErr: ErrPublicWildcard},
+	}
+
+	for _, tt := range tests {
+		p, err := ParsePattern(tt.pattern)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParsePattern(%q) error = %v, want %v", tt.pattern, err, tt.wantErr)
+			continue
+		}
+		if err == nil && p.String() != tt.want {
+			t.Errorf("ParsePattern(%q) = %s, want %s", tt.pattern, p, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://EXAMPLE.com", true},
+		{"https://example.com", "https://example.com.", true},
+		{"https://example.com", "https://example.com/", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://example.com", "https://example.com:8443", false},
+		{"https://example.com", "https://app.example.com", false},
+		{"https://example.com", "https://evil-example.com", false},
+		{"https://example.com", "https://example.com.evil.com", false},
+		{"https://example.com", "https://example.com@evil.com", false},
+		{"https://example.com", "https://evil.com#example.com", false},
+		{"https://example.com", "null", false},
+		{"https://example.com", "", false},
+		{"http://localhost:5173", "http://localhost:5173", true},
+		{"http://localhost:5173", "http://localhost:5174", false},
+
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://APP.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "https://evil-example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://app.example.com.evil.com", false},
+		{"https://*.example.com", "https://app.example.com:443", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://app.example.com/path", false},
+	}
+
+	for _, tt := range tests {
+		p, err := ParsePattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Match(tt.origin); got != tt.want {
+			t.Errorf("%s.Match(%q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestValidatorStatic(t *testing.T) {
+	v, err := NewValidator(context.Background(), "https://katanaid.com, https://*.katanaid.com,", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for origin, want := range map[string]bool{
+		"https://katanaid.com":       true,
+		"https://www.katanaid.com":   true,
+		"https://evil-katanaid.com":  false,
+		"https://katanaid.com.evil":  false,
+		"http://katanaid.com":        false,
+		"https://katanaid.com:8080":  false,
+		"https://notkatanaid.com":    false,
+		"https://www.katanaid.co.uk": false,
+	} {
+		if got := v.Allowed(origin); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+
+	if _, err := NewValidator(context.Background(), "https://*.github.io", nil); err == nil {
+		t.Error("public suffix wildcard in ALLOWED_ORIGINS accepted")
+	}
+}
+
+func TestValidatorRegistered(t *testing.T) {
+	v, err := NewValidator(context.Background(), "https://katanaid.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := []Pattern{mustParse(t, "https://app.customer.com")}
+	v.dynamic.Store(&registered)
+
+	for origin, want := range map[string][2]bool{
+		"https://katanaid.com":     {true, true},
+		"https://app.customer.com": {true, false},
+		"https://evil.com":         {false, false},
+	} {
+		if got := v.Allowed(origin); got != want[0] {
+			t.Errorf("Allowed(%q) = %v, want %v", origin, got, want[0])
+		}
+		if got := v.AllowedStatic(origin); got != want[1] {
+			t.Errorf("AllowedStatic(%q) = %v, want %v", origin, got, want[1])
+		}
+	}
+}
+
+func mustParse(t *testing.T, s string) Pattern {
+	t.Helper()
+
+	p, err := ParsePattern(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
@@ -0,0 +1,49 @@
+package phone
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+)
+
+// Message is a message sent through Fake.
+type Message struct {
+	Channel string
+	To      string
+	Body    string
+}
+
+// Fake records messages instead of sending them, for tests and local
+// development. It supports every channel. With Log set it also logs them,
+// codes included, so it must never run in production.
+type Fake struct {
+	Log bool
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (f *Fake) Supports(channel string) bool {
+	return channel == ChannelSMS || channel == ChannelWhatsApp
+}
+
+func (f *Fake) Send(ctx context.Context, channel string, to string, body string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.messages = append(f.messages, Message{Channel: channel, To: to, Body: body})
+	if f.Log {
+		log.Print("📱 ", channel, " to ", to, ": ", body)
+	}
+
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (f *Fake) Messages() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return slices.Clone(f.messages)
+}
@@ -0,0 +1,81 @@
+package phone
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is Twilio's API.
+const DefaultBaseURL = "https://api.twilio.com"
+
+// HTTPProvider sends messages through a Twilio-compatible REST API: a form
+// POST of To, From and Body to
+// {BaseURL}/2010-04-01/Accounts/{AccountSID}/Messages.json with basic auth.
+// WhatsApp messages use the same endpoint with "whatsapp:"-prefixed numbers.
+type HTTPProvider struct {
+	BaseURL    string
+	AccountSID string
+	AuthToken  string
+	From       string
+	// WhatsAppFrom is the WhatsApp sender number. WhatsApp is unavailable
+	// when it is empty.
+	WhatsAppFrom string
+	Client       *http.Client
+}
+
+type httpProviderError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (p *HTTPProvider) Supports(channel string) bool {
+	switch channel {
+	case ChannelSMS:
+		return true
+	case ChannelWhatsApp:
+		return p.WhatsAppFrom != ""
+	}
+	return false
+}
+
+func (p *HTTPProvider) Send(ctx context.Context, channel string, to string, body string) error {
+	from := p.From
+	if channel == ChannelWhatsApp {
+		from, to = "whatsapp:"+p.WhatsAppFrom, "whatsapp:"+to
+	}
+
+	form := url.Values{"To": {to}, "From": {from}, "Body": {body}}
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", strings.TrimSuffix(p.BaseURL, "/"), url.PathEscape(p.AccountSID))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(p.AccountSID, p.AuthToken)
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var providerErr httpProviderError
+		json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&providerErr)
+		return fmt.Errorf("%s message failed with status %d: %d %s", channel, res.StatusCode, providerErr.Code, providerErr.Message)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+// Package phone validates phone numbers and delivers text messages over SMS
+// and WhatsApp.
+package phone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Channels a Provider may deliver over.
+const (
+	ChannelSMS      = "sms"
+	ChannelWhatsApp = "whatsapp"
+)
+
+var (
+	ErrInvalidNumber = errors.New("invalid phone number")
+
+	e164Regex = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+)
+
+// Normalize returns s in E.164 form, such as "+14155552671". Spaces, dots,
+// dashes and parentheses are tolerated; the country code is required.
+func Normalize(s string) (string, error) {
+	number := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+
+	if strings.HasPrefix(number, "00") {
+		number = "+" + number[2:]
+	}
+
+	if !e164Regex.MatchString(number) {
+		return "", ErrInvalidNumber
+	}
+
+	return number, nil
+}
+
+// Provider delivers text messages.
+type Provider interface {
+	// Supports reports whether the provider is set up for channel.
+	Supports(channel string) bool
+	Send(ctx context.Context, channel string, to string, body string) error
+}
+
+// ProviderFromEnv builds the provider named by PHONE_PROVIDER: "twilio" for
+// a Twilio-compatible HTTP API, or "fake" to log messages instead of
+// sending them. It returns nil when PHONE_PROVIDER is unset, which turns
+// phone sign-in off.
+func ProviderFromEnv() (Provider, error) {
+	switch kind := os.Getenv("PHONE_PROVIDER"); kind {
+	case "":
+		return nil, nil
+	case "fake":
+		return &Fake{Log: true}, nil
+	case "twilio":
+		provider := &HTTPProvider{
+			BaseURL:      os.Getenv("TWILIO_BASE_URL"),
+			AccountSID:   os.Getenv("TWILIO_ACCOUNT_SID"),
+			AuthToken:    os.Getenv("TWILIO_AUTH_TOKEN"),
+			From:         os.Getenv("TWILIO_FROM"),
+			WhatsAppFrom: os.Getenv("TWILIO_WHATSAPP_FROM"),
+		}
+		if provider.BaseURL == "" {
+			provider.BaseURL = DefaultBaseURL
+		}
+		if provider.AccountSID == "" || provider.AuthToken == "" || provider.From == "" {
+			return nil, errors.New("PHONE_PROVIDER=twilio needs TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM")
+		}
+		return provider, nil
+	default:
+		return nil, fmt.Errorf("unknown PHONE_PROVIDER %q", kind)
+	}
+}
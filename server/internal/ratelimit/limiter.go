@@ -0,0 +1,255 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trnahnh/katana-id/internal/emailcheck"
+	"github.com/trnahnh/katana-id/internal/phone"
+	"github.com/trnahnh/katana-id/util"
+)
+
+// maxBody bounds the JSON bodies of routes with rules keyed on the email or
+// phone. Larger bodies are refused rather than passed on partly read, since
+// the handler would still read the key from them.
+const maxBody = 64 << 10
+
+// keyFunc derives a rule's key from the request and its JSON body. An empty
+// key means the rule doesn't apply to the request.
+type keyFunc func(r *http.Request, body bodyFields, normalizer emailcheck.Normalizer) string
+
+var keyFuncs = map[string]keyFunc{
+	"global": func(r *http.Request, body bodyFields, normalizer emailcheck.Normalizer) string {
+		return "*"
+	},
+	"ip": func(r *http.Request, body bodyFields, normalizer emailcheck.Normalizer) string {
+		return util.ClientIP(r)
+	},
+	"subnet":  subnetKey,
+	"email":   emailKey,
+	"mailbox": mailboxKey,
+	"phone":   phoneKey,
+}
+
+// bodyKeys are the keys read from the JSON body.
+var bodyKeys = map[string]bool{"email": true, "mailbox": true, "phone": true}
+
+// sharedKeys are the keys many clients share. Their rules are only charged
+// for requests the client's own rules let through, so a client over its own
+// limit can't use up the budget of everyone else.
+var sharedKeys = map[string]bool{"global": true, "subnet": true}
+
+type limit struct {
+	Rule
+	counter Counter
+	keyFn   keyFunc
+}
+
+// Middleware enforces the rules of route. A request counts against the
+// client's own rules first, and against the shared global and subnet rules
+// only if it is within those; it is let through if it exceeds none, so
+// concurrent requests can't all slip in under the last free slot. Requests
+// turned away count too, which keeps clients that retry in a loop limited.
+// On routes with rules keyed on the body, requests whose body doesn't parse
+// or carries none of the keys are refused. Mailbox rules group addresses
+// with normalizer. Responses carry RateLimit-* headers for the most
+// restrictive rule.
+func (p Policy) Middleware(backend Backend, normalizer emailcheck.Normalizer, route string) (func(http.Handler) http.Handler, error) {
+	rules, ok := p[route]
+	if !ok {
+		return nil, fmt.Errorf("rate limit policy has no route %q", route)
+	}
+
+	var (
+		own, shared []limit
+		readsBody   bool
+	)
+	policies := make([]string, len(rules))
+	for i, rule := range rules {
+		counter := backend.Counter(route+":"+rule.Key+":"+strconv.Itoa(i), time.Duration(rule.Window))
+		l := limit{Rule: rule, counter: counter, keyFn: keyFuncs[rule.Key]}
+		if sharedKeys[rule.Key] {
+			shared = append(shared, l)
+		} else {
+			own = append(own, l)
+		}
+		readsBody = readsBody || bodyKeys[rule.Key]
+		policies[i] = fmt.Sprintf("%d;w=%d", rule.Requests+rule.Burst, int(time.Duration(rule.Window).Seconds()))
+	}
+	policy := strings.Join(policies, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body bodyFields
+			if readsBody {
+				var err error
+				if body, err = readBodyFields(w, r); err != nil {
+					var tooLarge *http.MaxBytesError
+					if errors.As(err, &tooLarge) {
+						util.WriteJSON(w, http.StatusRequestEntityTooLarge, util.ErrorResponse{Error: "Request too large"})
+						return
+					}
+					util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid request"})
+					return
+				}
+			}
+
+			ownKeys, keyed := keys(own, r, body, normalizer)
+			if readsBody && !keyed {
+				util.WriteJSON(w, http.StatusBadRequest, util.ErrorResponse{Error: "Invalid request"})
+				return
+			}
+
+			now := time.Now().UTC()
+
+			var tightest *limit
+			tightestRemaining, tightestReset := math.MaxInt, 0
+			take := func(limits []limit, keys []string) {
+				for i := range limits {
+					if keys[i] == "" {
+						continue
+					}
+
+					remaining, reset := limits[i].take(keys[i], now)
+					if remaining < tightestRemaining {
+						tightest, tightestRemaining, tightestReset = &limits[i], remaining, reset
+					}
+				}
+			}
+
+			take(own, ownKeys)
+			if tightestRemaining >= 0 {
+				sharedRuleKeys, _ := keys(shared, r, body, normalizer)
+				take(shared, sharedRuleKeys)
+			}
+
+			if tightest != nil {
+				header := w.Header()
+				header.Set("RateLimit-Policy", policy)
+				header.Set("RateLimit-Limit", strconv.Itoa(tightest.Requests+tightest.Burst))
+				header.Set("RateLimit-Reset", strconv.Itoa(tightestReset))
+
+				if tightestRemaining < 0 {
+					header.Set("RateLimit-Remaining", "0")
+					header.Set("Retry-After", strconv.Itoa(tightestReset))
+					util.WriteJSON(w, http.StatusTooManyRequests, util.ErrorResponse{Error: "Too many requests"})
+					return
+				}
+
+				header.Set("RateLimit-Remaining", strconv.Itoa(tightestRemaining))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// keys returns the key of each of limits for r, and whether any of them
+// came from the body.
+func keys(limits []limit, r *http.Request, body bodyFields, normalizer emailcheck.Normalizer) ([]string, bool) {
+	keys := make([]string, len(limits))
+	keyed := false
+	for i, l := range limits {
+		keys[i] = l.keyFn(r, body, normalizer)
+		keyed = keyed || (keys[i] != "" && bodyKeys[l.Key])
+	}
+
+	return keys, keyed
+}
+
+// take counts a request by key under l. It returns how many more requests
+// key may make, which is negative when this one is over the limit, and the
+// seconds until the current window ends. The rate is estimated over a
+// sliding window by weighting the previous window's count by how much of it
+// the sliding window still covers.
+func (l *limit) take(key string, now time.Time) (int, int) {
+	window := time.Duration(l.Window)
+	current := now.Truncate(window)
+
+	curr, prev := l.counter.Increment(key, current)
+
+	elapsed := now.Sub(current)
+	rate := float64(prev)*float64(window-elapsed)/float64(window) + float64(curr)
+	remaining := l.Requests + l.Burst - int(math.Round(rate))
+
+	return remaining, int(math.Ceil((window - elapsed).Seconds()))
+}
+
+// subnetKey is the client's /24 for IPv4 or /64 for IPv6, so that clients
+// rotating through addresses of one network share a limit.
+func subnetKey(r *http.Request, body bodyFields, normalizer emailcheck.Normalizer) string {
+	addr, err := netip.ParseAddr(util.ClientIP(r))
+	if err != nil {
+		return ""
+	}
+
+	bits := 64
+	if addr.Unmap().Is4() {
+		addr, bits = addr.Unmap(), 24
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+
+	return prefix.String()
+}
+
+// emailKey is the lowercased email field of a JSON body.
+func emailKey(r *http.Request, body bodyFields, normalizer emailcheck.Normalizer) string {
+	return strings.ToLower(strings.TrimSpace(body.Email))
+}
+
+// mailboxKey is the inbox the email field of a JSON body delivers to, so
+// provider variants such as Gmail's dots and +tags share a limit when the
+// normalizer strips them.
+func mailboxKey(r *http.Request, body bodyFields, normalizer emailcheck.Normalizer) string {
+	if addr, err := emailcheck.Parse(body.Email); err == nil {
+		return normalizer.Mailbox(addr)
+	}
+	return strings.ToLower(strings.TrimSpace(body.Email))
+}
+
+// phoneKey is the phone field of a JSON body in E.164 form, so differently
+// formatted copies of a number share a limit.
+func phoneKey(r *http.Request, body bodyFields, normalizer emailcheck.Normalizer) string {
+	if normalized, err := phone.Normalize(body.Phone); err == nil {
+		return normalized
+	}
+	return strings.TrimSpace(body.Phone)
+}
+
+type bodyFields struct {
+	Email string
+	Phone string
+}
+
+// readBodyFields reads the fields rules key on from a JSON body of at most
+// maxBody bytes, decoding it the way the handlers do. The body is restored
+// for the handler.
+func readBodyFields(w http.ResponseWriter, r *http.Request) (bodyFields, error) {
+	if r.Body == nil {
+		return bodyFields{}, nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		return bodyFields{}, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var fields bodyFields
+	err = json.NewDecoder(bytes.NewReader(body)).Decode(&fields)
+
+	return fields, err
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Memory keeps counters in process, so each replica enforces limits on its
+// own.
+type Memory struct{}
+
+func (Memory) Counter(name string, window time.Duration) Counter {
+	return &memoryCounter{window: window, keys: map[string]*memoryCount{}}
+}
+
+type memoryCounter struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	latest time.Time
+	keys   map[string]*memoryCount
+}
+
+// memoryCount is a key's count in the window starting at start and in the
+// one before it.
+type memoryCount struct {
+	start      time.Time
+	curr, prev int
+}
+
+func (c *memoryCounter) Increment(key string, window time.Time) (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous := window.Add(-c.window)
+
+	// Once a new window starts, keys not counted since before the previous
+	// one no longer count.
+	if window.After(c.latest) {
+		c.latest = window
+		for k, count := range c.keys {
+			if count.start.Before(previous) {
+				delete(c.keys, k)
+			}
+		}
+	}
+
+	count, ok := c.keys[key]
+	if !ok {
+		count = &memoryCount{start: window}
+		c.keys[key] = count
+	}
+	if !count.start.Equal(window) {
+		count.prev = 0
+		if count.start.Equal(previous) {
+			count.prev = count.curr
+		}
+		count.start, count.curr = window, 0
+	}
+
+	count.curr++
+
+	return count.curr, count.prev
+}
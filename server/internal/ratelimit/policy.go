@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+//go:embed policy.json
+var defaultPolicy []byte
+
+// Rule limits requests sharing a key to Requests per Window, plus Burst on
+// top to absorb short spikes such as a user retrying. Key is one of
+// "global", "ip", "subnet" (the client's /24 or /64), "email" or "phone"
+// (the email or phone field of a JSON request body) or "mailbox" (the inbox
+// the email field delivers to, ignoring provider variants like Gmail's dots
+// and +tags unless the normalizer keeps them).
+type Rule struct {
+	Key      string   `json:"key"`
+	Requests int      `json:"requests"`
+	Window   Duration `json:"window"`
+	Burst    int      `json:"burst"`
+}
+
+// Policy maps route names to the rules that all apply to them.
+type Policy map[string][]Rule
+
+// Duration is a time.Duration written as a Go duration string in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadPolicy reads the policy file at path, or the bundled default policy
+// when path is empty.
+func LoadPolicy(path string) (Policy, error) {
+	data := defaultPolicy
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid rate limit policy: %w", err)
+	}
+
+	for route, rules := range policy {
+		for _, rule := range rules {
+			if _, ok := keyFuncs[rule.Key]; !ok {
+				return nil, fmt.Errorf("rate limit policy %s: unknown key %q", route, rule.Key)
+			}
+			if rule.Requests <= 0 || rule.Window <= 0 || rule.Burst < 0 {
+				return nil, fmt.Errorf("rate limit policy %s: %s rule needs positive requests and window", route, rule.Key)
+			}
+		}
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/db"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+// Postgres keeps counters in the rate_limits table. Run StartCleanup to
+// delete windows that no longer count.
+type Postgres struct {
+	Queries *gendb.Queries
+}
+
+func (p Postgres) Counter(name string, window time.Duration) Counter {
+	return &postgresCounter{queries: p.Queries, name: name, window: window}
+}
+
+type postgresCounter struct {
+	queries *gendb.Queries
+	name    string
+	window  time.Duration
+}
+
+func (c *postgresCounter) Increment(key string, window time.Time) (int, int) {
+	ctx, cancel := backendContext()
+	defer cancel()
+
+	curr, err := c.queries.IncrementRateLimit(ctx, gendb.IncrementRateLimitParams{
+		Key:         c.name + ":" + key,
+		WindowStart: pgtype.Timestamptz{Time: window, Valid: true},
+		Count:       1,
+		// The window still counts towards the sliding rate during the next
+		// one.
+		ExpiresAt: pgtype.Timestamptz{Time: window.Add(2 * c.window), Valid: true},
+	})
+	if err != nil {
+		failOpen(c.name, err)
+		return 0, 0
+	}
+
+	// Counters written moments ago may not have reached a replica yet.
+	prev, err := c.count(db.WithPrimary(ctx), key, window.Add(-c.window))
+	if err != nil {
+		failOpen(c.name, err)
+		return int(curr), 0
+	}
+
+	return int(curr), prev
+}
+
+func (c *postgresCounter) count(ctx context.Context, key string, window time.Time) (int, error) {
+	count, err := c.queries.GetRateLimit(ctx, gendb.GetRateLimitParams{
+		Key:         c.name + ":" + key,
+		WindowStart: pgtype.Timestamptz{Time: window, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+
+	return int(count), err
+}
+
+// StartCleanup deletes expired rate limit windows every interval until ctx
+// is done.
+func StartCleanup(ctx context.Context, queries *gendb.Queries, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := queries.DeleteExpiredRateLimits(ctx); err != nil {
+				log.Print("Failed to delete expired rate limits: ", err)
+			}
+		}
+	}
+}
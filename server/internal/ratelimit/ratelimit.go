@@ -0,0 +1,75 @@
+// Package ratelimit enforces the server's rate limit policy, with counters
+// kept in process or in a store shared across replicas.
+package ratelimit
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+// backendTimeout bounds each call to a shared backend. Counters don't take a
+// context, so the request's deadline doesn't apply.
+const backendTimeout = time.Second
+
+// Metrics counts backend failures. It is published through expvar as
+// "ratelimit".
+var Metrics = expvar.NewMap("ratelimit")
+
+// Backend creates the counters behind rate limiters. Counters of a shared
+// backend see every replica's traffic, so limits hold across replicas.
+type Backend interface {
+	// Counter returns the counter for the limiter called name, which counts
+	// in windows of length window. The name keeps limiters with equal keys
+	// apart in a shared store.
+	Counter(name string, window time.Duration) Counter
+}
+
+// Counter counts requests per key in fixed windows.
+type Counter interface {
+	// Increment counts a request by key in the window starting at window,
+	// and returns key's count in that window, this request included, and in
+	// the window before it. Counting and reading are one atomic step, so
+	// of concurrent requests each sees a different count.
+	Increment(key string, window time.Time) (curr int, prev int)
+}
+
+// New returns the backend called kind: "memory", "postgres" (using queries)
+// or "redis" (connecting to redisURL).
+func New(kind string, queries *gendb.Queries, redisURL string) (Backend, error) {
+	switch kind {
+	case "", "memory":
+		return Memory{}, nil
+	case "postgres":
+		return Postgres{Queries: queries}, nil
+	case "redis":
+		opts, err := redis.ParseURL(redisURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		return Redis{Client: redis.NewClient(opts)}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", kind)
+	}
+}
+
+// failOpen logs a backend failure. Counters report such failures as no hits
+// so an unavailable store doesn't take the API down with it.
+func failOpen(name string, err error) {
+	Metrics.Add("backend_errors", 1)
+	log.Print("⚠️  Rate limit backend failed for ", name, ", allowing request: ", err)
+}
+
+func backendContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), backendTimeout)
+}
+
+// windowKey names the counter of key in the window starting at window.
+func windowKey(name, key string, window time.Time) string {
+	return fmt.Sprintf("ratelimit:%s:%s:%d", name, key, window.Unix())
+}
@@ -0,0 +1,257 @@
+package ratelimit_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/trnahnh/katana-id/internal/db/dbtest"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+	"github.com/trnahnh/katana-id/internal/emailcheck"
+	"github.com/trnahnh/katana-id/internal/ratelimit"
+)
+
+// backends returns each backend under test. The Postgres one skips its test
+// without a database.
+var backends = map[string]func(t *testing.T) ratelimit.Backend{
+	"memory": func(t *testing.T) ratelimit.Backend {
+		return ratelimit.Memory{}
+	},
+	"redis": func(t *testing.T) ratelimit.Backend {
+		server := miniredis.RunT(t)
+		return ratelimit.Redis{Client: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+	},
+	"postgres": func(t *testing.T) ratelimit.Backend {
+		return ratelimit.Postgres{Queries: gendb.New(dbtest.New(t))}
+	},
+}
+
+func TestCounter(t *testing.T) {
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			backend := newBackend(t)
+			window := time.Now().UTC().Truncate(time.Minute)
+			previous := window.Add(-time.Minute)
+
+			counter := backend.Counter("send-otp:ip:0", time.Minute)
+			other := backend.Counter("verify-otp:ip:0", time.Minute)
+
+			tests := []struct {
+				counter  ratelimit.Counter
+				key      string
+				window   time.Time
+				wantCurr int
+				wantPrev int
+			}{
+				{counter, "1.2.3.4", previous, 1, 0},
+				{counter, "1.2.3.4", previous, 2, 0},
+				{counter, "1.2.3.4", window, 1, 2},
+				{counter, "1.2.3.4", window, 2, 2},
+				{counter, "5.6.7.8", window, 1, 0},
+				// Counters of different limiters are kept apart.
+				{other, "1.2.3.4", window, 1, 0},
+				// Two windows on, nothing counts.
+				{counter, "1.2.3.4", window.Add(2 * time.Minute), 1, 0},
+			}
+			for i, tt := range tests {
+				curr, prev := tt.counter.Increment(tt.key, tt.window)
+				if curr != tt.wantCurr || prev != tt.wantPrev {
+					t.Errorf("increment %d of %s = %d, %d, want %d, %d", i, tt.key, curr, prev, tt.wantCurr, tt.wantPrev)
+				}
+			}
+		})
+	}
+}
+
+// TestCounterConcurrent checks that concurrent increments each see their own
+// count, so no two requests can take the same slot.
+func TestCounterConcurrent(t *testing.T) {
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			counter := newBackend(t).Counter("send-otp:ip:0", time.Minute)
+			window := time.Now().UTC().Truncate(time.Minute)
+
+			const n = 50
+			var (
+				wg   sync.WaitGroup
+				mu   sync.Mutex
+				seen = map[int]bool{}
+			)
+			for range n {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					curr, _ := counter.Increment("1.2.3.4", window)
+					mu.Lock()
+					seen[curr] = true
+					mu.Unlock()
+				}()
+			}
+			wg.Wait()
+
+			for i := 1; i <= n; i++ {
+				if !seen[i] {
+					t.Fatalf("no increment saw count %d: %v", i, seen)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	policy := ratelimit.Policy{"send-otp": {
+		{Key: "ip", Requests: 2, Window: ratelimit.Duration(time.Hour)},
+		{Key: "global", Requests: 6, Window: ratelimit.Duration(time.Hour)},
+	}}
+
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			middleware, err := policy.Middleware(newBackend(t), emailcheck.Normalizer{}, "send-otp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			tests := []struct {
+				ip            string
+				wantStatus    int
+				wantRemaining string
+			}{
+				{"1.2.3.4", http.StatusOK, "1"},
+				{"1.2.3.4", http.StatusOK, "0"},
+				{"1.2.3.4", http.StatusTooManyRequests, "0"},
+				{"5.6.7.8", http.StatusOK, "1"},
+				{"5.6.7.8", http.StatusOK, "0"},
+				// The request turned away by its IP rule didn't use up
+				// the global rule, which has two requests left.
+				{"9.9.9.9", http.StatusOK, "1"},
+				{"9.9.9.9", http.StatusOK, "0"},
+				{"9.9.9.9", http.StatusTooManyRequests, "0"},
+				{"7.7.7.7", http.StatusTooManyRequests, "0"},
+			}
+			for i, tt := range tests {
+				req := httptest.NewRequest(http.MethodPost, "/auth/send-otp", nil)
+				req.RemoteAddr = tt.ip + ":1234"
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("request %d from %s: status = %d, want %d", i, tt.ip, rec.Code, tt.wantStatus)
+				}
+				if got := rec.Header().Get("RateLimit-Remaining"); got != tt.wantRemaining {
+					t.Errorf("request %d from %s: RateLimit-Remaining = %s, want %s", i, tt.ip, got, tt.wantRemaining)
+				}
+				if tt.wantStatus == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+					t.Errorf("request %d from %s: no Retry-After", i, tt.ip)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareBody(t *testing.T) {
+	policy := ratelimit.Policy{"send-otp": {
+		{Key: "mailbox", Requests: 2, Window: ratelimit.Duration(time.Hour)},
+		{Key: "phone", Requests: 2, Window: ratelimit.Duration(time.Hour)},
+	}}
+	middleware, err := policy.Middleware(ratelimit.Memory{}, emailcheck.Normalizer{StripMailboxVariants: true}, "send-otp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = string(body)
+	}))
+
+	padding := `"padding":"` + strings.Repeat("x", 64<<10) + `",`
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "email", body: `{"email":"ada@gmail.com"}`, wantStatus: http.StatusOK},
+		{name: "variant of the same mailbox", body: `{"email":"A.da+signup@gmail.com"}`, wantStatus: http.StatusOK},
+		{name: "mailbox over the limit", body: `{"email":"ada@gmail.com"}`, wantStatus: http.StatusTooManyRequests},
+		// Padding the body past what the limiter reads mustn't hide the
+		// email from it.
+		{name: "padded past the limit", body: `{` + padding + `"email":"ada@gmail.com"}`, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "phone", body: `{"phone":"+1 415 555 2671"}`, wantStatus: http.StatusOK},
+		{name: "no email or phone", body: `{"channel":"sms"}`, wantStatus: http.StatusBadRequest},
+		{name: "blank email", body: `{"email":"  "}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid json", body: `{"email":`, wantStatus: http.StatusBadRequest},
+		{name: "wrong type", body: `{"email":["ada@gmail.com"]}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		got = ""
+		req := httptest.NewRequest(http.MethodPost, "/auth/send-otp", strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.wantStatus, rec.Body)
+		}
+		if tt.wantStatus == http.StatusOK && got != tt.body {
+			t.Errorf("%s: handler read %q, want the whole body", tt.name, got)
+		}
+	}
+}
+
+func TestMiddlewareMailboxVariantsKept(t *testing.T) {
+	policy := ratelimit.Policy{"send-otp": {{Key: "mailbox", Requests: 1, Window: ratelimit.Duration(time.Hour)}}}
+	middleware, err := policy.Middleware(ratelimit.Memory{}, emailcheck.Normalizer{}, "send-otp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		body       string
+		wantStatus int
+	}{
+		{`{"email":"ada@gmail.com"}`, http.StatusOK},
+		// Without stripping, variants are limited as addresses of their own.
+		{`{"email":"a.da+signup@gmail.com"}`, http.StatusOK},
+		{`{"email":"ADA@gmail.com"}`, http.StatusTooManyRequests},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/auth/send-otp", strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("request %d: status = %d, want %d", i, rec.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestRedisFailsOpen(t *testing.T) {
+	server := miniredis.RunT(t)
+	backend := ratelimit.Redis{Client: redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})}
+
+	policy := ratelimit.Policy{"send-otp": {{Key: "global", Requests: 1, Window: ratelimit.Duration(time.Hour)}}}
+	middleware, err := policy.Middleware(backend, emailcheck.Normalizer{}, "send-otp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	server.Close()
+
+	for i := range 3 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/send-otp", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d with Redis down: status = %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keeps counters in Redis keys that expire once their window no
+// longer counts.
+type Redis struct {
+	Client *redis.Client
+}
+
+func (r Redis) Counter(name string, window time.Duration) Counter {
+	return &redisCounter{client: r.Client, name: name, window: window}
+}
+
+type redisCounter struct {
+	client *redis.Client
+	name   string
+	window time.Duration
+}
+
+func (c *redisCounter) Increment(key string, window time.Time) (int, int) {
+	ctx, cancel := backendContext()
+	defer cancel()
+
+	k := windowKey(c.name, key, window)
+
+	pipe := c.client.TxPipeline()
+	curr := pipe.IncrBy(ctx, k, 1)
+	pipe.Expire(ctx, k, 2*c.window)
+	prev := pipe.Get(ctx, windowKey(c.name, key, window.Add(-c.window)))
+	// A previous window without requests is a missing key, which Get
+	// reports as redis.Nil.
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		failOpen(c.name, err)
+		return 0, 0
+	}
+
+	p, _ := prev.Int()
+	return int(curr.Val()), p
+}
@@ -0,0 +1,266 @@
+// Package sessioncache keeps recently resolved sessions in memory so that
+// authenticated requests can skip the session and user lookups.
+package sessioncache
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+// channel is the Postgres NOTIFY channel invalidations are broadcast on.
+const channel = "session_cache_invalidate"
+
+// Metrics counts cache hits, misses, evictions and invalidations. It is
+// published through expvar as "session_cache".
+var Metrics = expvar.NewMap("session_cache")
+
+// Entry is a resolved session and the user it belongs to.
+type Entry struct {
+	Session gendb.Session
+	User    gendb.User
+}
+
+// Cache is a bounded LRU of resolved sessions whose entries live for at most
+// ttl. A nil *Cache is valid and caches nothing, so callers don't need to
+// check whether caching is enabled.
+type Cache struct {
+	size int
+	ttl  time.Duration
+	pool *pgxpool.Pool
+
+	mu     sync.Mutex
+	lru    *list.List
+	tokens map[pgtype.UUID]*list.Element
+	users  map[pgtype.UUID]map[pgtype.UUID]struct{}
+}
+
+type item struct {
+	token   pgtype.UUID
+	entry   Entry
+	expires time.Time
+}
+
+// New returns a cache holding up to size sessions for ttl each. When pool is
+// non-nil, invalidations are also broadcast to other server replicas through
+// Postgres NOTIFY; run Listen to receive theirs. A size or ttl of zero or
+// less disables caching: New returns nil, which caches nothing.
+func New(size int, ttl time.Duration, pool *pgxpool.Pool) *Cache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	return &Cache{
+		size:   size,
+		ttl:    ttl,
+		pool:   pool,
+		lru:    list.New(),
+		tokens: make(map[pgtype.UUID]*list.Element),
+		users:  make(map[pgtype.UUID]map[pgtype.UUID]struct{}),
+	}
+}
+
+// Get returns the cached entry for token, if any.
+func (c *Cache) Get(token pgtype.UUID) (Entry, bool) {
+	if c == nil {
+		return Entry{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.tokens[token]
+	if !ok {
+		Metrics.Add("misses", 1)
+		return Entry{}, false
+	}
+
+	it := el.Value.(*item)
+	if time.Now().After(it.expires) {
+		c.remove(el)
+		Metrics.Add("misses", 1)
+		return Entry{}, false
+	}
+
+	c.lru.MoveToFront(el)
+	Metrics.Add("hits", 1)
+	return it.entry, true
+}
+
+// Put caches entry under token, evicting the least recently used entry if
+// the cache is full. Entries never outlive the session itself.
+func (c *Cache) Put(token pgtype.UUID, entry Entry) {
+	if c == nil {
+		return
+	}
+
+	expires := time.Now().Add(c.ttl)
+	if entry.Session.ExpiresAt.Valid && entry.Session.ExpiresAt.Time.Before(expires) {
+		expires = entry.Session.ExpiresAt.Time
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.tokens[token]; ok {
+		c.remove(el)
+	}
+
+	c.tokens[token] = c.lru.PushFront(&item{token: token, entry: entry, expires: expires})
+	if c.users[entry.User.ID] == nil {
+		c.users[entry.User.ID] = make(map[pgtype.UUID]struct{})
+	}
+	c.users[entry.User.ID][token] = struct{}{}
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		Metrics.Add("evictions", 1)
+	}
+}
+
+// InvalidateToken drops the session token, on this replica and, when
+// broadcasting, on the others.
+func (c *Cache) InvalidateToken(ctx context.Context, token pgtype.UUID) {
+	if c == nil {
+		return
+	}
+
+	c.dropToken(token)
+	c.broadcast(ctx, "token:"+uuid.UUID(token.Bytes).String())
+}
+
+// InvalidateUser drops every session of userID. Call it whenever the user's
+// sessions are revoked or the user row changes.
+func (c *Cache) InvalidateUser(ctx context.Context, userID pgtype.UUID) {
+	if c == nil {
+		return
+	}
+
+	c.dropUser(userID)
+	c.broadcast(ctx, "user:"+uuid.UUID(userID.Bytes).String())
+}
+
+// Listen applies invalidations broadcast by other replicas until ctx is
+// done, reconnecting when the connection drops. It returns immediately when
+// the cache doesn't broadcast.
+func (c *Cache) Listen(ctx context.Context) {
+	if c == nil || c.pool == nil {
+		return
+	}
+
+	for ctx.Err() == nil {
+		err := c.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Print("⚠️  Session cache listener failed, reconnecting: ", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (c *Cache) listen(ctx context.Context) error {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection stays subscribed, so keep it out of the pool.
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+
+	if _, err := pgConn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+
+	// Anything broadcast while we weren't listening is lost.
+	c.clear()
+
+	for {
+		notification, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		c.apply(notification.Payload)
+	}
+}
+
+func (c *Cache) apply(payload string) {
+	kind, value, _ := strings.Cut(payload, ":")
+
+	id, err := uuid.Parse(value)
+	if err != nil {
+		log.Print("⚠️  Invalid session cache invalidation: ", payload)
+		return
+	}
+
+	switch kind {
+	case "token":
+		c.dropToken(pgtype.UUID{Bytes: id, Valid: true})
+	case "user":
+		c.dropUser(pgtype.UUID{Bytes: id, Valid: true})
+	}
+}
+
+func (c *Cache) broadcast(ctx context.Context, payload string) {
+	if c.pool == nil {
+		return
+	}
+
+	if _, err := c.pool.Exec(ctx, "SELECT pg_notify($1, $2)", channel, payload); err != nil {
+		log.Print("⚠️  Failed to broadcast session cache invalidation: ", err)
+	}
+}
+
+func (c *Cache) dropToken(token pgtype.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.tokens[token]; ok {
+		c.remove(el)
+		Metrics.Add("invalidations", 1)
+	}
+}
+
+func (c *Cache) dropUser(userID pgtype.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for token := range c.users[userID] {
+		c.remove(c.tokens[token])
+		Metrics.Add("invalidations", 1)
+	}
+}
+
+func (c *Cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	clear(c.tokens)
+	clear(c.users)
+}
+
+// remove drops el from every index. c.mu must be held.
+func (c *Cache) remove(el *list.Element) {
+	it := c.lru.Remove(el).(*item)
+	delete(c.tokens, it.token)
+
+	tokens := c.users[it.entry.User.ID]
+	delete(tokens, it.token)
+	if len(tokens) == 0 {
+		delete(c.users, it.entry.User.ID)
+	}
+}
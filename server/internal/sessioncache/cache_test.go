@@ -0,0 +1,190 @@
+package sessioncache
+
+import (
+	"context"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/trnahnh/katana-id/internal/db/generated"
+)
+
+func newID() pgtype.UUID {
+	return pgtype.UUID{Bytes: uuid.New(), Valid: true}
+}
+
+// entry returns a session of userID that expires at expires, or never when
+// expires is zero.
+func entry(userID pgtype.UUID, expires time.Time) Entry {
+	return Entry{
+		Session: gendb.Session{UserID: userID, ExpiresAt: pgtype.Timestamptz{Time: expires, Valid: !expires.IsZero()}},
+		User:    gendb.User{ID: userID},
+	}
+}
+
+// counter returns the current value of the named metric.
+func counter(name string) int64 {
+	v, _ := Metrics.Get(name).(*expvar.Int)
+	if v == nil {
+		return 0
+	}
+	return v.Value()
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	token := newID()
+
+	c.Put(token, entry(newID(), time.Time{}))
+	if _, ok := c.Get(token); ok {
+		t.Fatal("nil cache returned an entry")
+	}
+	c.InvalidateToken(context.Background(), token)
+	c.InvalidateUser(context.Background(), newID())
+
+	if New(0, time.Minute, nil) != nil || New(10, 0, nil) != nil {
+		t.Fatal("New with a zero size or ttl returned a cache")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c := New(2, time.Minute, nil)
+	user := newID()
+	first, second, third := newID(), newID(), newID()
+	evictions := counter("evictions")
+
+	c.Put(first, entry(user, time.Time{}))
+	c.Put(second, entry(user, time.Time{}))
+	// Using first makes second the least recently used.
+	if _, ok := c.Get(first); !ok {
+		t.Fatal("first not cached")
+	}
+	c.Put(third, entry(user, time.Time{}))
+
+	if _, ok := c.Get(second); ok {
+		t.Error("second not evicted")
+	}
+	for _, token := range []pgtype.UUID{first, third} {
+		if _, ok := c.Get(token); !ok {
+			t.Errorf("%v evicted", token)
+		}
+	}
+	if got := len(c.users[user]); got != 2 {
+		t.Errorf("users index holds %d tokens, want 2", got)
+	}
+	if got := counter("evictions") - evictions; got != 1 {
+		t.Errorf("evictions = %d, want 1", got)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		expires time.Time
+		wait    time.Duration
+		wantHit bool
+	}{
+		{name: "fresh", ttl: time.Minute, wantHit: true},
+		{name: "ttl passed", ttl: 10 * time.Millisecond, wait: 20 * time.Millisecond},
+		{name: "session expired", ttl: time.Minute, expires: time.Now().Add(10 * time.Millisecond), wait: 20 * time.Millisecond},
+		{name: "session outlives ttl", ttl: time.Minute, expires: time.Now().Add(time.Hour), wantHit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(10, tt.ttl, nil)
+			user, token := newID(), newID()
+
+			c.Put(token, entry(user, tt.expires))
+			time.Sleep(tt.wait)
+
+			if _, ok := c.Get(token); ok != tt.wantHit {
+				t.Fatalf("hit = %v, want %v", ok, tt.wantHit)
+			}
+			if !tt.wantHit {
+				if len(c.tokens) != 0 || len(c.users) != 0 || c.lru.Len() != 0 {
+					t.Fatal("expired entry left in the cache")
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	ctx := context.Background()
+	c := New(10, time.Minute, nil)
+	ada, bob := newID(), newID()
+	adaPhone, adaLaptop, bobPhone := newID(), newID(), newID()
+
+	c.Put(adaPhone, entry(ada, time.Time{}))
+	c.Put(adaLaptop, entry(ada, time.Time{}))
+	c.Put(bobPhone, entry(bob, time.Time{}))
+	invalidations := counter("invalidations")
+
+	c.InvalidateToken(ctx, adaPhone)
+	if _, ok := c.Get(adaPhone); ok {
+		t.Error("invalidated token still cached")
+	}
+	if _, ok := c.Get(adaLaptop); !ok {
+		t.Error("other session of the user dropped")
+	}
+	if _, ok := c.users[ada][adaPhone]; ok {
+		t.Error("invalidated token left in the users index")
+	}
+
+	c.InvalidateUser(ctx, ada)
+	if _, ok := c.Get(adaLaptop); ok {
+		t.Error("session of invalidated user still cached")
+	}
+	if _, ok := c.users[ada]; ok {
+		t.Error("invalidated user left in the users index")
+	}
+	if _, ok := c.Get(bobPhone); !ok {
+		t.Error("session of another user dropped")
+	}
+
+	// Invalidating what isn't cached counts nothing.
+	c.InvalidateToken(ctx, adaPhone)
+	c.InvalidateUser(ctx, ada)
+
+	if got := counter("invalidations") - invalidations; got != 2 {
+		t.Errorf("invalidations = %d, want 2", got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	c := New(10, time.Minute, nil)
+	user, token := newID(), newID()
+	c.Put(token, entry(user, time.Time{}))
+
+	c.apply("token:not-a-uuid")
+	if _, ok := c.Get(token); !ok {
+		t.Fatal("invalid payload dropped an entry")
+	}
+
+	c.apply("user:" + uuid.UUID(user.Bytes).String())
+	if _, ok := c.Get(token); ok {
+		t.Fatal("broadcast user invalidation not applied")
+	}
+}
+
+func TestHitsAndMisses(t *testing.T) {
+	c := New(10, time.Minute, nil)
+	token := newID()
+	hits, misses := counter("hits"), counter("misses")
+
+	c.Get(token)
+	c.Put(token, entry(newID(), time.Time{}))
+	c.Get(token)
+	c.Get(token)
+
+	if got := counter("hits") - hits; got != 2 {
+		t.Errorf("hits = %d, want 2", got)
+	}
+	if got := counter("misses") - misses; got != 1 {
+		t.Errorf("misses = %d, want 1", got)
+	}
+}
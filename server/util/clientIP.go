@@ -0,0 +1,156 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ClientIP returns the client address resolved by ClientIPResolver, or the
+// peer address when the request didn't pass through it.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+
+	return peerIP(r)
+}
+
+// ClientIPResolver determines the client address of requests that may have
+// come through proxies. Forwarded and X-Forwarded-For are only honored when
+// the peer is one of Trusted, and only back to the first hop that isn't,
+// since anything before it can be forged by the client.
+type ClientIPResolver struct {
+	Trusted []netip.Prefix
+}
+
+// ParseTrustedProxies parses a comma-separated list of CIDRs or addresses
+// such as "10.0.0.0/8,192.168.1.10".
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// Middleware resolves the client address once per request so ClientIP
+// returns the same value to rate limiting, sessions and audit logs.
+func (c ClientIPResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey{}, c.Resolve(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Resolve walks the forwarding chain from the peer towards the client and
+// returns the first address not covered by Trusted.
+func (c ClientIPResolver) Resolve(r *http.Request) string {
+	peer := peerIP(r)
+
+	client, err := netip.ParseAddr(peer)
+	if err != nil || !c.trusted(client) {
+		return peer
+	}
+
+	hops := forwardedHops(r)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			// A trusted proxy passed on a value it couldn't vouch for.
+			break
+		}
+
+		client = hop
+		if !c.trusted(hop) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+func (c ClientIPResolver) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range c.Trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// forwardedHops lists the "for" addresses of the RFC 7239 Forwarded header,
+// or of X-Forwarded-For when it is absent, client first.
+func forwardedHops(r *http.Request) []string {
+	var hops []string
+
+	if forwarded := r.Header.Values("Forwarded"); len(forwarded) > 0 {
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+		return hops
+	}
+
+	for _, hop := range strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",") {
+		if hop = strings.TrimSpace(hop); hop != "" {
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
+
+// parseHop parses a forwarded address, which may carry a port and, for
+// IPv6, brackets.
+func parseHop(hop string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
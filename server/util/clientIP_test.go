@@ -0,0 +1,107 @@
+package util_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/trnahnh/katana-id/util"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	resolver := util.ClientIPResolver{Trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+
+	tests := []struct {
+		name          string
+		peer          string
+		xForwardedFor string
+		forwarded     string
+		want          string
+	}{
+		{name: "direct", peer: "198.51.100.9:443", want: "198.51.100.9"},
+		{name: "untrusted peer spoofing", peer: "203.0.113.7:443", xForwardedFor: "198.51.100.9", want: "203.0.113.7"},
+		{name: "untrusted peer spoofing forwarded", peer: "203.0.113.7:443", forwarded: "for=198.51.100.9", want: "203.0.113.7"},
+		{name: "trusted peer", peer: "10.0.0.1:443", xForwardedFor: "198.51.100.9", want: "198.51.100.9"},
+		{name: "trusted peer without header", peer: "10.0.0.1:443", want: "10.0.0.1"},
+		{name: "trusted chain", peer: "10.0.0.1:443", xForwardedFor: "198.51.100.9, 10.0.0.3, 10.0.0.2", want: "198.51.100.9"},
+		{name: "spoofed before untrusted hop", peer: "10.0.0.1:443", xForwardedFor: "192.0.2.1, 198.51.100.9, 10.0.0.2", want: "198.51.100.9"},
+		{name: "only trusted hops", peer: "10.0.0.1:443", xForwardedFor: "10.0.0.3, 10.0.0.2", want: "10.0.0.3"},
+		{name: "garbage hop", peer: "10.0.0.1:443", xForwardedFor: "nonsense, 10.0.0.2", want: "10.0.0.2"},
+		{name: "forwarded", peer: "10.0.0.1:443", forwarded: "for=198.51.100.9;proto=https, for=10.0.0.2", want: "198.51.100.9"},
+		{name: "forwarded wins", peer: "10.0.0.1:443", forwarded: "for=198.51.100.9", xForwardedFor: "192.0.2.1", want: "198.51.100.9"},
+		{name: "forwarded quoted ipv6 with port", peer: "10.0.0.1:443", forwarded: `for="[2001:db8::1]:4711"`, want: "2001:db8::1"},
+		{name: "forwarded quoted ipv6", peer: "10.0.0.1:443", forwarded: `For="[2001:db8::1]"`, want: "2001:db8::1"},
+		{name: "forwarded ipv4 with port", peer: "10.0.0.1:443", forwarded: `for="198.51.100.9:4711"`, want: "198.51.100.9"},
+		{name: "forwarded unknown", peer: "10.0.0.1:443", forwarded: "for=unknown", want: "10.0.0.1"},
+		{name: "forwarded unknown before trusted hop", peer: "10.0.0.1:443", forwarded: "for=unknown, for=10.0.0.2", want: "10.0.0.2"},
+		{name: "forwarded obfuscated", peer: "10.0.0.1:443", forwarded: "for=_hidden", want: "10.0.0.1"},
+		{name: "ipv4-mapped trusted peer", peer: "[::ffff:10.0.0.1]:443", xForwardedFor: "198.51.100.9", want: "198.51.100.9"},
+		{name: "ipv4-mapped untrusted peer", peer: "[::ffff:203.0.113.7]:443", xForwardedFor: "198.51.100.9", want: "::ffff:203.0.113.7"},
+		{name: "ipv4-mapped hop", peer: "10.0.0.1:443", xForwardedFor: "::ffff:198.51.100.9", want: "198.51.100.9"},
+		{name: "ipv4-mapped trusted hop", peer: "10.0.0.1:443", xForwardedFor: "198.51.100.9, ::ffff:10.0.0.2", want: "198.51.100.9"},
+		{name: "ipv6 peer", peer: "[2001:db8::5]:443", xForwardedFor: "198.51.100.9", want: "2001:db8::5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			if tt.xForwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.xForwardedFor)
+			}
+			if tt.forwarded != "" {
+				req.Header.Set("Forwarded", tt.forwarded)
+			}
+
+			if got := resolver.Resolve(req); got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	resolver := util.ClientIPResolver{Trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:443"
+	req.Header.Set("X-Forwarded-For", "198.51.100.9")
+
+	if got := util.ClientIP(req); got != "10.0.0.1" {
+		t.Fatalf("ClientIP() before resolving = %q, want the peer", got)
+	}
+
+	var got string
+	resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = util.ClientIP(r)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "198.51.100.9" {
+		t.Fatalf("ClientIP() = %q, want 198.51.100.9", got)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := util.ParseTrustedProxies(" 10.1.2.3/8, 192.168.1.10 ,,::ffff:172.16.0.1, 2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.10/32"),
+		netip.MustParsePrefix("172.16.0.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("ParseTrustedProxies() = %v, want %v", got, want)
+	}
+
+	for _, s := range []string{"10.0.0.0/33", "proxy.internal"} {
+		if _, err := util.ParseTrustedProxies(s); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded, want an error", s)
+		}
+	}
+}
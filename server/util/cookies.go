@@ -0,0 +1,110 @@
+package util
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Cookies sets every cookie the server issues, so they all share the same
+// hardening. In dev mode cookies work over plain HTTP: they aren't Secure
+// and carry no prefix.
+type Cookies struct {
+	// Prefix adds __Host- to cookie names, or __Secure- when Domain is set,
+	// so browsers reject the cookies unless set securely by this host.
+	Prefix   bool
+	Domain   string
+	SameSite http.SameSite
+	Dev      bool
+}
+
+// CookiesFromEnv reads COOKIE_PREFIX, COOKIE_DOMAIN and COOKIE_SAMESITE,
+// and DEV_MODE for dev mode. COOKIE_PREFIX defaults to false: turning it on
+// renames the cookies, which signs everyone out.
+func CookiesFromEnv() Cookies {
+	c := Cookies{
+		Prefix:   EnvBool("COOKIE_PREFIX", false),
+		Domain:   os.Getenv("COOKIE_DOMAIN"),
+		SameSite: http.SameSiteLaxMode,
+		Dev:      EnvBool("DEV_MODE", false),
+	}
+
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "", "lax":
+	case "strict":
+		c.SameSite = http.SameSiteStrictMode
+	case "none":
+		if c.Dev {
+			// Browsers drop SameSite=None cookies that aren't Secure.
+			log.Fatal("COOKIE_SAMESITE=none needs HTTPS and can't be used in dev mode")
+		}
+		c.SameSite = http.SameSiteNoneMode
+	default:
+		log.Fatal("Invalid COOKIE_SAMESITE: ", os.Getenv("COOKIE_SAMESITE"))
+	}
+
+	return c
+}
+
+// Name returns the name the cookie called name is actually stored under.
+func (c Cookies) Name(name string) string {
+	switch {
+	case c.Dev || !c.Prefix:
+		return name
+	case c.Domain != "":
+		return "__Secure-" + name
+	default:
+		return "__Host-" + name
+	}
+}
+
+// Get reads the cookie called name from r.
+func (c Cookies) Get(r *http.Request, name string) (string, error) {
+	cookie, err := r.Cookie(c.Name(name))
+	if err != nil {
+		return "", err
+	}
+
+	return cookie.Value, nil
+}
+
+// Set sets the cookie called name for maxAge. httpOnly hides it from
+// scripts.
+func (c Cookies) Set(w http.ResponseWriter, name string, value string, maxAge time.Duration, httpOnly bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.Name(name),
+		Value:    value,
+		Path:     "/",
+		Domain:   c.domain(),
+		MaxAge:   max(int(maxAge.Seconds()), 1),
+		HttpOnly: httpOnly,
+		Secure:   !c.Dev,
+		SameSite: c.SameSite,
+	})
+}
+
+// Clear deletes the cookie called name. The attributes must match the ones
+// it was set with, or browsers keep it.
+func (c Cookies) Clear(w http.ResponseWriter, name string, httpOnly bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.Name(name),
+		Value:    "",
+		Path:     "/",
+		Domain:   c.domain(),
+		MaxAge:   -1,
+		HttpOnly: httpOnly,
+		Secure:   !c.Dev,
+		SameSite: c.SameSite,
+	})
+}
+
+// domain is empty for __Host- cookies, which must not carry a Domain.
+func (c Cookies) domain() string {
+	if c.Dev {
+		return ""
+	}
+
+	return c.Domain
+}
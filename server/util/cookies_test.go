@@ -0,0 +1,78 @@
+package util_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/trnahnh/katana-id/util"
+)
+
+func TestCookies(t *testing.T) {
+	tests := []struct {
+		name       string
+		cookies    util.Cookies
+		wantName   string
+		wantDomain string
+		wantSecure bool
+	}{
+		{name: "no prefix", cookies: util.Cookies{}, wantName: "session", wantSecure: true},
+		{name: "host prefix", cookies: util.Cookies{Prefix: true}, wantName: "__Host-session", wantSecure: true},
+		{
+			name:       "secure prefix with domain",
+			cookies:    util.Cookies{Prefix: true, Domain: "example.com"},
+			wantName:   "__Secure-session",
+			wantDomain: "example.com",
+			wantSecure: true,
+		},
+		{name: "domain without prefix", cookies: util.Cookies{Domain: "example.com"}, wantName: "session", wantDomain: "example.com", wantSecure: true},
+		{name: "dev", cookies: util.Cookies{Prefix: true, Dev: true}, wantName: "session"},
+		{name: "dev with domain", cookies: util.Cookies{Prefix: true, Domain: "example.com", Dev: true}, wantName: "session"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cookies.SameSite = http.SameSiteStrictMode
+
+			if got := tt.cookies.Name("session"); got != tt.wantName {
+				t.Errorf("Name() = %q, want %q", got, tt.wantName)
+			}
+
+			rec := httptest.NewRecorder()
+			tt.cookies.Set(rec, "session", "abc", time.Hour, true)
+			tt.cookies.Clear(rec, "session", true)
+
+			cookies := rec.Result().Cookies()
+			if len(cookies) != 2 {
+				t.Fatalf("got %d cookies, want 2", len(cookies))
+			}
+			set, cleared := cookies[0], cookies[1]
+
+			if set.Value != "abc" || set.MaxAge != 3600 {
+				t.Errorf("set value %q for %ds, want abc for 3600s", set.Value, set.MaxAge)
+			}
+			if cleared.Value != "" || cleared.MaxAge != -1 {
+				t.Errorf("cleared value %q for %ds, want it expired", cleared.Value, cleared.MaxAge)
+			}
+
+			for _, cookie := range cookies {
+				if cookie.Name != tt.wantName || cookie.Path != "/" || cookie.Domain != tt.wantDomain {
+					t.Errorf("cookie %s on %q path %q, want %s on %q path /", cookie.Name, cookie.Domain, cookie.Path, tt.wantName, tt.wantDomain)
+				}
+				if cookie.Secure != tt.wantSecure {
+					t.Errorf("Secure = %v, want %v", cookie.Secure, tt.wantSecure)
+				}
+				if !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+					t.Errorf("cookie HttpOnly = %v, SameSite = %v, want HttpOnly strict", cookie.HttpOnly, cookie.SameSite)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: tt.wantName, Value: "abc"})
+			if got, err := tt.cookies.Get(req, "session"); err != nil || got != "abc" {
+				t.Errorf("Get() = %q, %v, want abc", got, err)
+			}
+		})
+	}
+}
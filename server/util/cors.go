@@ -1,18 +1,19 @@
 package util
 
 import (
-	"os"
-	"strings"
+	"net/http"
 
 	"github.com/go-chi/cors"
 )
 
-func CorsOptions() cors.Options {
+// CorsOptions allows credentialed requests from the origins allowOrigin
+// accepts for the request.
+func CorsOptions(allowOrigin func(r *http.Request, origin string) bool) cors.Options {
 	return cors.Options{
-		AllowedOrigins:   strings.Split(os.Getenv("ALLOWED_ORIGINS"), ","),
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowOriginFunc:  allowOrigin,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}
@@ -0,0 +1,120 @@
+package util_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/trnahnh/katana-id/util"
+)
+
+const csrfToken = "3q2-7wAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+
+func TestCSRFMiddleware(t *testing.T) {
+	csrf := util.CSRF{
+		AllowOrigin: func(origin string) bool { return origin == "https://app.example.com" },
+		Cookies:     util.Cookies{Dev: true},
+	}
+	handler := csrf.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		method        string
+		origin        string
+		referer       string
+		authorization string
+		cookie        string
+		header        string
+		wantStatus    int
+	}{
+		{name: "get", method: http.MethodGet, origin: "https://evil.example", wantStatus: http.StatusNoContent},
+		{name: "head", method: http.MethodHead, origin: "https://evil.example", wantStatus: http.StatusNoContent},
+		{name: "options", method: http.MethodOptions, origin: "https://evil.example", wantStatus: http.StatusNoContent},
+		{name: "matching token", method: http.MethodPost, origin: "https://app.example.com", cookie: csrfToken, header: csrfToken, wantStatus: http.StatusNoContent},
+		{name: "missing token", method: http.MethodPost, origin: "https://app.example.com", wantStatus: http.StatusForbidden},
+		{name: "missing header", method: http.MethodPost, origin: "https://app.example.com", cookie: csrfToken, wantStatus: http.StatusForbidden},
+		{name: "missing cookie", method: http.MethodPost, origin: "https://app.example.com", header: csrfToken, wantStatus: http.StatusForbidden},
+		{name: "mismatched token", method: http.MethodDelete, origin: "https://app.example.com", cookie: csrfToken, header: "forged", wantStatus: http.StatusForbidden},
+		{name: "foreign origin", method: http.MethodPost, origin: "https://evil.example", cookie: csrfToken, header: csrfToken, wantStatus: http.StatusForbidden},
+		{name: "null origin", method: http.MethodPost, origin: "null", cookie: csrfToken, header: csrfToken, wantStatus: http.StatusForbidden},
+		{name: "referer only", method: http.MethodPost, referer: "https://app.example.com/settings?tab=1", cookie: csrfToken, header: csrfToken, wantStatus: http.StatusNoContent},
+		{name: "foreign referer", method: http.MethodPost, referer: "https://evil.example/app.example.com", cookie: csrfToken, header: csrfToken, wantStatus: http.StatusForbidden},
+		{name: "relative referer", method: http.MethodPost, referer: "/settings", cookie: csrfToken, header: csrfToken, wantStatus: http.StatusForbidden},
+		{name: "origin wins over referer", method: http.MethodPost, origin: "https://evil.example", referer: "https://app.example.com/", cookie: csrfToken, header: csrfToken, wantStatus: http.StatusForbidden},
+		{name: "no origin or referer", method: http.MethodPost, cookie: csrfToken, header: csrfToken, wantStatus: http.StatusNoContent},
+		{name: "bearer", method: http.MethodPost, origin: "https://evil.example", authorization: "Bearer kid_abc", wantStatus: http.StatusNoContent},
+		{name: "basic auth not exempt", method: http.MethodPost, origin: "https://app.example.com", authorization: "Basic YWRhOnB3", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "csrf_token", Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set("X-CSRF-Token", tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	csrf := util.CSRF{Cookies: util.Cookies{Prefix: true}}
+
+	issue := func(cookie string) (string, *http.Cookie) {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "__Host-csrf_token", Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		csrf.Token(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+
+		var body struct {
+			CSRFToken string `json:"csrf_token"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("got %d cookies, want 1", len(cookies))
+		}
+		return body.CSRFToken, cookies[0]
+	}
+
+	token, cookie := issue("")
+	if cookie.Name != "__Host-csrf_token" || cookie.Value != token || cookie.HttpOnly {
+		t.Fatalf("cookie = %+v, want a readable __Host-csrf_token holding %q", cookie, token)
+	}
+
+	if reused, _ := issue(token); reused != token {
+		t.Errorf("token = %q, want the held %q reused", reused, token)
+	}
+	if fresh, _ := issue("short"); fresh == "short" || fresh == token {
+		t.Errorf("token = %q, want a fresh one for an invalid cookie", fresh)
+	}
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnvInt reads an integer env var, falling back when it's unset.
+func EnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatal("Invalid integer env ", key, ": ", value)
+	}
+
+	return n
+}
+
+// EnvDuration reads a Go duration env var such as "720h", falling back when
+// it's unset.
+func EnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatal("Invalid duration env ", key, ": ", value)
+	}
+
+	return d
+}
+
+// EnvBool reads a boolean env var such as "true" or "0", falling back when
+// it's unset.
+func EnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatal("Invalid boolean env ", key, ": ", value)
+	}
+
+	return b
+}
@@ -0,0 +1,59 @@
+package util_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/trnahnh/katana-id/util"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	serve := func(headers util.SecurityHeaders) http.Header {
+		rec := httptest.NewRecorder()
+		headers.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Header()
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		header := serve(util.SecurityHeadersFromEnv(false))
+
+		want := map[string]string{
+			"X-Content-Type-Options":    "nosniff",
+			"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+			"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'; base-uri 'none'",
+			"X-Frame-Options":           "DENY",
+			"Referrer-Policy":           "no-referrer",
+			"Permissions-Policy":        "camera=(), microphone=(), geolocation=(), interest-cohort=()",
+		}
+		for key, value := range want {
+			if got := header.Get(key); got != value {
+				t.Errorf("%s = %q, want %q", key, got, value)
+			}
+		}
+	})
+
+	t.Run("dev", func(t *testing.T) {
+		header := serve(util.SecurityHeadersFromEnv(true))
+		if got := header.Get("Strict-Transport-Security"); got != "" {
+			t.Errorf("Strict-Transport-Security = %q in dev mode, want none", got)
+		}
+	})
+
+	t.Run("overridden", func(t *testing.T) {
+		t.Setenv("SECURITY_FRAME_OPTIONS", "SAMEORIGIN")
+		t.Setenv("SECURITY_CSP", "")
+
+		header := serve(util.SecurityHeadersFromEnv(false))
+		if got := header.Get("X-Frame-Options"); got != "SAMEORIGIN" {
+			t.Errorf("X-Frame-Options = %q, want SAMEORIGIN", got)
+		}
+		if _, ok := header["Content-Security-Policy"]; ok {
+			t.Error("Content-Security-Policy set, want it dropped")
+		}
+		if got := header.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+		}
+	})
+}